@@ -0,0 +1,100 @@
+package sessionstore
+
+import (
+	"net"
+	"strings"
+)
+
+// sessionBindingCheck checks the IP address and user agent of the request,
+// as supplied in the options, against the ones bound to the session
+//
+// Parameters:
+//   - session - the session
+//   - options - the session options with the binding policy
+//
+// Returns:
+//   - *ErrBindingMismatch - the mismatch, nil if the session matches
+func sessionBindingCheck(session SessionInterface, options SessionOptionsInterface) *ErrBindingMismatch {
+	policy := options.GetBindingPolicy()
+
+	mismatch := func(field string, expected string, actual string) *ErrBindingMismatch {
+		return &ErrBindingMismatch{
+			Policy:    policy,
+			Field:     field,
+			Expected:  expected,
+			Actual:    actual,
+			SessionID: session.GetID(),
+		}
+	}
+
+	switch policy {
+	case BINDING_POLICY_OFF:
+		return nil
+	case BINDING_POLICY_USER_AGENT_FAMILY:
+		if options.HasUserAgent() && ParseUserAgent(session.GetUserAgent()).Family() != ParseUserAgent(options.GetUserAgent()).Family() {
+			return mismatch(COLUMN_USER_AGENT, session.GetUserAgent(), options.GetUserAgent())
+		}
+		return nil
+	}
+
+	if options.HasIPAddress() {
+		ipMatches := session.GetIPAddress() == options.GetIPAddress()
+
+		if policy == BINDING_POLICY_NETWORK_PREFIX {
+			ipMatches = ipNetworkPrefixMatch(session.GetIPAddress(), options.GetIPAddress())
+		}
+
+		if !ipMatches {
+			return mismatch(COLUMN_IP_ADDRESS, session.GetIPAddress(), options.GetIPAddress())
+		}
+	}
+
+	if options.HasUserAgent() && session.GetUserAgent() != options.GetUserAgent() {
+		return mismatch(COLUMN_USER_AGENT, session.GetUserAgent(), options.GetUserAgent())
+	}
+
+	return nil
+}
+
+// isBindingPolicySupported returns true if the binding policy is known
+func isBindingPolicySupported(policy string) bool {
+	switch policy {
+	case BINDING_POLICY_EXACT, BINDING_POLICY_NETWORK_PREFIX, BINDING_POLICY_USER_AGENT_FAMILY, BINDING_POLICY_OFF:
+		return true
+	}
+
+	return false
+}
+
+// ipNetworkPrefixMatch returns true if both IP addresses are in the same
+// /24 (IPv4) or /64 (IPv6) network. Addresses which cannot be parsed,
+// i.e. host:port values, are compared by their host part, then exactly.
+func ipNetworkPrefixMatch(a string, b string) bool {
+	ipA := net.ParseIP(ipAddressHost(a))
+	ipB := net.ParseIP(ipAddressHost(b))
+
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+
+	if ipA.To4() != nil && ipB.To4() != nil {
+		mask := net.CIDRMask(24, 32)
+		return ipA.To4().Mask(mask).Equal(ipB.To4().Mask(mask))
+	}
+
+	if ipA.To4() != nil || ipB.To4() != nil {
+		return false // IPv4 never matches IPv6
+	}
+
+	mask := net.CIDRMask(64, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// ipAddressHost strips the port from an address, as in http.Request.RemoteAddr
+func ipAddressHost(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+
+	return strings.Trim(address, "[]")
+}
@@ -0,0 +1,1129 @@
+package sessionstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	bolt "go.etcd.io/bbolt"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*boltStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*boltStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*boltStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*boltStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*boltStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*boltStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*boltStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*boltStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*boltStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// boltStore defines a session store backed by an embedded bbolt database,
+// for single binary deployments without a database server.
+//
+// Buckets, all names prefixed with the bucket prefix:
+//   - sessions - session id => session data (JSON)
+//   - keys - session key => session id
+//   - users - user id + NUL + session id => empty
+//   - expires - expires_at + NUL + session id => empty, ordered by expiry
+//   - created - created_at + NUL + session id => empty, ordered by creation
+//
+// The datetimes in the index keys sort lexicographically, so the
+// expiry sweep and the created_at/expires_at filters are range scans.
+type boltStore struct {
+	db           *bolt.DB
+	bucketPrefix string
+	debugEnabled bool
+	logger       *slog.Logger
+
+	userSessionHandleSecret []byte // keys the user session handles
+}
+
+// NewBoltStoreOptions define the options for creating a new bbolt session store
+type NewBoltStoreOptions struct {
+	DB                 *bolt.DB
+	BucketPrefix       string
+	AutomigrateEnabled bool
+	DebugEnabled       bool
+	Logger             *slog.Logger
+
+	// UserSessionHandleSecret keys the HMAC of the handles returned by
+	// UserSessions, required by UserSessions and UserSessionRevoke, which
+	// return ErrUserSessionHandleSecretRequired without it. All the
+	// instances sharing the sessions must set the same secret, kept across
+	// restarts, or the handles stop matching
+	UserSessionHandleSecret string
+}
+
+// == CONSTRUCTOR =============================================================
+
+// NewBoltStore creates a new bbolt session store
+func NewBoltStore(opts NewBoltStoreOptions) (*boltStore, error) {
+	store := &boltStore{
+		db:           opts.DB,
+		bucketPrefix: opts.BucketPrefix,
+		debugEnabled: opts.DebugEnabled,
+		logger:       opts.Logger,
+
+		userSessionHandleSecret: []byte(opts.UserSessionHandleSecret),
+	}
+
+	if store.db == nil {
+		return nil, errors.New("bolt session store: DB is required")
+	}
+
+	if store.bucketPrefix == "" {
+		store.bucketPrefix = "sessionstore_"
+	}
+
+	if store.logger == nil {
+		store.logger = slog.Default()
+	}
+
+	if opts.AutomigrateEnabled {
+		if err := store.AutoMigrate(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate creates the buckets if they do not exist
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) AutoMigrate(ctx context.Context) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range store.bucketNames() {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EnableDebug enables the debug mode
+//
+// # If debug mode is enabled, it will log the operations to the logger
+//
+// Parameters:
+//   - debug - true to enable, false to disable
+func (store *boltStore) EnableDebug(debug bool) {
+	store.debugEnabled = debug
+}
+
+// SessionExpiryGoroutine runs periodically (every minute) and deletes
+// the sessions that have expired
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionExpiryGoroutine() error {
+	for {
+		if _, err := store.deleteExpired(); err != nil {
+			store.logger.Error("Bolt Session Store. SessionExpiryGoroutine", slog.String("error", err.Error()))
+		}
+
+		time.Sleep(60 * time.Second) // Every minute
+	}
+}
+
+// SessionCount returns the count of sessions matching the query.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - int64 - the count of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	if query == nil {
+		return -1, errors.New("bolt session store > session count. query cannot be nil")
+	}
+
+	query.SetCountOnly(true)
+
+	list, err := store.SessionList(ctx, query)
+
+	if err != nil {
+		return -1, err
+	}
+
+	return int64(len(list)), nil
+}
+
+// SessionCreate creates a new session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("bolt session store > session create. session cannot be nil")
+	}
+
+	if session.GetKey() == "" {
+		return errors.New("bolt session store > session create. key cannot be empty")
+	}
+
+	if session.GetExpiresAt() == "" {
+		return errors.New("bolt session store > session create. expires at cannot be empty")
+	}
+
+	if session.GetCreatedAt() == "" {
+		session.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetUpdatedAt() == "" {
+		session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetSoftDeletedAt() == "" {
+		session.SetSoftDeletedAt(sb.MAX_DATETIME)
+	}
+
+	store.logOperation("create", session.GetID())
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(store.bucketName("keys")).Get([]byte(session.GetKey())) != nil {
+			return errors.New("bolt session store > session create. session key already exists")
+		}
+
+		if tx.Bucket(store.bucketName("sessions")).Get([]byte(session.GetID())) != nil {
+			return errors.New("bolt session store > session create. session id already exists")
+		}
+
+		return store.put(tx, nil, session.Data())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionCreateMany creates sessions one at a time, stopping at the
+// first error, the sessions created before it are kept
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	return sessionCreateEach(ctx, store.SessionCreate, sessions)
+}
+
+// SessionDelete deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	return store.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionDeleteByID deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionDeleteByID(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("session id is empty")
+	}
+
+	store.logOperation("delete", id)
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		_, err := store.delete(tx, id)
+		return err
+	})
+}
+
+// SessionDeleteByUserID deletes all the sessions of a user in a single
+// transaction, i.e. to log the user out everywhere.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("bolt session store > session delete by user id. user id cannot be empty")
+	}
+
+	store.logOperation("delete by user id", userID)
+
+	deleted := int64(0)
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range store.userSessionIDs(tx, userID) {
+			if id == exceptSessionID {
+				continue
+			}
+
+			if _, err := store.delete(tx, id); err != nil {
+				return err
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// SessionDeleteMany deletes the sessions matching the filters of a
+// query one at a time, see store.SessionDeleteMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return sessionDeleteEach(ctx, store, query)
+}
+
+// SessionExtend extends a session's expiry time by the given seconds.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to extend
+//   - seconds - the number of seconds to extend the session by
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	expiresAt := carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC)
+
+	session.SetExpiresAt(expiresAt)
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionFindByID finds a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	if sessionID == "" {
+		return nil, errors.New("bolt session store > find by id: session id is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetID(sessionID).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFindByKey finds a session by key.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	if sessionKey == "" {
+		return nil, errors.New("bolt session store > find by key: session key is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetKey(sessionKey).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFlush does nothing, every write is committed to bolt directly
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - always nil
+func (store *boltStore) SessionFlush(ctx context.Context) error {
+	return nil
+}
+
+// SessionList returns a list of sessions matching the query.
+//
+// The candidates are read from the most selective bucket available (key,
+// id, user index, created or expires range), the remaining filters,
+// ordering and pagination are applied in memory.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - []SessionInterface - list of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	if query == nil {
+		return []SessionInterface{}, errors.New("bolt session store > session list. query cannot be nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return []SessionInterface{}, err
+	}
+
+	candidates := []SessionInterface{}
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var ids []string
+
+		switch {
+		case query.HasKey():
+			if id := tx.Bucket(store.bucketName("keys")).Get([]byte(query.Key())); id != nil {
+				ids = []string{string(id)}
+			}
+		case query.HasID():
+			ids = []string{query.ID()}
+		case query.HasIDIn():
+			ids = query.IDIn()
+		case query.HasKeyIn():
+			for _, key := range lo.Uniq(query.KeyIn()) {
+				if id := tx.Bucket(store.bucketName("keys")).Get([]byte(key)); id != nil {
+					ids = append(ids, string(id))
+				}
+			}
+		case query.HasUserID():
+			ids = store.userSessionIDs(tx, query.UserID())
+		case query.HasUserIDIn():
+			for _, userID := range lo.Uniq(query.UserIDIn()) {
+				ids = append(ids, store.userSessionIDs(tx, userID)...)
+			}
+		case query.HasCreatedAtGte() || query.HasCreatedAtLte():
+			min, max := "", "\xff"
+			if query.HasCreatedAtGte() {
+				min = query.CreatedAtGte()
+			}
+			if query.HasCreatedAtLte() {
+				max = query.CreatedAtLte()
+			}
+			ids = store.rangeScan(tx, "created", min, max)
+		case query.HasExpiresAtGte() || query.HasExpiresAtLte():
+			min, max := "", "\xff"
+			if query.HasExpiresAtGte() {
+				min = query.ExpiresAtGte()
+			}
+			if query.HasExpiresAtLte() {
+				max = query.ExpiresAtLte()
+			}
+			ids = store.rangeScan(tx, "expires", min, max)
+		default:
+			ids = store.rangeScan(tx, "created", "", "\xff")
+		}
+
+		for _, id := range ids {
+			data, err := store.get(tx, id)
+
+			if err != nil {
+				return err
+			}
+
+			if data != nil {
+				candidates = append(candidates, NewSessionFromExistingData(data))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	return sessionsApplyQuery(candidates, query), nil
+}
+
+// SessionListPage returns a page of the sessions matching the query, and
+// the cursor of the next page, see store.SessionListPage. The created
+// bucket is read from the cursor on, up to the end of the page, unless
+// the query looks the sessions up by key, id or user, as SessionList.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 100)
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	limit, err := sessionPageLimit(query)
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	if sessionQueryHasLookup(query) {
+		return sessionListPage(ctx, store.SessionList, query)
+	}
+
+	sessions := []SessionInterface{}
+	cursor := ""
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		var errPage error
+		sessions, cursor, errPage = sessionIndexPage(query, limit, store.createdWalk(tx, query))
+		return errPage
+	})
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	return sessions, cursor, nil
+}
+
+// SessionIterate calls fn for each session matching the query, a page
+// at a time, see store.SessionIterate
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 1000)
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *boltStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return sessionIterate(ctx, store.SessionListPage, query, fn)
+}
+
+// SessionStats returns statistics of the sessions, see store.SessionStats.
+// They are computed in memory, iterating over the sessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return sessionStatsIterate(ctx, store.SessionIterate, query)
+}
+
+// SessionPromote upgrades a guest session to an authenticated one,
+// merging the value of the user's most recent session and regenerating
+// the session key.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	return sessionPromoteByUpdate(ctx, store, session, userID, mergeStrategy)
+}
+
+// SessionSoftDelete soft deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to soft delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	session.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionSoftDeleteByID soft deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionSoftDeleteByID(ctx context.Context, id string) error {
+	session, err := store.SessionFindByID(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user in a
+// single transaction, i.e. on password reset.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("bolt session store > session soft delete by user id. user id cannot be empty")
+	}
+
+	store.logOperation("soft delete by user id", userID)
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	softDeleted := int64(0)
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		for _, id := range store.userSessionIDs(tx, userID) {
+			if id == exceptSessionID {
+				continue
+			}
+
+			current, err := store.get(tx, id)
+
+			if err != nil {
+				return err
+			}
+
+			if current == nil || current[COLUMN_SOFT_DELETED_AT] <= now {
+				continue
+			}
+
+			err = store.put(tx, current, map[string]string{
+				COLUMN_ID:              id,
+				COLUMN_SOFT_DELETED_AT: now,
+				COLUMN_UPDATED_AT:      now,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			softDeleted++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return softDeleted, nil
+}
+
+// SessionUpdate updates the changed fields of a session, including its key.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to update
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("bolt session store > session update. session cannot be nil")
+	}
+
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	dataChanged := session.DataChanged()
+
+	if len(dataChanged) == 0 {
+		return nil
+	}
+
+	dataChanged[COLUMN_ID] = session.GetID() // ID cannot be updated, identifies the session
+
+	store.logOperation("update", session.GetID())
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		current, err := store.get(tx, session.GetID())
+
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			return nil // nothing to update, as with SQL
+		}
+
+		if key, changed := dataChanged[COLUMN_SESSION_KEY]; changed && key != current[COLUMN_SESSION_KEY] {
+			if tx.Bucket(store.bucketName("keys")).Get([]byte(key)) != nil {
+				return errors.New("bolt session store > session update. session key already exists")
+			}
+		}
+
+		return store.put(tx, current, dataChanged)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionUpdateMany sets the fields of the sessions matching the filters
+// of a query one at a time, see store.SessionUpdateMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	return sessionUpdateEach(ctx, store, query, fields)
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, see store.SessionFindByIDIncludingDeleted
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return sessionFindByIDIncludingDeleted(ctx, store.SessionList, sessionID)
+}
+
+// SessionRestore restores a soft deleted session, and records who
+// restored it, when and why, see store.SessionRestore
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func (store *boltStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	session, err := sessionRestorePrepare(ctx, store, sessionID, options)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// UserSessions returns the active sessions of a user, most recently
+// seen first, i.e. for a "Where you're logged in" page.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *boltStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	_, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+	return err
+}
+
+// PRIVATE METHODS ===========================================================
+
+// deleteExpired deletes the sessions which have expired, scanning the
+// expires bucket from the start up to now
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) deleteExpired() (int64, error) {
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	deleted := int64(0)
+
+	store.logOperation("delete expired", now)
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		expired := []string{}
+
+		cursor := tx.Bucket(store.bucketName("expires")).Cursor()
+
+		for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+			datetime, id := boltIndexKeySplit(k)
+
+			if datetime >= now {
+				break
+			}
+
+			expired = append(expired, id)
+		}
+
+		for _, id := range expired {
+			if _, err := store.delete(tx, id); err != nil {
+				return err
+			}
+			deleted++
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// get returns the data of a session by id, nil if it does not exist
+func (store *boltStore) get(tx *bolt.Tx, id string) (map[string]string, error) {
+	raw := tx.Bucket(store.bucketName("sessions")).Get([]byte(id))
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	data := map[string]string{}
+
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// put writes the changed data over the current data of a session
+// (nil for a new session), keeping the index buckets in sync
+func (store *boltStore) put(tx *bolt.Tx, current map[string]string, changed map[string]string) error {
+	if current == nil {
+		current = map[string]string{}
+	}
+
+	data := lo.Assign(current, changed)
+	id := data[COLUMN_ID]
+
+	type index struct {
+		bucket string
+		column string
+	}
+
+	indexes := []index{
+		{"users", COLUMN_USER_ID},
+		{"expires", COLUMN_EXPIRES_AT},
+		{"created", COLUMN_CREATED_AT},
+	}
+
+	for _, idx := range indexes {
+		bucket := tx.Bucket(store.bucketName(idx.bucket))
+
+		if old, ok := current[idx.column]; ok && old != "" {
+			if err := bucket.Delete(boltIndexKey(old, id)); err != nil {
+				return err
+			}
+		}
+
+		if value := data[idx.column]; value != "" {
+			if err := bucket.Put(boltIndexKey(value, id), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := tx.Bucket(store.bucketName("keys"))
+
+	if old, ok := current[COLUMN_SESSION_KEY]; ok && old != data[COLUMN_SESSION_KEY] {
+		if err := keys.Delete([]byte(old)); err != nil {
+			return err
+		}
+	}
+
+	if err := keys.Put([]byte(data[COLUMN_SESSION_KEY]), []byte(id)); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(store.bucketName("sessions")).Put([]byte(id), raw)
+}
+
+// delete deletes a session and its index entries by id
+//
+// Returns:
+//   - bool - true if the session existed
+//   - error - nil if successful, otherwise an error
+func (store *boltStore) delete(tx *bolt.Tx, id string) (bool, error) {
+	current, err := store.get(tx, id)
+
+	if err != nil || current == nil {
+		return false, err
+	}
+
+	deletes := []struct {
+		bucket string
+		key    []byte
+	}{
+		{"sessions", []byte(id)},
+		{"keys", []byte(current[COLUMN_SESSION_KEY])},
+		{"users", boltIndexKey(current[COLUMN_USER_ID], id)},
+		{"expires", boltIndexKey(current[COLUMN_EXPIRES_AT], id)},
+		{"created", boltIndexKey(current[COLUMN_CREATED_AT], id)},
+	}
+
+	for _, del := range deletes {
+		if err := tx.Bucket(store.bucketName(del.bucket)).Delete(del.key); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// rangeScan returns the session ids in an index bucket whose datetime is
+// within the inclusive bounds, in ascending order
+func (store *boltStore) rangeScan(tx *bolt.Tx, bucket string, min string, max string) []string {
+	ids := []string{}
+	cursor := tx.Bucket(store.bucketName(bucket)).Cursor()
+
+	for k, _ := cursor.Seek([]byte(min)); k != nil; k, _ = cursor.Next() {
+		datetime, id := boltIndexKeySplit(k)
+
+		if datetime > max {
+			break
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// createdWalk returns a function returning the sessions of the created
+// bucket one at a time, in the keyset order of the query, from its cursor
+// to its created_at bound, nil after the last one
+func (store *boltStore) createdWalk(tx *bolt.Tx, query SessionQueryInterface) func() (SessionInterface, error) {
+	ascending := sessionQueryAscending(query)
+	cursor := tx.Bucket(store.bucketName("created")).Cursor()
+
+	var seek []byte
+
+	if query.HasCursor() {
+		position, _ := sessionCursorDecode(query.Cursor())
+		seek = boltIndexKey(position.CreatedAt, position.ID)
+	} else if ascending && query.HasCreatedAtGte() {
+		seek = []byte(query.CreatedAtGte())
+	} else if !ascending && query.HasCreatedAtLte() {
+		seek = boltIndexKey(query.CreatedAtLte(), "\xff")
+	}
+
+	var k []byte
+
+	switch {
+	case ascending && seek == nil:
+		k, _ = cursor.First()
+	case ascending:
+		k, _ = cursor.Seek(seek)
+
+		if k != nil && query.HasCursor() && bytes.Equal(k, seek) {
+			k, _ = cursor.Next() // the last session of the previous page
+		}
+	case seek == nil:
+		k, _ = cursor.Last()
+	default:
+		if k, _ = cursor.Seek(seek); k == nil {
+			k, _ = cursor.Last()
+		} else {
+			k, _ = cursor.Prev() // the keys before the seek key
+		}
+	}
+
+	return func() (SessionInterface, error) {
+		for k != nil {
+			createdAt, id := boltIndexKeySplit(k)
+
+			if ascending && query.HasCreatedAtLte() && createdAt > query.CreatedAtLte() {
+				break
+			}
+
+			if !ascending && query.HasCreatedAtGte() && createdAt < query.CreatedAtGte() {
+				break
+			}
+
+			if ascending {
+				k, _ = cursor.Next()
+			} else {
+				k, _ = cursor.Prev()
+			}
+
+			data, err := store.get(tx, id)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if data != nil {
+				return NewSessionFromExistingData(data), nil
+			}
+		}
+
+		k = nil
+
+		return nil, nil
+	}
+}
+
+// userSessionIDs returns the ids of the sessions of a user
+func (store *boltStore) userSessionIDs(tx *bolt.Tx, userID string) []string {
+	ids := []string{}
+	prefix := boltIndexKey(userID, "")
+	cursor := tx.Bucket(store.bucketName("users")).Cursor()
+
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		_, id := boltIndexKeySplit(k)
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// bucketName returns the prefixed name of a bucket
+func (store *boltStore) bucketName(name string) []byte {
+	return []byte(store.bucketPrefix + name)
+}
+
+// bucketNames returns the prefixed names of all the buckets
+func (store *boltStore) bucketNames() [][]byte {
+	return lo.Map([]string{"sessions", "keys", "users", "expires", "created"}, func(name string, _ int) []byte {
+		return store.bucketName(name)
+	})
+}
+
+// logOperation logs the operation if debug is enabled
+func (store *boltStore) logOperation(operation string, subject string) {
+	if !store.debugEnabled {
+		return
+	}
+
+	store.logger.Debug("bolt: "+operation, slog.String("subject", subject))
+}
+
+// boltIndexKey returns the key of an index entry, the value and the
+// session id separated by NUL, so entries sort by value
+func boltIndexKey(value string, id string) []byte {
+	return []byte(value + "\x00" + id)
+}
+
+// boltIndexKeySplit splits the key of an index entry into value and session id
+func boltIndexKeySplit(key []byte) (value string, id string) {
+	parts := bytes.SplitN(key, []byte{0}, 2)
+
+	if len(parts) < 2 {
+		return string(parts[0]), ""
+	}
+
+	return string(parts[0]), string(parts[1])
+}
@@ -0,0 +1,208 @@
+package sessionstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dromara/carbon/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+func initBoltStore(t *testing.T) *boltStore {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "sessions.db"), 0600, nil)
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewBoltStore(NewBoltStoreOptions{
+		DB:                 db,
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	return store
+}
+
+func TestBoltStore_SessionCreateAndFind(t *testing.T) {
+	store := initBoltStore(t)
+
+	session := NewSession().
+		SetUserID("1").
+		SetValue("one two three four")
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionCreate(context.Background(), NewSession().SetKey(session.GetKey())); err == nil {
+		t.Fatal("duplicate session key MUST be rejected")
+	}
+
+	found, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetID() != session.GetID() || found.GetValue() != "one two three four" {
+		t.Fatal("unexpected session found by key:", found)
+	}
+
+	found.SetValue("updated").SetKey(generateSessionKey(100))
+
+	if err := store.SessionUpdate(context.Background(), found); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	oldKeyFound, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if oldKeyFound != nil {
+		t.Fatal("old key MUST NOT be valid anymore")
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetValue() != "updated" {
+		t.Fatal("unexpected sessions of the user:", list)
+	}
+}
+
+func TestBoltStore_RangeFiltersAndExpiry(t *testing.T) {
+	store := initBoltStore(t)
+
+	expired := NewSession().
+		SetCreatedAt(carbon.Now(carbon.UTC).SubHours(3).ToDateTimeString(carbon.UTC)).
+		SetExpiresAt(carbon.Now(carbon.UTC).SubHours(1).ToDateTimeString(carbon.UTC))
+
+	old := NewSession().
+		SetCreatedAt(carbon.Now(carbon.UTC).SubHours(2).ToDateTimeString(carbon.UTC))
+
+	recent := NewSession()
+
+	for _, session := range []SessionInterface{expired, old, recent} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().
+		SetCreatedAtGte(carbon.Now(carbon.UTC).SubMinutes(150).ToDateTimeString(carbon.UTC)).
+		SetCreatedAtLte(carbon.Now(carbon.UTC).SubMinutes(30).ToDateTimeString(carbon.UTC)))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetID() != old.GetID() {
+		t.Fatal("unexpected created_at range result:", list)
+	}
+
+	deleted, err := store.deleteExpired()
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1 {
+		t.Fatal("unexpected expired count:", deleted)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatal("unexpected count after expiry sweep:", count)
+	}
+}
+
+func TestBoltStore_SessionDeleteByUserID(t *testing.T) {
+	store := initBoltStore(t)
+
+	current := NewSession().SetUserID("1")
+
+	for _, session := range []SessionInterface{current, NewSession().SetUserID("1"), NewSession().SetUserID("12")} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	deleted, err := store.SessionDeleteByUserID(context.Background(), "1", current.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1 {
+		t.Fatal("unexpected deleted count:", deleted)
+	}
+
+	softDeleted, err := store.SessionSoftDeleteByUserID(context.Background(), "1", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if softDeleted != 1 {
+		t.Fatal("unexpected soft deleted count:", softDeleted)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("only the session of user 12 MUST remain active, found:", count)
+	}
+}
+
+func TestBoltStore_SessionList_Filters(t *testing.T) {
+	assertSessionListFilters(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionListPage(t *testing.T) {
+	assertSessionListPages(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionListPage_Index(t *testing.T) {
+	assertSessionIndexPages(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionList_Sorts(t *testing.T) {
+	assertSessionListSorts(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionStats(t *testing.T) {
+	assertSessionStats(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionPartial(t *testing.T) {
+	assertSessionPartial(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionBulk(t *testing.T) {
+	assertSessionBulk(t, initBoltStore(t))
+}
+
+func TestBoltStore_SessionRestore(t *testing.T) {
+	assertSessionRestore(t, initBoltStore(t))
+}
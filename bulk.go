@@ -0,0 +1,312 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/samber/lo"
+)
+
+// bulkQueryValidate validates the session query of a bulk delete or
+// update, which selects the sessions by its filters only
+//
+// Parameters:
+//   - query - the session query
+//
+// Returns:
+//   - error - nil if valid, otherwise an error
+func bulkQueryValidate(query SessionQueryInterface) error {
+	if query == nil {
+		return errors.New("session query: cannot be nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return err
+	}
+
+	if query.HasLimit() || query.HasOffset() || query.HasCursor() || query.HasOrderBy() || query.HasOrderByColumns() {
+		return errors.New("session query: a bulk delete or update cannot be paginated or sorted")
+	}
+
+	return nil
+}
+
+// bulkFieldsValidate validates the fields of a bulk update, the id and
+// the key identify each session, and cannot be updated in bulk
+//
+// Parameters:
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - error - nil if valid, otherwise an error
+func bulkFieldsValidate(fields map[string]string) error {
+	if len(fields) == 0 {
+		return errors.New("session update many: fields cannot be empty")
+	}
+
+	for _, column := range []string{COLUMN_ID, COLUMN_SESSION_KEY} {
+		if _, ok := fields[column]; ok {
+			return errors.New("session update many: " + column + " cannot be updated in bulk")
+		}
+	}
+
+	return nil
+}
+
+// bulkQueryChunks splits a session query, whose id, key or user id lists
+// hold more values than fit in a statement, into queries with at most
+// size values in all the lists, one per combination of their chunks
+//
+// Parameters:
+//   - query - the session query
+//   - size - the maximum number of values of all the lists
+//
+// Returns:
+//   - []SessionQueryInterface - the session queries
+func bulkQueryChunks(query SessionQueryInterface, size int) []SessionQueryInterface {
+	type list struct {
+		values []string
+		set    func(q SessionQueryInterface, values []string) SessionQueryInterface
+	}
+
+	lists := []list{}
+
+	if query.HasIDIn() {
+		lists = append(lists, list{query.IDIn(), SessionQueryInterface.SetIDIn})
+	}
+
+	if query.HasKeyIn() {
+		lists = append(lists, list{query.KeyIn(), SessionQueryInterface.SetKeyIn})
+	}
+
+	if query.HasUserIDIn() {
+		lists = append(lists, list{query.UserIDIn(), SessionQueryInterface.SetUserIDIn})
+	}
+
+	size = max(size/max(len(lists), 1), 1) // all the lists in each statement
+	queries := []SessionQueryInterface{query}
+
+	for _, l := range lists {
+		if len(l.values) <= size {
+			continue
+		}
+
+		chunks := []SessionQueryInterface{}
+
+		for _, q := range queries {
+			for _, values := range lo.Chunk(l.values, size) {
+				chunks = append(chunks, l.set(sessionQueryCopy(q), values))
+			}
+		}
+
+		queries = chunks
+	}
+
+	return queries
+}
+
+// storeCreateMany creates sessions with SessionCreateMany if the store
+// implements BulkStoreInterface, otherwise one at a time
+func storeCreateMany(ctx context.Context, st StoreInterface, sessions []SessionInterface) error {
+	if bulk, ok := st.(BulkStoreInterface); ok {
+		return bulk.SessionCreateMany(ctx, sessions)
+	}
+
+	return sessionCreateEach(ctx, st.SessionCreate, sessions)
+}
+
+// storeDeleteMany deletes the sessions matching a query with
+// SessionDeleteMany if the store implements BulkStoreInterface,
+// otherwise one at a time
+func storeDeleteMany(ctx context.Context, st StoreInterface, query SessionQueryInterface) (int64, error) {
+	if bulk, ok := st.(BulkStoreInterface); ok {
+		return bulk.SessionDeleteMany(ctx, query)
+	}
+
+	return sessionDeleteEach(ctx, st, query)
+}
+
+// storeUpdateMany updates the sessions matching a query with
+// SessionUpdateMany if the store implements BulkStoreInterface,
+// otherwise one at a time
+func storeUpdateMany(ctx context.Context, st StoreInterface, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	if bulk, ok := st.(BulkStoreInterface); ok {
+		return bulk.SessionUpdateMany(ctx, query, fields)
+	}
+
+	return sessionUpdateEach(ctx, st, query, fields)
+}
+
+// sessionCreateEach creates the sessions one at a time, for the stores
+// without multi-row writes, stopping at the first error
+//
+// Parameters:
+//   - ctx - the context
+//   - create - the SessionCreate function of the store
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func sessionCreateEach(ctx context.Context, create func(ctx context.Context, session SessionInterface) error, sessions []SessionInterface) error {
+	for _, session := range sessions {
+		if session == nil {
+			return errors.New("session create many: session cannot be nil")
+		}
+
+		if err := create(ctx, session); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sessionDeleteEach deletes the sessions matching the query one at a
+// time, for the stores without a delete statement
+//
+// Parameters:
+//   - ctx - the context
+//   - store - the store
+//   - query - the session query
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func sessionDeleteEach(ctx context.Context, store StoreInterface, query SessionQueryInterface) (int64, error) {
+	ids, err := sessionIDsMatching(ctx, store, query)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := store.SessionDeleteByID(ctx, id); err != nil {
+			return int64(i), err
+		}
+	}
+
+	return int64(len(ids)), nil
+}
+
+// sessionUpdateEach updates the sessions matching the query one at a
+// time, for the stores without an update statement
+//
+// Parameters:
+//   - ctx - the context
+//   - store - the store
+//   - query - the session query
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func sessionUpdateEach(ctx context.Context, store StoreInterface, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	if err := bulkFieldsValidate(fields); err != nil {
+		return 0, err
+	}
+
+	ids, err := sessionIDsMatching(ctx, store, query)
+
+	if err != nil {
+		return 0, err
+	}
+
+	updated := int64(0)
+
+	for _, id := range ids {
+		session, err := store.SessionFindByID(ctx, id)
+
+		if err != nil {
+			return updated, err
+		}
+
+		if session == nil {
+			continue // deleted meanwhile
+		}
+
+		if err := store.SessionUpdate(ctx, sessionWithFields(session, fields)); err != nil {
+			return updated, err
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+// sessionIDsMatching returns the ids of the sessions matching a bulk
+// query, read before the sessions are written, as the writes may change
+// which sessions the query matches
+func sessionIDsMatching(ctx context.Context, store StoreInterface, query SessionQueryInterface) ([]string, error) {
+	if err := bulkQueryValidate(query); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+
+	err := storeIterate(ctx, store, sessionQueryCopy(query).SetColumns([]string{COLUMN_ID}), func(session SessionInterface) error {
+		ids = append(ids, session.GetID())
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(ids) // a stable order of writes
+
+	return ids, nil
+}
+
+// storeDeleteByUserID deletes the sessions of a user with
+// SessionDeleteByUserID if the store implements UserStoreInterface,
+// otherwise one at a time
+func storeDeleteByUserID(ctx context.Context, st StoreInterface, userID string, exceptSessionID string) (int64, error) {
+	if users, ok := st.(UserStoreInterface); ok {
+		return users.SessionDeleteByUserID(ctx, userID, exceptSessionID)
+	}
+
+	return sessionUserEach(ctx, st, userID, exceptSessionID, st.SessionDeleteByID)
+}
+
+// storeSoftDeleteByUserID soft deletes the sessions of a user with
+// SessionSoftDeleteByUserID if the store implements UserStoreInterface,
+// otherwise one at a time
+func storeSoftDeleteByUserID(ctx context.Context, st StoreInterface, userID string, exceptSessionID string) (int64, error) {
+	if users, ok := st.(UserStoreInterface); ok {
+		return users.SessionSoftDeleteByUserID(ctx, userID, exceptSessionID)
+	}
+
+	return sessionUserEach(ctx, st, userID, exceptSessionID, st.SessionSoftDeleteByID)
+}
+
+// sessionUserEach runs a write by id on each session of a user, except
+// the given one
+func sessionUserEach(ctx context.Context, st StoreInterface, userID string, exceptSessionID string, write func(ctx context.Context, sessionID string) error) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("session store: user id cannot be empty")
+	}
+
+	sessions, err := st.SessionList(ctx, SessionQuery().SetUserID(userID))
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := int64(0)
+
+	for _, session := range sessions {
+		if session.GetID() == exceptSessionID {
+			continue
+		}
+
+		if err := write(ctx, session.GetID()); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
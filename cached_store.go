@@ -0,0 +1,374 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*cachedStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*cachedStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*cachedStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*cachedStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*cachedStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*cachedStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*cachedStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*cachedStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*cachedStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// cachedStore is a read-through cache in front of another store.
+//
+// SessionFindByKey is served from a bounded LRU cache, the cache entries
+// are invalidated by every write going through this store. Writes made
+// by other instances are only seen after the entries expire, see TTL,
+// unless SessionChangeHandle is subscribed to the changes of the store.
+type cachedStore struct {
+	inner       StoreInterface
+	cache       *sessionCache
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+// CacheOptions define the options of the cached store
+type CacheOptions struct {
+	// MaxEntries is the maximum number of cached session keys, default 10000
+	MaxEntries int
+
+	// TTL is how long a session is cached, never past its expires_at,
+	// default 1 minute
+	TTL time.Duration
+
+	// NegativeTTL is how long an unknown session key is remembered as
+	// unknown, to blunt brute force lookups. Default 10 seconds,
+	// a negative value disables negative caching
+	NegativeTTL time.Duration
+}
+
+// == CONSTRUCTOR =============================================================
+
+// NewCachedStore creates a new store caching the session lookups by key
+// of the inner store
+func NewCachedStore(inner StoreInterface, opts CacheOptions) (*cachedStore, error) {
+	if inner == nil {
+		return nil, errors.New("cached session store: inner store is required")
+	}
+
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 10000
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = 10 * time.Second
+	}
+
+	return &cachedStore{
+		inner:       inner,
+		cache:       newSessionCache(opts.MaxEntries),
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
+	}, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate migrates the inner store
+func (store *cachedStore) AutoMigrate(ctx context.Context) error {
+	return store.inner.AutoMigrate(ctx)
+}
+
+// EnableDebug enables the debug mode of the inner store
+func (store *cachedStore) EnableDebug(debug bool) {
+	store.inner.EnableDebug(debug)
+}
+
+// SessionExpiryGoroutine runs the expiry goroutine of the inner store.
+// Expired sessions need no invalidation, as entries never outlive expires_at.
+func (store *cachedStore) SessionExpiryGoroutine() error {
+	return store.inner.SessionExpiryGoroutine()
+}
+
+// SessionChangeHandle invalidates the sessions changed by another instance,
+// pass it as the handler of SessionChangesSubscribe to keep the cache
+// coherent across instances
+//
+// Parameters:
+//   - ctx - the context
+//   - change - the session change
+func (store *cachedStore) SessionChangeHandle(ctx context.Context, change SessionChange) {
+	switch {
+	case change.SessionID != "":
+		store.cache.invalidateID(change.SessionID)
+	case change.UserID != "":
+		store.cache.invalidateUserID(change.UserID)
+	default:
+		store.cache.invalidateAll()
+	}
+}
+
+// SessionCount returns the count of sessions matching the query, uncached
+func (store *cachedStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return store.inner.SessionCount(ctx, query)
+}
+
+// SessionCreate creates a new session, forgetting a cached absence of its
+// key, and invalidates the sessions of its user, which the inner store
+// may have evicted to make room for it
+func (store *cachedStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session != nil {
+		defer store.invalidateUserID(session.GetUserID())
+		defer store.cache.invalidateKey(session.GetKey())
+	}
+
+	return store.inner.SessionCreate(ctx, session)
+}
+
+// SessionCreateMany creates sessions, forgetting cached absences of their
+// keys, and invalidates the sessions of their users, see SessionCreate
+func (store *cachedStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	defer func() {
+		for _, session := range sessions {
+			if session != nil {
+				store.cache.invalidateKey(session.GetKey())
+				store.invalidateUserID(session.GetUserID())
+			}
+		}
+	}()
+
+	return storeCreateMany(ctx, store.inner, sessions)
+}
+
+// SessionDelete deletes a session and invalidates it
+func (store *cachedStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session != nil {
+		defer store.invalidateSession(session)
+	}
+
+	return store.inner.SessionDelete(ctx, session)
+}
+
+// SessionDeleteByID deletes a session by id and invalidates it
+func (store *cachedStore) SessionDeleteByID(ctx context.Context, sessionID string) error {
+	defer store.cache.invalidateID(sessionID)
+
+	return store.inner.SessionDeleteByID(ctx, sessionID)
+}
+
+// SessionDeleteByUserID deletes the sessions of a user and invalidates them
+func (store *cachedStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	defer store.cache.invalidateUserID(userID)
+
+	return storeDeleteByUserID(ctx, store.inner, userID, exceptSessionID)
+}
+
+// SessionDeleteMany deletes the sessions matching a query and empties
+// the cache, as the cached sessions cannot be matched against the query
+func (store *cachedStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	defer store.cache.invalidateAll()
+
+	return storeDeleteMany(ctx, store.inner, query)
+}
+
+// SessionExtend extends a session and invalidates it
+func (store *cachedStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session != nil {
+		defer store.invalidateSession(session)
+	}
+
+	return store.inner.SessionExtend(ctx, session, seconds)
+}
+
+// SessionFindByID finds a session by id, uncached
+func (store *cachedStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return store.inner.SessionFindByID(ctx, sessionID)
+}
+
+// SessionFindByKey finds a session by key, from the cache if possible.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *cachedStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	now := time.Now()
+
+	if data, found := store.cache.get(sessionKey, now); found {
+		if data == nil {
+			return nil, nil
+		}
+
+		return NewSessionFromExistingData(data), nil
+	}
+
+	generation := store.cache.currentGeneration()
+
+	session, err := store.inner.SessionFindByKey(ctx, sessionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		if store.negativeTTL > 0 {
+			store.cache.set(sessionKey, nil, now.Add(store.negativeTTL), generation)
+		}
+
+		return nil, nil
+	}
+
+	expiresAt := now.Add(store.ttl)
+
+	if sessionExpiresAt := session.GetExpiresAtCarbon().StdTime(); sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+
+	store.cache.set(sessionKey, session.Data(), expiresAt, generation)
+
+	return session, nil
+}
+
+// SessionFlush flushes the buffered writes of the inner store
+func (store *cachedStore) SessionFlush(ctx context.Context) error {
+	return storeFlush(ctx, store.inner)
+}
+
+// SessionList returns a list of sessions matching the query, uncached
+func (store *cachedStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	return store.inner.SessionList(ctx, query)
+}
+
+// SessionListPage returns a page of sessions from the inner store, uncached
+func (store *cachedStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	return storeListPage(ctx, store.inner, query)
+}
+
+// SessionIterate iterates over the sessions of the inner store, uncached
+func (store *cachedStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return storeIterate(ctx, store.inner, query, fn)
+}
+
+// SessionStats returns statistics of the sessions of the inner store, uncached
+func (store *cachedStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return storeStats(ctx, store.inner, query)
+}
+
+// SessionPromote promotes a guest session and invalidates its old and new key
+func (store *cachedStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	if session != nil {
+		defer store.invalidateUserID(userID)              // evicted to make room for the session
+		defer store.cache.invalidateKey(session.GetKey()) // the old key
+		defer store.invalidateSession(session)
+	}
+
+	return storePromote(ctx, store.inner, session, userID, mergeStrategy)
+}
+
+// SessionSoftDelete soft deletes a session and invalidates it
+func (store *cachedStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session != nil {
+		defer store.invalidateSession(session)
+	}
+
+	return store.inner.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByID soft deletes a session by id and invalidates it
+func (store *cachedStore) SessionSoftDeleteByID(ctx context.Context, sessionID string) error {
+	defer store.cache.invalidateID(sessionID)
+
+	return store.inner.SessionSoftDeleteByID(ctx, sessionID)
+}
+
+// SessionSoftDeleteByUserID soft deletes the sessions of a user and invalidates them
+func (store *cachedStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	defer store.cache.invalidateUserID(userID)
+
+	return storeSoftDeleteByUserID(ctx, store.inner, userID, exceptSessionID)
+}
+
+// SessionUpdate updates a session and invalidates it, under its old and
+// new key, and the sessions of its user, see SessionCreate
+func (store *cachedStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session != nil {
+		defer store.invalidateUserID(session.GetUserID()) // evicted if the session moved to the user
+		defer store.invalidateSession(session)
+	}
+
+	return store.inner.SessionUpdate(ctx, session)
+}
+
+// SessionUpdateMany updates the sessions matching a query and empties
+// the cache, as the cached sessions cannot be matched against the query
+func (store *cachedStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	defer store.cache.invalidateAll()
+
+	return storeUpdateMany(ctx, store.inner, query, fields)
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, uncached
+func (store *cachedStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return storeFindByIDIncludingDeleted(ctx, store.inner, sessionID)
+}
+
+// SessionRestore restores a soft deleted session and invalidates it,
+// also under its key, which may be cached as not found
+func (store *cachedStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	defer store.cache.invalidateID(sessionID)
+
+	if err := storeRestore(ctx, store.inner, sessionID, options); err != nil {
+		return err
+	}
+
+	session, err := storeFindByIDIncludingDeleted(ctx, store.inner, sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	if session != nil {
+		store.invalidateSession(session)
+		store.invalidateUserID(session.GetUserID()) // evicted to make room for the session
+	}
+
+	return nil
+}
+
+// UserSessions returns the active sessions of a user, uncached
+func (store *cachedStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return storeUserSessions(ctx, store.inner, userID, currentSessionID)
+}
+
+// UserSessionRevoke revokes a session of a user and invalidates the user's sessions
+func (store *cachedStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	defer store.cache.invalidateUserID(userID)
+
+	return storeUserSessionRevoke(ctx, store.inner, userID, handle)
+}
+
+// PRIVATE METHODS ===========================================================
+
+// invalidateUserID removes the sessions of a user from the cache, if the
+// user id is set
+func (store *cachedStore) invalidateUserID(userID string) {
+	if userID != "" {
+		store.cache.invalidateUserID(userID)
+	}
+}
+
+// invalidateSession removes a session from the cache, both under the key
+// it was cached with and under its current key
+func (store *cachedStore) invalidateSession(session SessionInterface) {
+	store.cache.invalidateID(session.GetID())
+	store.cache.invalidateKey(session.GetKey())
+}
@@ -0,0 +1,313 @@
+package sessionstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingStore counts the lookups by key reaching the inner store
+type countingStore struct {
+	StoreInterface
+	findByKeyCount int
+}
+
+func (store *countingStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	store.findByKeyCount++
+	return store.StoreInterface.SessionFindByKey(ctx, sessionKey)
+}
+
+func initCachedStore(t *testing.T, opts CacheOptions) (*cachedStore, *countingStore) {
+	inner, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counting := &countingStore{StoreInterface: inner}
+
+	store, err := NewCachedStore(counting, opts)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return store, counting
+}
+
+func TestCachedStore_SessionFindByKeyIsCached(t *testing.T) {
+	store, counting := initCachedStore(t, CacheOptions{})
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1").SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if found == nil || found.GetID() != session.GetID() || found.GetValue() != "one" {
+			t.Fatal("unexpected session found by key:", found)
+		}
+
+		found.SetValue("modified without saving")
+	}
+
+	if counting.findByKeyCount != 1 {
+		t.Fatal("Expected 1 lookup in the inner store, found:", counting.findByKeyCount)
+	}
+}
+
+func TestCachedStore_InvalidationOnWrite(t *testing.T) {
+	store, counting := initCachedStore(t, CacheOptions{})
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1").SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := store.SessionFindByKey(ctx, session.GetKey()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	session.SetValue("two")
+
+	if err := store.SessionUpdate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "two" {
+		t.Fatal("Expected the updated session, found:", found)
+	}
+
+	if counting.findByKeyCount != 2 {
+		t.Fatal("Expected 2 lookups in the inner store, found:", counting.findByKeyCount)
+	}
+
+	if _, err := store.SessionSoftDeleteByUserID(ctx, "1", ""); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Soft deleted session MUST NOT be served from the cache")
+	}
+}
+
+func TestCachedStore_NegativeCaching(t *testing.T) {
+	store, counting := initCachedStore(t, CacheOptions{})
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1")
+
+	for i := 0; i < 2; i++ {
+		found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if found != nil {
+			t.Fatal("Expected no session, found:", found)
+		}
+	}
+
+	if counting.findByKeyCount != 1 {
+		t.Fatal("Expected 1 lookup in the inner store, found:", counting.findByKeyCount)
+	}
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("Created session MUST replace the cached absence of its key")
+	}
+}
+
+func TestCachedStore_NegativeCachingDisabled(t *testing.T) {
+	store, counting := initCachedStore(t, CacheOptions{NegativeTTL: -1})
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.SessionFindByKey(context.Background(), "unknown"); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if counting.findByKeyCount != 2 {
+		t.Fatal("Expected 2 lookups in the inner store, found:", counting.findByKeyCount)
+	}
+}
+
+func TestCachedStore_MaxEntries(t *testing.T) {
+	store, _ := initCachedStore(t, CacheOptions{MaxEntries: 2})
+
+	for _, key := range []string{"one", "two", "three"} {
+		if _, err := store.SessionFindByKey(context.Background(), key); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if store.cache.len() != 2 {
+		t.Fatal("Expected 2 cached entries, found:", store.cache.len())
+	}
+
+	if _, found := store.cache.get("one", time.Now()); found {
+		t.Fatal("Least recently used entry MUST be evicted")
+	}
+}
+
+func TestCachedStore_InvalidationOnEviction(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	inner, err := NewStore(NewStoreOptions{
+		DB:                    db,
+		SessionTableName:      "session",
+		AutomigrateEnabled:    true,
+		MaxSessionsPerUser:    1,
+		SessionEvictionPolicy: EVICTION_POLICY_EVICT_OLDEST,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store, err := NewCachedStore(inner, CacheOptions{})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	oldest := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(ctx, oldest); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, err := store.SessionFindByKey(ctx, oldest.GetKey()); err != nil || found == nil {
+		t.Fatal("unexpected lookup:", found, err)
+	}
+
+	if err := store.SessionCreate(ctx, NewSession().SetUserID("1")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByKey(ctx, oldest.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("session evicted by the inner store MUST NOT be served from the cache")
+	}
+}
+
+func TestCachedStore_InnerWithoutOptionalInterfaces(t *testing.T) {
+	store, counting := initCachedStore(t, CacheOptions{})
+	ctx := context.Background()
+
+	if _, ok := StoreInterface(counting).(BulkStoreInterface); ok {
+		t.Fatal("inner store MUST implement StoreInterface only")
+	}
+
+	sessions := []SessionInterface{NewSession().SetUserID("1"), NewSession().SetUserID("1")}
+
+	if err := store.SessionCreateMany(ctx, sessions); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionFlush(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionSoftDeleteByID(ctx, sessions[0].GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionRestore(ctx, sessions[0].GetID(), SessionRestoreOptions{RestoredBy: "support"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	stats, err := store.SessionStats(ctx, StatsQuery{})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if stats.ActiveSessions != 2 {
+		t.Fatal("Expected 2 active sessions, found:", stats.ActiveSessions)
+	}
+
+	softDeleted, err := store.SessionSoftDeleteByUserID(ctx, "1", sessions[0].GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if softDeleted != 1 {
+		t.Fatal("Expected 1 soft deleted session, found:", softDeleted)
+	}
+
+	if _, err := store.UserSessions(ctx, "1", ""); err == nil {
+		t.Fatal("user sessions MUST fail without support by the inner store")
+	}
+
+	deleted, err := store.SessionDeleteByUserID(ctx, "1", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1 {
+		t.Fatal("Expected the 1 active session deleted, found:", deleted)
+	}
+
+	// promoted with an update moving the session to its new key, which
+	// the SQL store does not support, so over a bolt store
+	bolt := struct{ StoreInterface }{initBoltStore(t)}
+	guest := NewSession()
+
+	if err := bolt.SessionCreate(ctx, guest); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := storePromote(ctx, bolt, guest, "1", MERGE_STRATEGY_KEEP_GUEST); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, err := bolt.SessionFindByKey(ctx, guest.GetKey()); err != nil || found == nil || found.GetUserID() != "1" {
+		t.Fatal("Expected the promoted session, found:", found, "error:", err)
+	}
+}
@@ -0,0 +1,60 @@
+package sessionstore
+
+import (
+	"context"
+	"time"
+)
+
+// SessionChange describes a write to the sessions table, published so that
+// other instances can invalidate their caches
+type SessionChange struct {
+	// ID is the id of the change, sortable by time
+	ID string `json:"id"`
+
+	// Operation is one of the CHANGE_OPERATION_* constants. A
+	// CHANGE_OPERATION_RESET change means changes may have been missed,
+	// and everything cached must be dropped
+	Operation string `json:"operation"`
+
+	// SessionID is the changed session, empty if the change covers
+	// all the sessions of UserID
+	SessionID string `json:"session_id,omitempty"`
+
+	// UserID is the user the changed sessions belong to, if known
+	UserID string `json:"user_id,omitempty"`
+
+	// OccurredAt is the time of the change (UTC)
+	OccurredAt string `json:"occurred_at"`
+}
+
+// SessionChangeHandler is called for each change received by a subscriber
+type SessionChangeHandler func(ctx context.Context, change SessionChange)
+
+// NotificationListener receives Postgres notifications on a dedicated
+// connection, i.e. a thin wrapper around pgx's Conn.WaitForNotification
+// or lib/pq's Listener
+type NotificationListener interface {
+	// Listen starts listening on the channel
+	Listen(ctx context.Context, channel string) error
+
+	// WaitForNotification blocks until a notification arrives, and returns its payload
+	WaitForNotification(ctx context.Context) (payload string, err error)
+}
+
+// SessionChangesSubscribeOptions define the options for subscribing to session changes
+type SessionChangesSubscribeOptions struct {
+	// Handler is called for each change, required
+	Handler SessionChangeHandler
+
+	// Listener, if set, receives the changes via Postgres LISTEN/NOTIFY,
+	// otherwise the change log table is polled
+	Listener NotificationListener
+
+	// PollInterval is the interval between polls of the change log table, default 1 second
+	PollInterval time.Duration
+}
+
+// SessionChangeSubscriberInterface is implemented by stores publishing their changes
+type SessionChangeSubscriberInterface interface {
+	SessionChangesSubscribe(ctx context.Context, opts SessionChangesSubscribeOptions) error
+}
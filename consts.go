@@ -4,9 +4,61 @@ const COLUMN_CREATED_AT = "created_at"
 const COLUMN_EXPIRES_AT = "expires_at"
 const COLUMN_ID = "id"
 const COLUMN_IP_ADDRESS = "ip_address"
+const COLUMN_RESTORE_REASON = "restore_reason"
+const COLUMN_RESTORED_AT = "restored_at"
+const COLUMN_RESTORED_BY = "restored_by"
 const COLUMN_SESSION_KEY = "session_key"
 const COLUMN_SESSION_VALUE = "session_value"
 const COLUMN_SOFT_DELETED_AT = "soft_deleted_at"
+const COLUMN_TENANT_ID = "tenant_id"
 const COLUMN_UPDATED_AT = "updated_at"
 const COLUMN_USER_AGENT = "user_agent"
 const COLUMN_USER_ID = "user_id"
+
+const EVICTION_POLICY_REJECT = "reject"
+const EVICTION_POLICY_EVICT_OLDEST = "evict_oldest"
+const EVICTION_POLICY_EVICT_LEAST_RECENTLY_UPDATED = "evict_least_recently_updated"
+
+const SESSION_EVENT_REVOKED = "revoked"
+const SESSION_EVENT_RESTORED = "restored"
+
+const SESSION_PAGE_SIZE_DEFAULT = 100
+const SESSION_ITERATE_PAGE_SIZE_DEFAULT = 1000
+
+const STATS_PERIOD_HOUR = "hour"
+const STATS_PERIOD_DAY = "day"
+
+const DEVICE_TYPE_BOT = "bot"
+const DEVICE_TYPE_DESKTOP = "desktop"
+const DEVICE_TYPE_MOBILE = "mobile"
+const DEVICE_TYPE_TABLET = "tablet"
+const DEVICE_TYPE_UNKNOWN = "unknown"
+
+const BINDING_POLICY_EXACT = "exact"
+const BINDING_POLICY_NETWORK_PREFIX = "network_prefix"
+const BINDING_POLICY_USER_AGENT_FAMILY = "user_agent_family"
+const BINDING_POLICY_OFF = "off"
+
+const MERGE_STRATEGY_KEEP_GUEST = "keep_guest"
+const MERGE_STRATEGY_KEEP_USER = "keep_user"
+const MERGE_STRATEGY_DEEP_MERGE = "deep_merge"
+
+const CHANGE_OPERATION_CREATE = "create"
+const CHANGE_OPERATION_UPDATE = "update"
+const CHANGE_OPERATION_DELETE = "delete"
+const CHANGE_OPERATION_SOFT_DELETE = "soft_delete"
+const CHANGE_OPERATION_RESET = "reset"
+
+const COLUMN_OPERATION = "operation"
+const COLUMN_OCCURRED_AT = "occurred_at"
+const COLUMN_SESSION_ID = "session_id"
+
+const COLUMN_VERSION = "version"
+const COLUMN_NAME = "name"
+const COLUMN_APPLIED_AT = "applied_at"
+
+const TIER_WRITE_MODE_SYNC = "sync"
+const TIER_WRITE_MODE_ASYNC = "async"
+
+const TIER_CONSISTENCY_DURABLE_WINS = "durable_wins"
+const TIER_CONSISTENCY_HOT_WINS = "hot_wins"
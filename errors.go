@@ -0,0 +1,83 @@
+package sessionstore
+
+import "errors"
+
+// ErrMaxSessionsPerUserReached is returned when a user already holds the
+// maximum number of active sessions and the eviction policy is reject
+var ErrMaxSessionsPerUserReached = errors.New("sessionstore: maximum sessions per user reached")
+
+// ErrSessionNotFound is returned when a session targeted by an operation does not exist
+var ErrSessionNotFound = errors.New("sessionstore: session not found")
+
+// ErrSessionKeyExists is returned when the session key is taken by another
+// session, i.e. by Set when that session does not match the options, or
+// by the Redis store creating a session or changing its key
+var ErrSessionKeyExists = errors.New("sessionstore: session key already exists")
+
+// ErrUserSessionHandleSecretRequired is returned by UserSessions and
+// UserSessionRevoke when the store has no UserSessionHandleSecret
+var ErrUserSessionHandleSecretRequired = errors.New("sessionstore: user session handle secret is required")
+
+// ErrStopIteration is returned by the function passed to SessionIterate
+// to stop the iteration, SessionIterate then returns nil
+var ErrStopIteration = errors.New("sessionstore: stop iteration")
+
+// ErrBindingMismatch is returned when a session is found, but the
+// request does not match the IP address or user agent bound to it
+// according to the binding policy in the session options
+type ErrBindingMismatch struct {
+	// Policy is the binding policy that was violated
+	Policy string
+
+	// Field is the mismatched field, COLUMN_IP_ADDRESS or COLUMN_USER_AGENT
+	Field string
+
+	// Expected is the value bound to the session
+	Expected string
+
+	// Actual is the value supplied with the request
+	Actual string
+
+	// SessionID is the id of the session
+	SessionID string
+
+	// Revoked is true if the session was revoked because of the mismatch
+	Revoked bool
+}
+
+// Error returns the error message
+func (e *ErrBindingMismatch) Error() string {
+	return "sessionstore: session binding mismatch (policy: " + e.Policy + ", field: " + e.Field + ")"
+}
+
+// ErrInvalidSort is returned when a session query sorts on a column which
+// is not a column of the sessions, or in an order other than ascending or
+// descending
+type ErrInvalidSort struct {
+	// Column is the sort column
+	Column string
+
+	// Order is the sort order
+	Order string
+}
+
+// Error returns the error message
+func (e *ErrInvalidSort) Error() string {
+	return "sessionstore: invalid sort (column: " + e.Column + ", order: " + e.Order + ")"
+}
+
+// ErrColumnNotLoaded is returned when a partial session, loaded with a
+// subset of the columns, is updated without the column identifying it,
+// or with a change to a column which was not loaded
+type ErrColumnNotLoaded struct {
+	// Column is the column not loaded
+	Column string
+
+	// SessionID is the id of the session, empty if not loaded
+	SessionID string
+}
+
+// Error returns the error message
+func (e *ErrColumnNotLoaded) Error() string {
+	return "sessionstore: column not loaded in the partial session (column: " + e.Column + ")"
+}
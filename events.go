@@ -0,0 +1,28 @@
+package sessionstore
+
+import "context"
+
+// SessionEvent describes a change to one or more sessions
+type SessionEvent struct {
+	// Type is the type of the event, i.e. SESSION_EVENT_REVOKED
+	Type string
+
+	// SessionID is the affected session, empty if the event covers
+	// all the sessions of UserID
+	SessionID string
+
+	// UserID is the user the affected sessions belong to, if known
+	UserID string
+
+	// ExceptSessionID is the session of UserID left untouched, if any
+	ExceptSessionID string
+
+	// Count is the number of affected sessions
+	Count int64
+
+	// OccurredAt is the time of the event (UTC)
+	OccurredAt string
+}
+
+// SessionEventHandler is called after a session event has occurred
+type SessionEventHandler func(ctx context.Context, event SessionEvent)
@@ -0,0 +1,18 @@
+//go:build plan9 || solaris || aix
+
+package sessionstore
+
+import (
+	"errors"
+	"os"
+)
+
+// fileLock is not supported on this platform
+func fileLock(file *os.File, exclusive bool) error {
+	return errors.New("file session store: file locking is not supported on this platform")
+}
+
+// fileUnlock is not supported on this platform
+func fileUnlock(file *os.File) error {
+	return nil
+}
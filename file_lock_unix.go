@@ -0,0 +1,31 @@
+//go:build !windows && !plan9 && !solaris && !aix
+
+package sessionstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLock blocks until it acquires an advisory lock on the file,
+// shared or exclusive
+func fileLock(file *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// fileUnlock releases the lock on the file
+func fileUnlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package sessionstore
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileLock blocks until it acquires a lock on the first byte of the
+// file, shared or exclusive
+func fileLock(file *os.File, exclusive bool) error {
+	flags := uint32(0)
+
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+}
+
+// fileUnlock releases the lock on the file
+func fileUnlock(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
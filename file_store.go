@@ -0,0 +1,1322 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*fileStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*fileStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*fileStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*fileStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*fileStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*fileStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*fileStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*fileStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*fileStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// fileStore defines a session store backed by plain files in a directory,
+// for local development and tiny deployments.
+//
+// Layout of the directory:
+//   - sessions/<session id>.json - the session data (JSON), one file per session
+//   - index.json - session key => session id, user id => session ids, and
+//     created_at + NUL + session id, sorted, the order of the pages
+//   - .lock - locked for every operation, shared for reads, exclusive for writes
+//
+// Every file is written to a temporary file first and renamed over the
+// target, so readers never see a partially written file. The lock is an
+// OS file lock, several processes may share the same directory.
+//
+// The index is rebuilt from the session files if it is missing, i.e. it
+// can be deleted safely while no process is using the directory.
+type fileStore struct {
+	dir          string
+	debugEnabled bool
+	logger       *slog.Logger
+
+	userSessionHandleSecret []byte // keys the user session handles, kept in the directory
+}
+
+// fileStoreIndex defines the lookup index of a file store
+type fileStoreIndex struct {
+	Keys    map[string]string   `json:"keys"`
+	Users   map[string][]string `json:"users"`
+	Created []string            `json:"created"`
+
+	rebuilt bool // rebuilt from the session files, not yet written
+}
+
+// fileStoreIDRegex matches the session ids safe to use as file names
+var fileStoreIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// == CONSTRUCTOR =============================================================
+
+// NewFileStore creates a new file system session store, creating the
+// directory if it does not exist
+//
+// Parameters:
+//   - dir - the directory to keep the sessions in
+//
+// Returns:
+//   - *fileStore - the store
+//   - error - nil if successful, otherwise an error
+func NewFileStore(dir string) (*fileStore, error) {
+	if dir == "" {
+		return nil, errors.New("file session store: dir is required")
+	}
+
+	store := &fileStore{
+		dir:    dir,
+		logger: slog.Default(),
+	}
+
+	if err := store.AutoMigrate(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate creates the directories and the index if they do not exist
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) AutoMigrate(ctx context.Context) error {
+	if err := os.MkdirAll(store.sessionsDir(), 0700); err != nil {
+		return err
+	}
+
+	return store.withLock(true, func() error {
+		if err := store.secretLoad(); err != nil {
+			return err
+		}
+
+		index, err := store.indexRead()
+
+		if err != nil || !index.rebuilt {
+			return err
+		}
+
+		return store.indexWrite(index)
+	})
+}
+
+// EnableDebug enables the debug mode
+//
+// # If debug mode is enabled, it will log the operations to the logger
+//
+// Parameters:
+//   - debug - true to enable, false to disable
+func (store *fileStore) EnableDebug(debug bool) {
+	store.debugEnabled = debug
+}
+
+// SessionExpiryGoroutine runs periodically (every minute) and deletes
+// the files of the sessions that have expired
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionExpiryGoroutine() error {
+	for {
+		if _, err := store.deleteExpired(); err != nil {
+			store.logger.Error("File Session Store. SessionExpiryGoroutine", slog.String("error", err.Error()))
+		}
+
+		time.Sleep(60 * time.Second) // Every minute
+	}
+}
+
+// SessionCount returns the count of sessions matching the query.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - int64 - the count of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	if query == nil {
+		return -1, errors.New("file session store > session count. query cannot be nil")
+	}
+
+	query.SetCountOnly(true)
+
+	list, err := store.SessionList(ctx, query)
+
+	if err != nil {
+		return -1, err
+	}
+
+	return int64(len(list)), nil
+}
+
+// SessionCreate creates a new session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("file session store > session create. session cannot be nil")
+	}
+
+	if session.GetKey() == "" {
+		return errors.New("file session store > session create. key cannot be empty")
+	}
+
+	if session.GetExpiresAt() == "" {
+		return errors.New("file session store > session create. expires at cannot be empty")
+	}
+
+	if !fileStoreIDRegex.MatchString(session.GetID()) {
+		return errors.New("file session store > session create. id contains invalid characters")
+	}
+
+	if session.GetCreatedAt() == "" {
+		session.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetUpdatedAt() == "" {
+		session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetSoftDeletedAt() == "" {
+		session.SetSoftDeletedAt(sb.MAX_DATETIME)
+	}
+
+	store.logOperation("create", session.GetID())
+
+	err := store.withIndexUpdate(func(index *fileStoreIndex) error {
+		if _, exists := index.Keys[session.GetKey()]; exists {
+			return errors.New("file session store > session create. session key already exists")
+		}
+
+		if fileExists(store.sessionPath(session.GetID())) {
+			return errors.New("file session store > session create. session id already exists")
+		}
+
+		return store.put(index, nil, session.Data())
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionCreateMany creates sessions one at a time, stopping at the
+// first error, the sessions created before it are kept
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	return sessionCreateEach(ctx, store.SessionCreate, sessions)
+}
+
+// SessionDelete deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	return store.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionDeleteByID deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionDeleteByID(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("session id is empty")
+	}
+
+	store.logOperation("delete", id)
+
+	return store.withIndexUpdate(func(index *fileStoreIndex) error {
+		_, err := store.delete(index, id)
+		return err
+	})
+}
+
+// SessionDeleteByUserID deletes all the sessions of a user, i.e. to log
+// the user out everywhere.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("file session store > session delete by user id. user id cannot be empty")
+	}
+
+	store.logOperation("delete by user id", userID)
+
+	deleted := int64(0)
+
+	err := store.withIndexUpdate(func(index *fileStoreIndex) error {
+		for _, id := range lo.Without(index.Users[userID], exceptSessionID) {
+			existed, err := store.delete(index, id)
+
+			if err != nil {
+				return err
+			}
+
+			if existed {
+				deleted++
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// SessionDeleteMany deletes the sessions matching the filters of a
+// query one at a time, see store.SessionDeleteMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return sessionDeleteEach(ctx, store, query)
+}
+
+// SessionExtend extends a session's expiry time by the given seconds.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to extend
+//   - seconds - the number of seconds to extend the session by
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	expiresAt := carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC)
+
+	session.SetExpiresAt(expiresAt)
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionFindByID finds a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	if sessionID == "" {
+		return nil, errors.New("file session store > find by id: session id is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetID(sessionID).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFindByKey finds a session by key.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	if sessionKey == "" {
+		return nil, errors.New("file session store > find by key: session key is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetKey(sessionKey).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFlush does nothing, every write goes to the files directly
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - always nil
+func (store *fileStore) SessionFlush(ctx context.Context) error {
+	return nil
+}
+
+// SessionList returns a list of sessions matching the query.
+//
+// The candidates are looked up in the index by key or user id, or read
+// by id, otherwise all the session files are read. The remaining
+// filters, ordering and pagination are applied in memory.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - []SessionInterface - list of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	if query == nil {
+		return []SessionInterface{}, errors.New("file session store > session list. query cannot be nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return []SessionInterface{}, err
+	}
+
+	candidates := []SessionInterface{}
+
+	err := store.withLock(false, func() error {
+		var ids []string
+
+		switch {
+		case query.HasKey():
+			index, err := store.indexRead()
+
+			if err != nil {
+				return err
+			}
+
+			if id, ok := index.Keys[query.Key()]; ok {
+				ids = []string{id}
+			}
+		case query.HasID():
+			ids = []string{query.ID()}
+		case query.HasIDIn():
+			ids = query.IDIn()
+		case query.HasUserID():
+			index, err := store.indexRead()
+
+			if err != nil {
+				return err
+			}
+
+			ids = index.Users[query.UserID()]
+		case query.HasKeyIn():
+			index, err := store.indexRead()
+
+			if err != nil {
+				return err
+			}
+
+			for _, key := range lo.Uniq(query.KeyIn()) {
+				if id, ok := index.Keys[key]; ok {
+					ids = append(ids, id)
+				}
+			}
+		case query.HasUserIDIn():
+			index, err := store.indexRead()
+
+			if err != nil {
+				return err
+			}
+
+			for _, userID := range lo.Uniq(query.UserIDIn()) {
+				ids = append(ids, index.Users[userID]...)
+			}
+		default:
+			all, err := store.scan()
+
+			if err != nil {
+				return err
+			}
+
+			for _, data := range all {
+				candidates = append(candidates, NewSessionFromExistingData(data))
+			}
+
+			return nil
+		}
+
+		for _, id := range ids {
+			data, err := store.get(id)
+
+			if err != nil {
+				return err
+			}
+
+			if data != nil {
+				candidates = append(candidates, NewSessionFromExistingData(data))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	return sessionsApplyQuery(candidates, query), nil
+}
+
+// SessionListPage returns a page of the sessions matching the query, and
+// the cursor of the next page, see store.SessionListPage. The session
+// files are read in the created order of the index, from the cursor on,
+// up to the end of the page, unless the query looks the sessions up by
+// key, id or user, as SessionList.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 100)
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	limit, err := sessionPageLimit(query)
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	if sessionQueryHasLookup(query) {
+		return sessionListPage(ctx, store.SessionList, query)
+	}
+
+	sessions := []SessionInterface{}
+	cursor := ""
+
+	err = store.withLock(false, func() error {
+		index, err := store.indexRead()
+
+		if err != nil {
+			return err
+		}
+
+		sessions, cursor, err = sessionIndexPage(query, limit, store.createdWalk(index, query))
+
+		return err
+	})
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	return sessions, cursor, nil
+}
+
+// SessionIterate calls fn for each session matching the query, a page
+// at a time, see store.SessionIterate
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 1000)
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *fileStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return sessionIterate(ctx, store.SessionListPage, query, fn)
+}
+
+// SessionStats returns statistics of the sessions, see store.SessionStats.
+// They are computed in memory, iterating over the sessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return sessionStatsIterate(ctx, store.SessionIterate, query)
+}
+
+// SessionPromote upgrades a guest session to an authenticated one,
+// merging the value of the user's most recent session and regenerating
+// the session key.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	return sessionPromoteByUpdate(ctx, store, session, userID, mergeStrategy)
+}
+
+// SessionSoftDelete soft deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to soft delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	session.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionSoftDeleteByID soft deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionSoftDeleteByID(ctx context.Context, id string) error {
+	session, err := store.SessionFindByID(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user,
+// i.e. on password reset.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("file session store > session soft delete by user id. user id cannot be empty")
+	}
+
+	store.logOperation("soft delete by user id", userID)
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	softDeleted := int64(0)
+
+	err := store.withIndexUpdate(func(index *fileStoreIndex) error {
+		for _, id := range lo.Without(index.Users[userID], exceptSessionID) {
+			current, err := store.get(id)
+
+			if err != nil {
+				return err
+			}
+
+			if current == nil || current[COLUMN_SOFT_DELETED_AT] <= now {
+				continue
+			}
+
+			err = store.put(index, current, map[string]string{
+				COLUMN_SOFT_DELETED_AT: now,
+				COLUMN_UPDATED_AT:      now,
+			})
+
+			if err != nil {
+				return err
+			}
+
+			softDeleted++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return softDeleted, nil
+}
+
+// SessionUpdate updates the changed fields of a session, including its key.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to update
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("file session store > session update. session cannot be nil")
+	}
+
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	dataChanged := session.DataChanged()
+
+	if len(dataChanged) == 0 {
+		return nil
+	}
+
+	dataChanged[COLUMN_ID] = session.GetID() // ID cannot be updated, identifies the session
+
+	store.logOperation("update", session.GetID())
+
+	err := store.withIndexUpdate(func(index *fileStoreIndex) error {
+		current, err := store.get(session.GetID())
+
+		if err != nil {
+			return err
+		}
+
+		if current == nil {
+			return nil // nothing to update, as with SQL
+		}
+
+		if key, changed := dataChanged[COLUMN_SESSION_KEY]; changed && key != current[COLUMN_SESSION_KEY] {
+			if _, exists := index.Keys[key]; exists {
+				return errors.New("file session store > session update. session key already exists")
+			}
+		}
+
+		return store.put(index, current, dataChanged)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionUpdateMany sets the fields of the sessions matching the filters
+// of a query one at a time, see store.SessionUpdateMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	return sessionUpdateEach(ctx, store, query, fields)
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, see store.SessionFindByIDIncludingDeleted
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return sessionFindByIDIncludingDeleted(ctx, store.SessionList, sessionID)
+}
+
+// SessionRestore restores a soft deleted session, and records who
+// restored it, when and why, see store.SessionRestore
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func (store *fileStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	session, err := sessionRestorePrepare(ctx, store, sessionID, options)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// UserSessions returns the active sessions of a user, most recently
+// seen first, i.e. for a "Where you're logged in" page.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *fileStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	_, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+	return err
+}
+
+// PRIVATE METHODS ===========================================================
+
+// deleteExpired deletes the files of the sessions which have expired
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) deleteExpired() (int64, error) {
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	deleted := int64(0)
+
+	store.logOperation("delete expired", now)
+
+	err := store.withIndexUpdate(func(index *fileStoreIndex) error {
+		all, err := store.scan()
+
+		if err != nil {
+			return err
+		}
+
+		for _, data := range all {
+			if data[COLUMN_EXPIRES_AT] >= now {
+				continue
+			}
+
+			if _, err := store.delete(index, data[COLUMN_ID]); err != nil {
+				return err
+			}
+
+			deleted++
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
+
+// get returns the data of a session by id, nil if it does not exist
+func (store *fileStore) get(id string) (map[string]string, error) {
+	if !fileStoreIDRegex.MatchString(id) {
+		return nil, nil // cannot exist, never read outside the directory
+	}
+
+	raw, err := os.ReadFile(store.sessionPath(id))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{}
+
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// put writes the changed data over the current data of a session
+// (nil for a new session), keeping the index in sync
+func (store *fileStore) put(index *fileStoreIndex, current map[string]string, changed map[string]string) error {
+	if current == nil {
+		current = map[string]string{}
+	}
+
+	data := lo.Assign(current, changed)
+	id := data[COLUMN_ID]
+
+	raw, err := json.Marshal(data)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fileWriteAtomic(store.sessionPath(id), raw); err != nil {
+		return err
+	}
+
+	if old, ok := current[COLUMN_SESSION_KEY]; ok && old != data[COLUMN_SESSION_KEY] {
+		delete(index.Keys, old)
+	}
+
+	index.Keys[data[COLUMN_SESSION_KEY]] = id
+
+	if old, ok := current[COLUMN_USER_ID]; ok && old != data[COLUMN_USER_ID] {
+		index.userRemove(old, id)
+	}
+
+	index.userAdd(data[COLUMN_USER_ID], id)
+
+	if old, ok := current[COLUMN_CREATED_AT]; ok && old != data[COLUMN_CREATED_AT] {
+		index.createdRemove(old, id)
+	}
+
+	index.createdAdd(data[COLUMN_CREATED_AT], id)
+
+	return nil
+}
+
+// delete deletes the file of a session and its index entries by id
+//
+// Returns:
+//   - bool - true if the session existed
+//   - error - nil if successful, otherwise an error
+func (store *fileStore) delete(index *fileStoreIndex, id string) (bool, error) {
+	current, err := store.get(id)
+
+	if err != nil || current == nil {
+		return false, err
+	}
+
+	if err := os.Remove(store.sessionPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	delete(index.Keys, current[COLUMN_SESSION_KEY])
+	index.userRemove(current[COLUMN_USER_ID], id)
+	index.createdRemove(current[COLUMN_CREATED_AT], id)
+
+	return true, nil
+}
+
+// scan reads the data of all the sessions
+func (store *fileStore) scan() ([]map[string]string, error) {
+	entries, err := os.ReadDir(store.sessionsDir())
+
+	if err != nil {
+		return nil, err
+	}
+
+	all := []map[string]string{}
+
+	for _, entry := range entries {
+		id, isSession := strings.CutSuffix(entry.Name(), ".json")
+
+		if entry.IsDir() || !isSession {
+			continue // i.e. a temporary file of an unfinished write
+		}
+
+		data, err := store.get(id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			all = append(all, data)
+		}
+	}
+
+	return all, nil
+}
+
+// indexRead reads the index, rebuilding it from the session files if
+// it does not exist, or was written by a version without the created list
+func (store *fileStore) indexRead() (*fileStoreIndex, error) {
+	raw, err := os.ReadFile(store.indexPath())
+
+	if errors.Is(err, os.ErrNotExist) {
+		return store.indexRebuild()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := &fileStoreIndex{}
+
+	if err := json.Unmarshal(raw, index); err != nil {
+		return nil, err
+	}
+
+	if index.Keys == nil {
+		index.Keys = map[string]string{}
+	}
+
+	if index.Users == nil {
+		index.Users = map[string][]string{}
+	}
+
+	if index.Created == nil {
+		return store.indexRebuild()
+	}
+
+	return index, nil
+}
+
+// indexRebuild builds the index from the session files
+func (store *fileStore) indexRebuild() (*fileStoreIndex, error) {
+	all, err := store.scan()
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := &fileStoreIndex{
+		Keys:    map[string]string{},
+		Users:   map[string][]string{},
+		Created: []string{},
+		rebuilt: true,
+	}
+
+	for _, data := range all {
+		index.Keys[data[COLUMN_SESSION_KEY]] = data[COLUMN_ID]
+		index.userAdd(data[COLUMN_USER_ID], data[COLUMN_ID])
+		index.createdAdd(data[COLUMN_CREATED_AT], data[COLUMN_ID])
+	}
+
+	return index, nil
+}
+
+// indexWrite writes the index
+func (store *fileStore) indexWrite(index *fileStoreIndex) error {
+	raw, err := json.Marshal(index)
+
+	if err != nil {
+		return err
+	}
+
+	return fileWriteAtomic(store.indexPath(), raw)
+}
+
+// withIndexUpdate runs fn holding the exclusive lock, and writes the
+// index modified by fn, even if fn failed part way through
+func (store *fileStore) withIndexUpdate(fn func(index *fileStoreIndex) error) error {
+	return store.withLock(true, func() error {
+		index, err := store.indexRead()
+
+		if err != nil {
+			return err
+		}
+
+		errFn := fn(index)
+
+		if err := store.indexWrite(index); err != nil {
+			return err
+		}
+
+		return errFn
+	})
+}
+
+// withLock runs fn holding the lock of the directory
+//
+// Parameters:
+//   - exclusive - true to write, false to read
+//   - fn - the function to run
+//
+// Returns:
+//   - error - the error of fn, or of acquiring the lock
+func (store *fileStore) withLock(exclusive bool, fn func() error) error {
+	lockFile, err := os.OpenFile(filepath.Join(store.dir, ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	defer lockFile.Close()
+
+	if err := fileLock(lockFile, exclusive); err != nil {
+		return err
+	}
+
+	defer fileUnlock(lockFile)
+
+	return fn()
+}
+
+// sessionsDir returns the directory of the session files
+func (store *fileStore) sessionsDir() string {
+	return filepath.Join(store.dir, "sessions")
+}
+
+// sessionPath returns the path of the file of a session
+func (store *fileStore) sessionPath(id string) string {
+	return filepath.Join(store.sessionsDir(), id+".json")
+}
+
+// indexPath returns the path of the index file
+func (store *fileStore) indexPath() string {
+	return filepath.Join(store.dir, "index.json")
+}
+
+// secretPath returns the path of the secret keying the user session
+// handles, shared by the processes using the directory
+func (store *fileStore) secretPath() string {
+	return filepath.Join(store.dir, "secret")
+}
+
+// secretLoad loads the secret keying the user session handles, creating
+// it if it does not exist. Must be called with the lock held.
+func (store *fileStore) secretLoad() error {
+	if !fileExists(store.secretPath()) {
+		if err := fileWriteAtomic(store.secretPath(), userSessionHandleSecretRandom()); err != nil {
+			return err
+		}
+	}
+
+	secret, err := os.ReadFile(store.secretPath())
+
+	if err != nil {
+		return err
+	}
+
+	store.userSessionHandleSecret = secret
+
+	return nil
+}
+
+// logOperation logs the operation if debug is enabled
+func (store *fileStore) logOperation(operation string, subject string) {
+	if !store.debugEnabled {
+		return
+	}
+
+	store.logger.Debug("file: "+operation, slog.String("subject", subject))
+}
+
+// userAdd adds a session to the sessions of a user
+func (index *fileStoreIndex) userAdd(userID string, id string) {
+	if userID == "" || lo.Contains(index.Users[userID], id) {
+		return
+	}
+
+	index.Users[userID] = append(index.Users[userID], id)
+}
+
+// userRemove removes a session from the sessions of a user
+func (index *fileStoreIndex) userRemove(userID string, id string) {
+	ids := lo.Without(index.Users[userID], id)
+
+	if len(ids) == 0 {
+		delete(index.Users, userID)
+		return
+	}
+
+	index.Users[userID] = ids
+}
+
+// createdWalk returns a function returning the sessions of the created
+// list one at a time, in the keyset order of the query, from its cursor
+// to its created_at bound, nil after the last one
+func (store *fileStore) createdWalk(index *fileStoreIndex, query SessionQueryInterface) func() (SessionInterface, error) {
+	ascending := sessionQueryAscending(query)
+	step := lo.Ternary(ascending, 1, -1)
+
+	var i int
+
+	switch {
+	case query.HasCursor():
+		position, _ := sessionCursorDecode(query.Cursor())
+		var found bool
+		i, found = slices.BinarySearch(index.Created, fileStoreCreatedKey(position.CreatedAt, position.ID))
+
+		if ascending && found {
+			i++ // the last session of the previous page
+		} else if !ascending {
+			i-- // the entries before the cursor
+		}
+	case ascending && query.HasCreatedAtGte():
+		i, _ = slices.BinarySearch(index.Created, query.CreatedAtGte())
+	case ascending:
+		i = 0
+	case query.HasCreatedAtLte():
+		i, _ = slices.BinarySearch(index.Created, fileStoreCreatedKey(query.CreatedAtLte(), "\xff"))
+		i--
+	default:
+		i = len(index.Created) - 1
+	}
+
+	return func() (SessionInterface, error) {
+		for i >= 0 && i < len(index.Created) {
+			createdAt, id, _ := strings.Cut(index.Created[i], "\x00")
+
+			if ascending && query.HasCreatedAtLte() && createdAt > query.CreatedAtLte() {
+				break
+			}
+
+			if !ascending && query.HasCreatedAtGte() && createdAt < query.CreatedAtGte() {
+				break
+			}
+
+			i += step
+
+			data, err := store.get(id)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if data != nil {
+				return NewSessionFromExistingData(data), nil
+			}
+		}
+
+		i = -1
+
+		return nil, nil
+	}
+}
+
+// createdAdd adds a session to the created list, in order
+func (index *fileStoreIndex) createdAdd(createdAt string, id string) {
+	if createdAt == "" {
+		return
+	}
+
+	key := fileStoreCreatedKey(createdAt, id)
+
+	if i, found := slices.BinarySearch(index.Created, key); !found {
+		index.Created = slices.Insert(index.Created, i, key)
+	}
+}
+
+// createdRemove removes a session from the created list
+func (index *fileStoreIndex) createdRemove(createdAt string, id string) {
+	if i, found := slices.BinarySearch(index.Created, fileStoreCreatedKey(createdAt, id)); found {
+		index.Created = slices.Delete(index.Created, i, i+1)
+	}
+}
+
+// fileStoreCreatedKey returns the entry of a session in the created list,
+// the creation time and the session id separated by NUL, so entries sort
+// by creation time, then id
+func fileStoreCreatedKey(createdAt string, id string) string {
+	return createdAt + "\x00" + id
+}
+
+// fileWriteAtomic writes a file via a temporary file in the same
+// directory, renamed over the target once synced to disk
+func fileWriteAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,234 @@
+package sessionstore
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/dromara/carbon/v2"
+)
+
+func initFileStore(t *testing.T, dir string) *fileStore {
+	store, err := NewFileStore(dir)
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	return store
+}
+
+func TestFileStore_SessionCreateAndFind(t *testing.T) {
+	store := initFileStore(t, t.TempDir())
+
+	session := NewSession().
+		SetUserID("1").
+		SetValue("one two three four")
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionCreate(context.Background(), NewSession().SetKey(session.GetKey())); err == nil {
+		t.Fatal("duplicate session key MUST be rejected")
+	}
+
+	found, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetID() != session.GetID() || found.GetValue() != "one two three four" {
+		t.Fatal("unexpected session found by key:", found)
+	}
+
+	found.SetValue("updated").SetKey(generateSessionKey(100)).SetUserID("2")
+
+	if err := store.SessionUpdate(context.Background(), found); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	oldKeyFound, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if oldKeyFound != nil {
+		t.Fatal("old key MUST NOT be valid anymore")
+	}
+
+	oldUserCount, err := store.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if oldUserCount != 0 {
+		t.Fatal("old user MUST NOT have sessions anymore, found:", oldUserCount)
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetUserID("2"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetValue() != "updated" {
+		t.Fatal("unexpected sessions of user 2:", list)
+	}
+
+	if found, _ := store.SessionFindByID(context.Background(), "../index"); found != nil {
+		t.Fatal("ids with path separators MUST NOT be read")
+	}
+}
+
+func TestFileStore_IndexRebuild(t *testing.T) {
+	dir := t.TempDir()
+	store := initFileStore(t, dir)
+
+	session := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := os.Remove(store.indexPath()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	reopened := initFileStore(t, dir)
+
+	if !fileExists(reopened.indexPath()) {
+		t.Fatal("index MUST be rebuilt")
+	}
+
+	found, err := reopened.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetID() != session.GetID() {
+		t.Fatal("session MUST be found by key after the index is rebuilt, found:", found)
+	}
+
+	count, err := reopened.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("session MUST be found by user after the index is rebuilt, found:", count)
+	}
+
+	// an index written before the created list
+	if err := os.WriteFile(store.indexPath(), []byte(`{"keys":{},"users":{}}`), 0600); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	reopened = initFileStore(t, dir)
+
+	index, err := reopened.indexRead()
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if index.rebuilt || len(index.Created) != 1 || len(index.Keys) != 1 {
+		t.Fatal("index without the created list MUST be rebuilt and written, got:", index)
+	}
+}
+
+func TestFileStore_SessionDeleteByUserIDAndExpiry(t *testing.T) {
+	store := initFileStore(t, t.TempDir())
+
+	current := NewSession().SetUserID("1")
+	other := NewSession().SetUserID("1")
+	expired := NewSession().SetUserID("2").
+		SetExpiresAt(carbon.Now(carbon.UTC).SubHour().ToDateTimeString(carbon.UTC))
+
+	for _, session := range []SessionInterface{current, other, expired} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	deleted, err := store.SessionDeleteByUserID(context.Background(), "1", current.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1 {
+		t.Fatal("expected 1 deleted session, got:", deleted)
+	}
+
+	if fileExists(store.sessionPath(other.GetID())) {
+		t.Fatal("file of the deleted session MUST be removed")
+	}
+
+	if !fileExists(store.sessionPath(current.GetID())) {
+		t.Fatal("file of the current session MUST be kept")
+	}
+
+	expiredDeleted, err := store.deleteExpired()
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if expiredDeleted != 1 || fileExists(store.sessionPath(expired.GetID())) {
+		t.Fatal("expired session MUST be swept, deleted:", expiredDeleted)
+	}
+
+	index, err := store.indexRead()
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, ok := index.Users["2"]; ok {
+		t.Fatal("swept session MUST be removed from the user index")
+	}
+}
+
+func TestFileStore_ConcurrentCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	// two stores on the same directory, as two processes would be
+	stores := []*fileStore{initFileStore(t, dir), initFileStore(t, dir)}
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(store *fileStore) {
+			defer wg.Done()
+
+			if err := store.SessionCreate(context.Background(), NewSession().SetUserID("1")); err != nil {
+				t.Error("unexpected error:", err)
+			}
+		}(stores[i%2])
+	}
+
+	wg.Wait()
+
+	count, err := stores[0].SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 20 {
+		t.Fatal("every session MUST be in the user index, found:", count)
+	}
+}
+
+func TestFileStore_SessionListPage(t *testing.T) {
+	assertSessionIndexPages(t, initFileStore(t, t.TempDir()))
+}
@@ -1,7 +1,12 @@
 package sessionstore
 
 import (
+	"context"
+	"errors"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/dracory/str"
 )
@@ -17,3 +22,68 @@ func fileExists(filePath string) bool {
 
 	return !os.IsNotExist(err)
 }
+
+// ipv4CIDRPatterns returns the textual patterns of the IPv4 addresses in
+// a CIDR range, so the range can be matched in SQL on the text column. A
+// pattern ending with a dot is a prefix, otherwise it is an address.
+//
+// A range not ending on an octet boundary yields up to 256 patterns, i.e.
+// "10.1.16.0/20" yields the prefixes "10.1.16." to "10.1.31.".
+func ipv4CIDRPatterns(cidr string) ([]string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+
+	if err != nil {
+		return nil, errors.New("is not a valid CIDR")
+	}
+
+	ip := network.IP.To4()
+
+	if ip == nil {
+		return nil, errors.New("must be an IPv4 range")
+	}
+
+	ones, _ := network.Mask.Size()
+
+	octet := 0 // the last octet fixed, at least partially, by the mask
+
+	if ones > 0 {
+		octet = (ones - 1) / 8
+	}
+
+	fixed := []string{}
+
+	for i := 0; i < octet; i++ {
+		fixed = append(fixed, strconv.Itoa(int(ip[i])))
+	}
+
+	count := 1 << (8*(octet+1) - ones)
+	patterns := []string{}
+
+	for value := int(ip[octet]); value < int(ip[octet])+count; value++ {
+		pattern := strings.Join(append(append([]string{}, fixed...), strconv.Itoa(value)), ".")
+
+		if octet < 3 {
+			pattern += "."
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// likeEscape escapes the wildcards of a LIKE pattern, with "!" as the
+// escape character, which has no special meaning in any of the dialects
+func likeEscape(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![").Replace(s)
+}
+
+// storeFlush writes the buffered writes of a store, if it implements
+// FlusherInterface
+func storeFlush(ctx context.Context, st StoreInterface) error {
+	if flusher, ok := st.(FlusherInterface); ok {
+		return flusher.SessionFlush(ctx)
+	}
+
+	return nil
+}
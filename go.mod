@@ -13,15 +13,22 @@ require (
 )
 
 require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 	golang.org/x/crypto v0.41.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 )
 
 require (
+	github.com/alicebob/miniredis/v2 v2.35.0
 	github.com/dracory/str v0.3.0
 	github.com/dromara/carbon/v2 v2.6.11
+	github.com/redis/go-redis/v9 v9.7.3
 	github.com/samber/lo v1.51.0
 	github.com/spf13/cast v1.9.2
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/sys v0.35.0
 )
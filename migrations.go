@@ -0,0 +1,37 @@
+package sessionstore
+
+import "context"
+
+// Migration describes a schema migration of the session table, and
+// whether it has been applied to the database
+type Migration struct {
+	// Version orders the migrations, they are applied in ascending order
+	Version int `json:"version"`
+
+	// Name describes the migration
+	Name string `json:"name"`
+
+	// Applied is true if the migration has been applied
+	Applied bool `json:"applied"`
+
+	// AppliedAt is the time the migration was applied (UTC), empty if not applied
+	AppliedAt string `json:"applied_at,omitempty"`
+}
+
+// MigratorInterface is implemented by stores with a versioned schema
+type MigratorInterface interface {
+	// Migrate applies the pending migrations
+	Migrate(ctx context.Context) error
+
+	// MigrateDryRun returns the SQL Migrate would run, without running it
+	MigrateDryRun(ctx context.Context) ([]string, error)
+
+	// MigrateDown reverts the applied migrations newer than the version
+	MigrateDown(ctx context.Context, version int) error
+
+	// MigrateDownDryRun returns the SQL MigrateDown would run, without running it
+	MigrateDownDryRun(ctx context.Context, version int) ([]string, error)
+
+	// MigrationStatus returns the known migrations, and whether they have been applied
+	MigrationStatus(ctx context.Context) ([]Migration, error)
+}
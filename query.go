@@ -1,6 +1,12 @@
 package sessionstore
 
-import "errors"
+import (
+	"errors"
+	"strings"
+
+	"github.com/dracory/sb"
+	"github.com/samber/lo"
+)
 
 type SessionQueryInterface interface {
 	Validate() error
@@ -26,6 +32,14 @@ type SessionQueryInterface interface {
 	ExpiresAtLte() string
 	SetExpiresAtLte(expiresAtLte string) SessionQueryInterface
 
+	HasUpdatedAtGte() bool
+	UpdatedAtGte() string
+	SetUpdatedAtGte(updatedAtGte string) SessionQueryInterface
+
+	HasUpdatedAtLte() bool
+	UpdatedAtLte() string
+	SetUpdatedAtLte(updatedAtLte string) SessionQueryInterface
+
 	HasID() bool
 	ID() string
 	SetID(id string) SessionQueryInterface
@@ -38,18 +52,50 @@ type SessionQueryInterface interface {
 	Key() string
 	SetKey(key string) SessionQueryInterface
 
+	HasKeyIn() bool
+	KeyIn() []string
+	SetKeyIn(keyIn []string) SessionQueryInterface
+
 	HasUserID() bool
 	UserID() string
 	SetUserID(userID string) SessionQueryInterface
 
+	HasUserIDIn() bool
+	UserIDIn() []string
+	SetUserIDIn(userIDIn []string) SessionQueryInterface
+
+	HasUserIDNotEmpty() bool
+	UserIDNotEmpty() bool
+	SetUserIDNotEmpty(userIDNotEmpty bool) SessionQueryInterface
+
+	HasTenantID() bool
+	TenantID() string
+	SetTenantID(tenantID string) SessionQueryInterface
+
+	HasMeta() bool
+	Meta() map[string]string
+	SetMeta(name string, value string) SessionQueryInterface
+
 	HasUserIpAddress() bool
 	UserIpAddress() string
 	SetUserIpAddress(userIpAddress string) SessionQueryInterface
 
+	HasUserIpAddressPrefix() bool
+	UserIpAddressPrefix() string
+	SetUserIpAddressPrefix(userIpAddressPrefix string) SessionQueryInterface
+
+	HasUserIpAddressCIDR() bool
+	UserIpAddressCIDR() string
+	SetUserIpAddressCIDR(userIpAddressCIDR string) SessionQueryInterface
+
 	HasUserAgent() bool
 	UserAgent() string
 	SetUserAgent(userAgent string) SessionQueryInterface
 
+	HasUserAgentContains() bool
+	UserAgentContains() string
+	SetUserAgentContains(userAgentContains string) SessionQueryInterface
+
 	HasOffset() bool
 	Offset() int
 	SetOffset(offset int) SessionQueryInterface
@@ -66,12 +112,37 @@ type SessionQueryInterface interface {
 	OrderBy() string
 	SetOrderBy(orderBy string) SessionQueryInterface
 
+	HasOrderByColumns() bool
+	OrderByColumns() []SortColumn
+	SetOrderByColumns(orderByColumns []SortColumn) SessionQueryInterface
+
 	HasCountOnly() bool
 	SetCountOnly(countOnly bool) SessionQueryInterface
 
+	HasCursor() bool
+	Cursor() string
+	SetCursor(cursor string) SessionQueryInterface
+
 	HasSoftDeletedIncluded() bool
 	SoftDeletedIncluded() bool
 	SetSoftDeletedIncluded(withSoftDeleted bool) SessionQueryInterface
+
+	HasSoftDeletedOnly() bool
+	SoftDeletedOnly() bool
+	SetSoftDeletedOnly(softDeletedOnly bool) SessionQueryInterface
+
+	HasExpiredOnly() bool
+	ExpiredOnly() bool
+	SetExpiredOnly(expiredOnly bool) SessionQueryInterface
+}
+
+// SortColumn is a column of a multi-column sort, see SetOrderByColumns
+type SortColumn struct {
+	// Column is the column to sort on
+	Column string
+
+	// Order is sb.ASC or sb.DESC, default descending
+	Order string
 }
 
 // SessionQuery is a shortcut version of NewSessionQuery to create a new query
@@ -109,6 +180,86 @@ func (q *sessionQuery) Validate() error {
 		return errors.New("Session query. id_in cannot be empty array")
 	}
 
+	if q.HasKeyIn() && len(q.KeyIn()) < 1 {
+		return errors.New("Session query. key_in cannot be empty array")
+	}
+
+	if q.HasUserIDIn() && len(q.UserIDIn()) < 1 {
+		return errors.New("Session query. user_id_in cannot be empty array")
+	}
+
+	if q.HasUpdatedAtGte() && q.UpdatedAtGte() == "" {
+		return errors.New("Session query. updated_at_gte cannot be empty")
+	}
+
+	if q.HasUpdatedAtLte() && q.UpdatedAtLte() == "" {
+		return errors.New("Session query. updated_at_lte cannot be empty")
+	}
+
+	if q.HasUserIpAddressPrefix() && q.UserIpAddressPrefix() == "" {
+		return errors.New("Session query. user_ip_address_prefix cannot be empty")
+	}
+
+	if q.HasUserIpAddressCIDR() {
+		if _, err := ipv4CIDRPatterns(q.UserIpAddressCIDR()); err != nil {
+			return errors.New("Session query. user_ip_address_cidr " + err.Error())
+		}
+	}
+
+	if q.HasUserAgentContains() && q.UserAgentContains() == "" {
+		return errors.New("Session query. user_agent_contains cannot be empty")
+	}
+
+	if q.SoftDeletedOnly() && q.HasSoftDeletedIncluded() && !q.SoftDeletedIncluded() {
+		return errors.New("Session query. soft_deleted_only cannot exclude the soft deleted sessions")
+	}
+
+	if q.HasSortOrder() && !sortOrderValid(q.SortOrder()) {
+		return &ErrInvalidSort{Column: q.OrderBy(), Order: q.SortOrder()}
+	}
+
+	if q.HasOrderBy() && q.OrderBy() != "" && !columnNameRegex.MatchString(q.OrderBy()) {
+		return &ErrInvalidSort{Column: q.OrderBy(), Order: q.SortOrder()}
+	}
+
+	if q.HasOrderByColumns() {
+		if len(q.OrderByColumns()) < 1 {
+			return errors.New("Session query. order_by_columns cannot be empty array")
+		}
+
+		if q.HasOrderBy() {
+			return errors.New("Session query. order_by cannot be combined with order_by_columns")
+		}
+
+		for _, sort := range q.OrderByColumns() {
+			if !columnNameRegex.MatchString(sort.Column) || !sortOrderValid(sort.Order) {
+				return &ErrInvalidSort{Column: sort.Column, Order: sort.Order}
+			}
+		}
+	}
+
+	if q.HasCursor() {
+		if _, err := sessionCursorDecode(q.Cursor()); err != nil {
+			return errors.New("Session query. cursor " + err.Error())
+		}
+
+		if q.HasOrderBy() && q.OrderBy() != "" && q.OrderBy() != COLUMN_CREATED_AT {
+			return errors.New("Session query. cursor can only be used with the created_at order")
+		}
+
+		if q.HasOffset() {
+			return errors.New("Session query. cursor cannot be used with an offset")
+		}
+
+		if q.HasOrderByColumns() {
+			return errors.New("Session query. cursor cannot be used with order_by_columns")
+		}
+	}
+
+	if q.HasMeta() && lo.HasKey(q.Meta(), "") {
+		return errors.New("Session query. meta name cannot be empty")
+	}
+
 	if q.HasLimit() && q.Limit() < 0 {
 		return errors.New("Session query. limit cannot be negative")
 	}
@@ -146,6 +297,21 @@ func (q *sessionQuery) SetCountOnly(countOnly bool) SessionQueryInterface {
 	return q
 }
 
+func (q *sessionQuery) HasCursor() bool {
+	return q.hasProperty("cursor")
+}
+
+func (q *sessionQuery) Cursor() string {
+	return q.properties["cursor"].(string)
+}
+
+// SetCursor continues the listing after the page the cursor was returned
+// with, see SessionListPage
+func (q *sessionQuery) SetCursor(cursor string) SessionQueryInterface {
+	q.properties["cursor"] = cursor
+	return q
+}
+
 func (q *sessionQuery) HasCreatedAtGte() bool {
 	return q.hasProperty("created_at_gte")
 }
@@ -198,6 +364,32 @@ func (q *sessionQuery) SetExpiresAtLte(expiresAtLte string) SessionQueryInterfac
 	return q
 }
 
+func (q *sessionQuery) HasUpdatedAtGte() bool {
+	return q.hasProperty("updated_at_gte")
+}
+
+func (q *sessionQuery) UpdatedAtGte() string {
+	return q.properties["updated_at_gte"].(string)
+}
+
+func (q *sessionQuery) SetUpdatedAtGte(updatedAtGte string) SessionQueryInterface {
+	q.properties["updated_at_gte"] = updatedAtGte
+	return q
+}
+
+func (q *sessionQuery) HasUpdatedAtLte() bool {
+	return q.hasProperty("updated_at_lte")
+}
+
+func (q *sessionQuery) UpdatedAtLte() string {
+	return q.properties["updated_at_lte"].(string)
+}
+
+func (q *sessionQuery) SetUpdatedAtLte(updatedAtLte string) SessionQueryInterface {
+	q.properties["updated_at_lte"] = updatedAtLte
+	return q
+}
+
 func (q *sessionQuery) HasID() bool {
 	return q.hasProperty("id")
 }
@@ -237,6 +429,19 @@ func (q *sessionQuery) SetKey(key string) SessionQueryInterface {
 	return q
 }
 
+func (q *sessionQuery) HasKeyIn() bool {
+	return q.hasProperty("key_in")
+}
+
+func (q *sessionQuery) KeyIn() []string {
+	return q.properties["key_in"].([]string)
+}
+
+func (q *sessionQuery) SetKeyIn(keyIn []string) SessionQueryInterface {
+	q.properties["key_in"] = keyIn
+	return q
+}
+
 func (q *sessionQuery) HasLimit() bool {
 	return q.hasProperty("limit")
 }
@@ -268,6 +473,10 @@ func (q *sessionQuery) HasOrderBy() bool {
 }
 
 func (q *sessionQuery) OrderBy() string {
+	if !q.hasProperty("order_by") {
+		return ""
+	}
+
 	return q.properties["order_by"].(string)
 }
 
@@ -276,6 +485,21 @@ func (q *sessionQuery) SetOrderBy(orderBy string) SessionQueryInterface {
 	return q
 }
 
+func (q *sessionQuery) HasOrderByColumns() bool {
+	return q.hasProperty("order_by_columns")
+}
+
+func (q *sessionQuery) OrderByColumns() []SortColumn {
+	return q.properties["order_by_columns"].([]SortColumn)
+}
+
+// SetOrderByColumns sorts on several columns, i.e. the user id ascending
+// then the update time descending. It replaces SetOrderBy and SetSortOrder.
+func (q *sessionQuery) SetOrderByColumns(orderByColumns []SortColumn) SessionQueryInterface {
+	q.properties["order_by_columns"] = orderByColumns
+	return q
+}
+
 func (q *sessionQuery) HasSoftDeletedIncluded() bool {
 	return q.hasProperty("soft_deleted_included")
 }
@@ -293,11 +517,43 @@ func (q *sessionQuery) SetSoftDeletedIncluded(softDeletedIncluded bool) SessionQ
 	return q
 }
 
+func (q *sessionQuery) HasSoftDeletedOnly() bool {
+	return q.hasProperty("soft_deleted_only")
+}
+
+// SoftDeletedOnly returns true if only the soft deleted sessions are requested
+func (q *sessionQuery) SoftDeletedOnly() bool {
+	return q.hasProperty("soft_deleted_only") && q.properties["soft_deleted_only"].(bool)
+}
+
+func (q *sessionQuery) SetSoftDeletedOnly(softDeletedOnly bool) SessionQueryInterface {
+	q.properties["soft_deleted_only"] = softDeletedOnly
+	return q
+}
+
+func (q *sessionQuery) HasExpiredOnly() bool {
+	return q.hasProperty("expired_only")
+}
+
+// ExpiredOnly returns true if only the expired sessions are requested
+func (q *sessionQuery) ExpiredOnly() bool {
+	return q.hasProperty("expired_only") && q.properties["expired_only"].(bool)
+}
+
+func (q *sessionQuery) SetExpiredOnly(expiredOnly bool) SessionQueryInterface {
+	q.properties["expired_only"] = expiredOnly
+	return q
+}
+
 func (q *sessionQuery) HasSortOrder() bool {
 	return q.hasProperty("sort_order")
 }
 
 func (q *sessionQuery) SortOrder() string {
+	if !q.hasProperty("sort_order") {
+		return ""
+	}
+
 	return q.properties["sort_order"].(string)
 }
 
@@ -319,6 +575,20 @@ func (q *sessionQuery) SetUserAgent(userAgent string) SessionQueryInterface {
 	return q
 }
 
+func (q *sessionQuery) HasUserAgentContains() bool {
+	return q.hasProperty("user_agent_contains")
+}
+
+func (q *sessionQuery) UserAgentContains() string {
+	return q.properties["user_agent_contains"].(string)
+}
+
+// SetUserAgentContains filters on a part of the user agent, case insensitive
+func (q *sessionQuery) SetUserAgentContains(userAgentContains string) SessionQueryInterface {
+	q.properties["user_agent_contains"] = userAgentContains
+	return q
+}
+
 func (q *sessionQuery) HasUserID() bool {
 	return q.hasProperty("user_id")
 }
@@ -332,6 +602,67 @@ func (q *sessionQuery) SetUserID(userID string) SessionQueryInterface {
 	return q
 }
 
+func (q *sessionQuery) HasUserIDIn() bool {
+	return q.hasProperty("user_id_in")
+}
+
+func (q *sessionQuery) UserIDIn() []string {
+	return q.properties["user_id_in"].([]string)
+}
+
+func (q *sessionQuery) SetUserIDIn(userIDIn []string) SessionQueryInterface {
+	q.properties["user_id_in"] = userIDIn
+	return q
+}
+
+func (q *sessionQuery) HasUserIDNotEmpty() bool {
+	return q.hasProperty("user_id_not_empty")
+}
+
+// UserIDNotEmpty returns true if only the sessions of users (not guests) are requested
+func (q *sessionQuery) UserIDNotEmpty() bool {
+	return q.hasProperty("user_id_not_empty") && q.properties["user_id_not_empty"].(bool)
+}
+
+func (q *sessionQuery) SetUserIDNotEmpty(userIDNotEmpty bool) SessionQueryInterface {
+	q.properties["user_id_not_empty"] = userIDNotEmpty
+	return q
+}
+
+func (q *sessionQuery) HasTenantID() bool {
+	return q.hasProperty("tenant_id")
+}
+
+func (q *sessionQuery) TenantID() string {
+	return q.properties["tenant_id"].(string)
+}
+
+func (q *sessionQuery) SetTenantID(tenantID string) SessionQueryInterface {
+	q.properties["tenant_id"] = tenantID
+	return q
+}
+
+func (q *sessionQuery) HasMeta() bool {
+	return q.hasProperty("meta")
+}
+
+func (q *sessionQuery) Meta() map[string]string {
+	if !q.hasProperty("meta") {
+		return map[string]string{}
+	}
+
+	return q.properties["meta"].(map[string]string)
+}
+
+// SetMeta filters on the value of a meta column, an empty value matches
+// the sessions without the meta value. Each call adds a filter.
+func (q *sessionQuery) SetMeta(name string, value string) SessionQueryInterface {
+	meta := lo.Assign(q.Meta())
+	meta[name] = value
+	q.properties["meta"] = meta
+	return q
+}
+
 func (q *sessionQuery) HasUserIpAddress() bool {
 	return q.hasProperty("user_ip_address")
 }
@@ -345,6 +676,53 @@ func (q *sessionQuery) SetUserIpAddress(userIpAddress string) SessionQueryInterf
 	return q
 }
 
+func (q *sessionQuery) HasUserIpAddressPrefix() bool {
+	return q.hasProperty("user_ip_address_prefix")
+}
+
+func (q *sessionQuery) UserIpAddressPrefix() string {
+	return q.properties["user_ip_address_prefix"].(string)
+}
+
+// SetUserIpAddressPrefix filters on the start of the IP address, i.e. "10.1."
+func (q *sessionQuery) SetUserIpAddressPrefix(userIpAddressPrefix string) SessionQueryInterface {
+	q.properties["user_ip_address_prefix"] = userIpAddressPrefix
+	return q
+}
+
+func (q *sessionQuery) HasUserIpAddressCIDR() bool {
+	return q.hasProperty("user_ip_address_cidr")
+}
+
+func (q *sessionQuery) UserIpAddressCIDR() string {
+	return q.properties["user_ip_address_cidr"].(string)
+}
+
+// SetUserIpAddressCIDR filters on an IPv4 range, i.e. "10.1.16.0/20",
+// use SetUserIpAddressPrefix for IPv6 addresses
+func (q *sessionQuery) SetUserIpAddressCIDR(userIpAddressCIDR string) SessionQueryInterface {
+	q.properties["user_ip_address_cidr"] = userIpAddressCIDR
+	return q
+}
+
+// sortOrderValid returns true if the sort order is ascending, descending
+// or empty (the default)
+func sortOrderValid(order string) bool {
+	return order == "" || strings.EqualFold(order, sb.ASC) || strings.EqualFold(order, sb.DESC)
+}
+
+// sessionQueryCopy returns a copy of the query, which can be changed
+// without changing the query of the caller
+func sessionQueryCopy(query SessionQueryInterface) SessionQueryInterface {
+	q, ok := query.(*sessionQuery)
+
+	if !ok {
+		return query // another implementation, used as is
+	}
+
+	return &sessionQuery{properties: lo.Assign(q.properties)}
+}
+
 func (q *sessionQuery) hasProperty(key string) bool {
 	_, ok := q.properties[key]
 	return ok
@@ -0,0 +1,330 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// sessionCursor is the position of a session in the keyset order of the
+// pages, the creation time then the id
+type sessionCursor struct {
+	CreatedAt string `json:"c"`
+	ID        string `json:"i"`
+}
+
+// sessionCursorEncode returns the opaque cursor of the page after a session
+//
+// Parameters:
+//   - session - the last session of a page
+//
+// Returns:
+//   - string - the cursor
+func sessionCursorEncode(session SessionInterface) string {
+	raw, _ := json.Marshal(sessionCursor{
+		CreatedAt: datetimeNormalize(session.GetCreatedAt()),
+		ID:        session.GetID(),
+	})
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sessionCursorDecode decodes an opaque cursor
+//
+// Parameters:
+//   - cursor - the cursor
+//
+// Returns:
+//   - sessionCursor - the position
+//   - error - nil if successful, otherwise an error
+func sessionCursorDecode(cursor string) (sessionCursor, error) {
+	position := sessionCursor{}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return position, errors.New("is not a valid cursor")
+	}
+
+	if err := json.Unmarshal(raw, &position); err != nil || position.CreatedAt == "" || position.ID == "" {
+		return position, errors.New("is not a valid cursor")
+	}
+
+	return position, nil
+}
+
+// sessionAfterCursor returns true if the session comes after the cursor
+// in the keyset order, descending unless the query sorts ascending
+func sessionAfterCursor(session SessionInterface, query SessionQueryInterface) bool {
+	position, err := sessionCursorDecode(query.Cursor())
+
+	if err != nil {
+		return false
+	}
+
+	createdAt := datetimeNormalize(session.GetCreatedAt())
+
+	if sessionQueryAscending(query) {
+		return createdAt > position.CreatedAt || (createdAt == position.CreatedAt && session.GetID() > position.ID)
+	}
+
+	return createdAt < position.CreatedAt || (createdAt == position.CreatedAt && session.GetID() < position.ID)
+}
+
+// datetimeNormalize returns a datetime in the "YYYY-MM-DD HH:MM:SS"
+// format, as some drivers return the datetime columns in other formats
+func datetimeNormalize(datetime string) string {
+	parsed := carbon.Parse(datetime, carbon.UTC)
+
+	if parsed.Error != nil || parsed.IsZero() {
+		return datetime
+	}
+
+	return parsed.ToDateTimeString(carbon.UTC)
+}
+
+// sessionListPage returns a page of sessions in the keyset order, and
+// the cursor of the next page, empty on the last page. The stores
+// implement SessionListPage with it, over their own list function,
+// which must honour the cursor of the query.
+//
+// Parameters:
+//   - ctx - the context
+//   - list - the list function of the store
+//   - query - the session query, the limit is the page size
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func sessionListPage(ctx context.Context, list func(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error), query SessionQueryInterface) ([]SessionInterface, string, error) {
+	limit, err := sessionPageLimit(query)
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	pageQuery := sessionQueryCopy(query).
+		SetOrderBy(COLUMN_CREATED_AT).
+		SetLimit(limit + 1) // one more, to know if there is a next page
+
+	if len(pageQuery.Columns()) > 0 {
+		pageQuery.SetColumns(lo.Uniq(append(append([]string{}, pageQuery.Columns()...), COLUMN_CREATED_AT, COLUMN_ID)))
+	}
+
+	sessions, err := list(ctx, pageQuery)
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	if len(sessions) <= limit {
+		return sessions, "", nil
+	}
+
+	sessions = sessions[:limit]
+
+	return sessions, sessionCursorEncode(sessions[limit-1]), nil
+}
+
+// sessionPageLimit validates the query of a page, and returns the page size.
+// The pages are in the keyset order, so the sorts of SetOrderByColumns,
+// which the cursor cannot follow, are rejected.
+//
+// Parameters:
+//   - query - the session query, the limit is the page size
+//
+// Returns:
+//   - int - the page size
+//   - error - nil if valid, otherwise an error
+func sessionPageLimit(query SessionQueryInterface) (int, error) {
+	if query == nil {
+		return 0, errors.New("at session list page > session query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+
+	if query.HasOffset() {
+		return 0, errors.New("at session list page > offset cannot be used with a cursor")
+	}
+
+	if query.HasOrderByColumns() {
+		sort := query.OrderByColumns()[0]
+		return 0, &ErrInvalidSort{Column: sort.Column, Order: sort.Order}
+	}
+
+	if query.HasLimit() && query.Limit() > 0 {
+		return query.Limit(), nil
+	}
+
+	return SESSION_PAGE_SIZE_DEFAULT, nil
+}
+
+// sessionQueryHasLookup returns true if the query looks the sessions up
+// by key, id or user, which the stores read from their own lookups,
+// rather than walking their index of the creation times
+func sessionQueryHasLookup(query SessionQueryInterface) bool {
+	return query.HasKey() ||
+		query.HasID() ||
+		query.HasIDIn() ||
+		query.HasKeyIn() ||
+		query.HasUserID() ||
+		query.HasUserIDIn()
+}
+
+// sessionIndexPage returns a page of the sessions matching the query, and
+// the cursor of the next page, empty on the last page. The stores with
+// an index of the creation times implement SessionListPage with it, next
+// walking the index in the keyset order from the cursor, so only the
+// sessions up to the end of the page are read, not all the sessions.
+//
+// Parameters:
+//   - query - the session query, validated
+//   - limit - the page size
+//   - next - returns the next session of the index, nil after the last one
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func sessionIndexPage(query SessionQueryInterface, limit int, next func() (SessionInterface, error)) ([]SessionInterface, string, error) {
+	sessions := []SessionInterface{}
+
+	for len(sessions) <= limit { // one more, to know if there is a next page
+		session, err := next()
+
+		if err != nil {
+			return []SessionInterface{}, "", err
+		}
+
+		if session == nil {
+			break
+		}
+
+		if sessionMatchesQuery(session, query) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	cursor := ""
+
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+		cursor = sessionCursorEncode(sessions[limit-1])
+	}
+
+	if len(query.Columns()) > 0 {
+		sessions = lo.Map(sessions, func(session SessionInterface, _ int) SessionInterface {
+			return newPartialSession(session.Data(), query.Columns())
+		})
+	}
+
+	return sessions, cursor, nil
+}
+
+// sessionIterate calls fn for each session matching the query, in the
+// keyset order, reading them a page at a time, so the memory used stays
+// constant. The stores implement SessionIterate with it.
+//
+// Parameters:
+//   - ctx - the context
+//   - listPage - the SessionListPage function of the store
+//   - query - the session query, the limit is the page size
+//   - fn - the function to call, ErrStopIteration stops without error
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func sessionIterate(ctx context.Context, listPage func(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error), query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	if query == nil {
+		return errors.New("at session iterate > session query is nil")
+	}
+
+	if fn == nil {
+		return errors.New("at session iterate > fn is nil")
+	}
+
+	pageQuery := sessionQueryCopy(query)
+
+	if !pageQuery.HasLimit() || pageQuery.Limit() <= 0 {
+		pageQuery.SetLimit(SESSION_ITERATE_PAGE_SIZE_DEFAULT)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		sessions, next, err := listPage(ctx, pageQuery)
+
+		if err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if err := fn(session); err != nil {
+				if errors.Is(err, ErrStopIteration) {
+					return nil
+				}
+
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		pageQuery.SetCursor(next)
+	}
+}
+
+// storeIterate calls fn for each session matching the query with
+// SessionIterate if the store implements PagingStoreInterface, otherwise
+// over a list of all the sessions matching the query
+func storeIterate(ctx context.Context, st StoreInterface, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	if paging, ok := st.(PagingStoreInterface); ok {
+		return paging.SessionIterate(ctx, query, fn)
+	}
+
+	if query == nil {
+		return errors.New("at session iterate > session query is nil")
+	}
+
+	if fn == nil {
+		return errors.New("at session iterate > fn is nil")
+	}
+
+	sessions, err := st.SessionList(ctx, query)
+
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if err := fn(session); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeListPage returns a page of sessions with SessionListPage, if the
+// store implements PagingStoreInterface
+func storeListPage(ctx context.Context, st StoreInterface, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	if paging, ok := st.(PagingStoreInterface); ok {
+		return paging.SessionListPage(ctx, query)
+	}
+
+	return nil, "", errors.New("session store: the store does not support paging")
+}
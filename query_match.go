@@ -0,0 +1,219 @@
+package sessionstore
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// sessionMatchesQuery returns true if the session satisfies the filters
+// of the query. It is the in-memory counterpart of sessionSelectQuery,
+// used by the stores which cannot filter in SQL.
+//
+// Datetimes are compared as strings, which is correct for the
+// "YYYY-MM-DD HH:MM:SS" format used throughout the package.
+//
+// Parameters:
+//   - session - the session
+//   - query - the session query
+//
+// Returns:
+//   - bool - true if the session matches
+func sessionMatchesQuery(session SessionInterface, query SessionQueryInterface) bool {
+	if query.HasCreatedAtGte() && session.GetCreatedAt() < query.CreatedAtGte() {
+		return false
+	}
+
+	if query.HasCreatedAtLte() && session.GetCreatedAt() > query.CreatedAtLte() {
+		return false
+	}
+
+	if query.HasExpiresAtGte() && session.GetExpiresAt() < query.ExpiresAtGte() {
+		return false
+	}
+
+	if query.HasExpiresAtLte() && session.GetExpiresAt() > query.ExpiresAtLte() {
+		return false
+	}
+
+	if query.HasUpdatedAtGte() && session.GetUpdatedAt() < query.UpdatedAtGte() {
+		return false
+	}
+
+	if query.HasUpdatedAtLte() && session.GetUpdatedAt() > query.UpdatedAtLte() {
+		return false
+	}
+
+	if query.HasID() && session.GetID() != query.ID() {
+		return false
+	}
+
+	if query.HasIDIn() && !lo.Contains(query.IDIn(), session.GetID()) {
+		return false
+	}
+
+	if query.HasKey() && session.GetKey() != query.Key() {
+		return false
+	}
+
+	if query.HasKeyIn() && !lo.Contains(query.KeyIn(), session.GetKey()) {
+		return false
+	}
+
+	if query.HasUserAgent() && session.GetUserAgent() != query.UserAgent() {
+		return false
+	}
+
+	if query.HasUserAgentContains() && !strings.Contains(strings.ToLower(session.GetUserAgent()), strings.ToLower(query.UserAgentContains())) {
+		return false
+	}
+
+	if query.HasUserID() && session.GetUserID() != query.UserID() {
+		return false
+	}
+
+	if query.HasUserIDIn() && !lo.Contains(query.UserIDIn(), session.GetUserID()) {
+		return false
+	}
+
+	if query.UserIDNotEmpty() && session.GetUserID() == "" {
+		return false
+	}
+
+	if query.HasTenantID() && session.GetTenantID() != query.TenantID() {
+		return false
+	}
+
+	if query.HasUserIpAddress() && session.GetIPAddress() != query.UserIpAddress() {
+		return false
+	}
+
+	if query.HasUserIpAddressPrefix() && !strings.HasPrefix(strings.ToLower(session.GetIPAddress()), strings.ToLower(query.UserIpAddressPrefix())) {
+		return false
+	}
+
+	if query.HasUserIpAddressCIDR() && !ipInCIDR(session.GetIPAddress(), query.UserIpAddressCIDR()) {
+		return false
+	}
+
+	for name, value := range query.Meta() {
+		if session.GetMeta(name) != value {
+			return false
+		}
+	}
+
+	if query.HasCursor() && !sessionAfterCursor(session, query) {
+		return false
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	if query.ExpiredOnly() && session.GetExpiresAt() >= now {
+		return false
+	}
+
+	if query.SoftDeletedOnly() && session.GetSoftDeletedAt() > now {
+		return false
+	}
+
+	if !query.SoftDeletedIncluded() && !query.SoftDeletedOnly() && session.GetSoftDeletedAt() <= now {
+		return false
+	}
+
+	return true
+}
+
+// sessionQueryAscending returns true if the query sorts in ascending
+// order, the default is descending
+func sessionQueryAscending(query SessionQueryInterface) bool {
+	return query.HasSortOrder() && strings.EqualFold(query.SortOrder(), sb.ASC)
+}
+
+// sessionQuerySorts returns the sort columns of the query, set with
+// SetOrderByColumns, or with SetOrderBy and SetSortOrder
+func sessionQuerySorts(query SessionQueryInterface) []SortColumn {
+	if query.HasOrderByColumns() {
+		return query.OrderByColumns()
+	}
+
+	if query.HasOrderBy() && query.OrderBy() != "" {
+		return []SortColumn{{
+			Column: query.OrderBy(),
+			Order:  lo.Ternary(sessionQueryAscending(query), sb.ASC, sb.DESC),
+		}}
+	}
+
+	return []SortColumn{}
+}
+
+// sessionsCompare compares two sessions on the sort columns, then on the
+// id in the order of the last column, as the SQL store does
+func sessionsCompare(a SessionInterface, b SessionInterface, sorts []SortColumn) int {
+	for _, sort := range sorts {
+		if result := strings.Compare(a.Data()[sort.Column], b.Data()[sort.Column]); result != 0 {
+			return lo.Ternary(strings.EqualFold(sort.Order, sb.ASC), result, -result)
+		}
+	}
+
+	result := strings.Compare(a.GetID(), b.GetID())
+
+	return lo.Ternary(strings.EqualFold(sorts[len(sorts)-1].Order, sb.ASC), result, -result)
+}
+
+// ipInCIDR returns true if the IP address, with or without a port, is in
+// the CIDR range
+func ipInCIDR(ipAddress string, cidr string) bool {
+	ip := net.ParseIP(ipAddressHost(ipAddress))
+	_, network, err := net.ParseCIDR(cidr)
+
+	return ip != nil && err == nil && network.Contains(ip)
+}
+
+// sessionsApplyQuery filters, orders, paginates and projects a list of
+// sessions according to the query, as the SQL store would
+//
+// Parameters:
+//   - sessions - the candidate sessions
+//   - query - the session query
+//
+// Returns:
+//   - []SessionInterface - the resulting sessions
+func sessionsApplyQuery(sessions []SessionInterface, query SessionQueryInterface) []SessionInterface {
+	list := lo.Filter(sessions, func(session SessionInterface, _ int) bool {
+		return sessionMatchesQuery(session, query)
+	})
+
+	if sorts := sessionQuerySorts(query); len(sorts) > 0 {
+		sort.SliceStable(list, func(i, j int) bool {
+			return sessionsCompare(list[i], list[j], sorts) < 0
+		})
+	}
+
+	if query.IsCountOnly() {
+		return list
+	}
+
+	if query.HasOffset() {
+		if query.Offset() >= len(list) {
+			return []SessionInterface{}
+		}
+
+		list = list[query.Offset():]
+	}
+
+	if query.HasLimit() && query.Limit() < len(list) {
+		list = list[:query.Limit()]
+	}
+
+	if len(query.Columns()) > 0 {
+		list = lo.Map(list, func(session SessionInterface, _ int) SessionInterface {
+			return newPartialSession(session.Data(), query.Columns())
+		})
+	}
+
+	return list
+}
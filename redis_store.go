@@ -0,0 +1,1193 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*redisStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*redisStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*redisStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*redisStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*redisStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*redisStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*redisStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*redisStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*redisStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// redisStore defines a session store backed by Redis (or any server
+// speaking the Redis protocol).
+//
+// Data layout, all keys prefixed with the key prefix, which is a hash tag
+// (i.e. "{sessionstore}:"), so that on Redis Cluster all the keys are in
+// one slot, as the transactions span the session, id, user and index keys:
+//   - session:<session key> - hash with the session columns, expires at expires_at
+//   - id:<session id> - the session key of the session, expires at expires_at
+//   - user:<user id> - set with the ids of the sessions of the user
+//   - index - sorted set with the ids of all sessions, scored by created_at
+//
+// The sets are not expired natively, stale members are removed lazily
+// on reads and by SessionExpiryGoroutine.
+type redisStore struct {
+	client       redis.UniversalClient
+	keyPrefix    string
+	debugEnabled bool
+	logger       *slog.Logger
+
+	userSessionHandleSecret []byte // keys the user session handles
+}
+
+// NewRedisStoreOptions define the options for creating a new redis session store
+type NewRedisStoreOptions struct {
+	Client redis.UniversalClient
+
+	// KeyPrefix prefixes all the keys, default "sessionstore:". It is
+	// wrapped in a hash tag (i.e. "{sessionstore}:") unless it holds one
+	KeyPrefix string
+
+	DebugEnabled bool
+	Logger       *slog.Logger
+
+	// UserSessionHandleSecret keys the HMAC of the handles returned by
+	// UserSessions, required by UserSessions and UserSessionRevoke, which
+	// return ErrUserSessionHandleSecretRequired without it. All the
+	// instances sharing the sessions must set the same secret, kept across
+	// restarts, or the handles stop matching
+	UserSessionHandleSecret string
+}
+
+// == CONSTRUCTOR =============================================================
+
+// NewRedisStore creates a new redis session store
+func NewRedisStore(opts NewRedisStoreOptions) (*redisStore, error) {
+	store := &redisStore{
+		client:       opts.Client,
+		keyPrefix:    opts.KeyPrefix,
+		debugEnabled: opts.DebugEnabled,
+		logger:       opts.Logger,
+
+		userSessionHandleSecret: []byte(opts.UserSessionHandleSecret),
+	}
+
+	if store.client == nil {
+		return nil, errors.New("redis session store: Client is required")
+	}
+
+	if store.keyPrefix == "" {
+		store.keyPrefix = "sessionstore:"
+	}
+
+	if !strings.Contains(store.keyPrefix, "{") {
+		store.keyPrefix = "{" + strings.TrimSuffix(store.keyPrefix, ":") + "}:"
+	}
+
+	if store.logger == nil {
+		store.logger = slog.Default()
+	}
+
+	return store, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate has no schema to create, it only verifies the connection
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) AutoMigrate(ctx context.Context) error {
+	return store.client.Ping(ctx).Err()
+}
+
+// EnableDebug enables the debug mode
+//
+// # If debug mode is enabled, it will log the operations to the logger
+//
+// Parameters:
+//   - debug - true to enable, false to disable
+func (store *redisStore) EnableDebug(debug bool) {
+	store.debugEnabled = debug
+}
+
+// SessionExpiryGoroutine runs periodically (every minute) and removes the
+// sessions, which Redis has already expired, from the user and index sets
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionExpiryGoroutine() error {
+	for {
+		store.logCommand("prune", "")
+
+		if err := store.pruneIndexes(context.Background()); err != nil {
+			store.logger.Error("Redis Session Store. SessionExpiryGoroutine", slog.String("error", err.Error()))
+		}
+
+		time.Sleep(60 * time.Second) // Every minute
+	}
+}
+
+// SessionCount returns the count of sessions matching the query.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - int64 - the count of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	if query == nil {
+		return -1, errors.New("redis session store > session count. query cannot be nil")
+	}
+
+	query.SetCountOnly(true)
+
+	list, err := store.SessionList(ctx, query)
+
+	if err != nil {
+		return -1, err
+	}
+
+	return int64(len(list)), nil
+}
+
+// SessionCreate creates a new session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("redis session store > session create. session cannot be nil")
+	}
+
+	if session.GetKey() == "" {
+		return errors.New("redis session store > session create. key cannot be empty")
+	}
+
+	if session.GetExpiresAt() == "" {
+		return errors.New("redis session store > session create. expires at cannot be empty")
+	}
+
+	if session.GetCreatedAt() == "" {
+		session.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetUpdatedAt() == "" {
+		session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetSoftDeletedAt() == "" {
+		session.SetSoftDeletedAt(sb.MAX_DATETIME)
+	}
+
+	store.logCommand("create", session.GetID())
+
+	expiresAt := redisExpiresAt(session.GetExpiresAt())
+	sessionKey := store.keySession(session.GetKey())
+
+	// the key is watched, so a concurrent create of the same key fails the transaction
+	err := store.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, sessionKey).Result()
+
+		if err != nil {
+			return err
+		}
+
+		if exists > 0 {
+			return ErrSessionKeyExists
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, sessionKey, redisHashValues(session.Data()))
+			pipe.ExpireAt(ctx, sessionKey, expiresAt)
+			pipe.Set(ctx, store.keyID(session.GetID()), session.GetKey(), 0)
+			pipe.ExpireAt(ctx, store.keyID(session.GetID()), expiresAt)
+			pipe.ZAdd(ctx, store.keyIndex(), redis.Z{
+				Score:  redisScore(session.GetCreatedAt()),
+				Member: session.GetID(),
+			})
+
+			if session.GetUserID() != "" {
+				pipe.SAdd(ctx, store.keyUser(session.GetUserID()), session.GetID())
+			}
+
+			return nil
+		})
+
+		return err
+	}, sessionKey)
+
+	if err == redis.TxFailedErr {
+		return ErrSessionKeyExists
+	}
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionCreateMany creates sessions one at a time, stopping at the
+// first error, the sessions created before it are kept
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	return sessionCreateEach(ctx, store.SessionCreate, sessions)
+}
+
+// SessionDelete deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	return store.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionDeleteByID deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionDeleteByID(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("session id is empty")
+	}
+
+	store.logCommand("delete", id)
+
+	_, err := store.deleteByIDs(ctx, []string{id})
+
+	return err
+}
+
+// SessionDeleteByUserID deletes all the sessions of a user in a single
+// transaction, i.e. to log the user out everywhere.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("redis session store > session delete by user id. user id cannot be empty")
+	}
+
+	ids, err := store.client.SMembers(ctx, store.keyUser(userID)).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	ids = lo.Without(ids, exceptSessionID)
+
+	store.logCommand("delete by user id", userID)
+
+	return store.deleteByIDs(ctx, ids)
+}
+
+// SessionDeleteMany deletes the sessions matching the filters of a
+// query one at a time, see store.SessionDeleteMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return sessionDeleteEach(ctx, store, query)
+}
+
+// SessionExtend extends a session's expiry time by the given seconds.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to extend
+//   - seconds - the number of seconds to extend the session by
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	expiresAt := carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC)
+
+	session.SetExpiresAt(expiresAt)
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionFindByID finds a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	if sessionID == "" {
+		return nil, errors.New("redis session store > find by id: session id is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetID(sessionID).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFindByKey finds a session by key.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	if sessionKey == "" {
+		return nil, errors.New("redis session store > find by key: session key is required")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetKey(sessionKey).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// SessionFlush does nothing, every write goes to Redis directly
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - always nil
+func (store *redisStore) SessionFlush(ctx context.Context) error {
+	return nil
+}
+
+// SessionList returns a list of sessions matching the query.
+//
+// The candidates are read from the most selective structure available
+// (key, id, user set or the created_at index), the remaining filters,
+// ordering and pagination are applied in memory.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - []SessionInterface - list of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	if query == nil {
+		return []SessionInterface{}, errors.New("redis session store > session list. query cannot be nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return []SessionInterface{}, err
+	}
+
+	var candidates []SessionInterface
+	var err error
+
+	switch {
+	case query.HasKey():
+		candidates, err = store.loadByKeys(ctx, []string{query.Key()})
+	case query.HasID():
+		candidates, err = store.loadByIDs(ctx, []string{query.ID()})
+	case query.HasIDIn():
+		candidates, err = store.loadByIDs(ctx, query.IDIn())
+	case query.HasKeyIn():
+		candidates, err = store.loadByKeys(ctx, lo.Uniq(query.KeyIn()))
+	case query.HasUserID():
+		var ids []string
+		ids, err = store.client.SMembers(ctx, store.keyUser(query.UserID())).Result()
+		if err == nil {
+			candidates, err = store.loadByIDs(ctx, ids)
+		}
+	case query.HasUserIDIn():
+		keys := lo.Map(query.UserIDIn(), func(userID string, _ int) string { return store.keyUser(userID) })
+
+		var ids []string
+		ids, err = store.client.SUnion(ctx, keys...).Result()
+		if err == nil {
+			candidates, err = store.loadByIDs(ctx, ids)
+		}
+	default:
+		rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+
+		if query.HasCreatedAtGte() {
+			rangeBy.Min = strconv.FormatFloat(redisScore(query.CreatedAtGte()), 'f', 0, 64)
+		}
+
+		if query.HasCreatedAtLte() {
+			rangeBy.Max = strconv.FormatFloat(redisScore(query.CreatedAtLte()), 'f', 0, 64)
+		}
+
+		var ids []string
+		ids, err = store.client.ZRangeByScore(ctx, store.keyIndex(), rangeBy).Result()
+		if err == nil {
+			candidates, err = store.loadByIDs(ctx, ids)
+		}
+	}
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	return sessionsApplyQuery(candidates, query), nil
+}
+
+// SessionListPage returns a page of the sessions matching the query, and
+// the cursor of the next page, see store.SessionListPage. The created_at
+// index is read by score from the cursor on, a batch at a time, up to
+// the end of the page, unless the query looks the sessions up by key, id
+// or user, as SessionList.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 100)
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	limit, err := sessionPageLimit(query)
+
+	if err != nil {
+		return []SessionInterface{}, "", err
+	}
+
+	if sessionQueryHasLookup(query) {
+		return sessionListPage(ctx, store.SessionList, query)
+	}
+
+	return sessionIndexPage(query, limit, store.indexWalk(ctx, query, limit+1))
+}
+
+// SessionIterate calls fn for each session matching the query, a page
+// at a time, see store.SessionIterate
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 1000)
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *redisStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return sessionIterate(ctx, store.SessionListPage, query, fn)
+}
+
+// SessionStats returns statistics of the sessions, see store.SessionStats.
+// They are computed in memory, iterating over the sessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return sessionStatsIterate(ctx, store.SessionIterate, query)
+}
+
+// SessionPromote upgrades a guest session to an authenticated one,
+// merging the value of the user's most recent session and regenerating
+// the session key.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	return sessionPromoteByUpdate(ctx, store, session, userID, mergeStrategy)
+}
+
+// SessionSoftDelete soft deletes a session.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to soft delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	session.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionSoftDeleteByID soft deletes a session by id.
+//
+// Parameters:
+//   - ctx - the context
+//   - id - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionSoftDeleteByID(ctx context.Context, id string) error {
+	session, err := store.SessionFindByID(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user in a
+// single transaction, i.e. on password reset.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("redis session store > session soft delete by user id. user id cannot be empty")
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().SetUserID(userID))
+
+	if err != nil {
+		return 0, err
+	}
+
+	list = lo.Filter(list, func(session SessionInterface, _ int) bool {
+		return session.GetID() != exceptSessionID
+	})
+
+	if len(list) == 0 {
+		return 0, nil
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	store.logCommand("soft delete by user id", userID)
+
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, session := range list {
+			pipe.HSet(ctx, store.keySession(session.GetKey()), map[string]any{
+				COLUMN_SOFT_DELETED_AT: now,
+				COLUMN_UPDATED_AT:      now,
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(list)), nil
+}
+
+// SessionUpdate updates the changed fields of a session. Changing the
+// key moves the session to the new key, changing the expiry updates
+// the native expiry.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to update
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("redis session store > session update. session cannot be nil")
+	}
+
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	dataChanged := session.DataChanged()
+
+	delete(dataChanged, COLUMN_ID) // ID cannot be updated
+
+	if len(dataChanged) == 0 {
+		return nil
+	}
+
+	store.logCommand("update", session.GetID())
+
+	idKey := store.keyID(session.GetID())
+
+	err := store.client.Watch(ctx, func(tx *redis.Tx) error {
+		currentKey, err := tx.Get(ctx, idKey).Result()
+
+		if err == redis.Nil {
+			return nil // nothing to update, as with SQL
+		}
+
+		if err != nil {
+			return err
+		}
+
+		currentUserID, err := tx.HGet(ctx, store.keySession(currentKey), COLUMN_USER_ID).Result()
+
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		newKey := currentKey
+		if key, changed := dataChanged[COLUMN_SESSION_KEY]; changed && key != "" {
+			newKey = key
+		}
+
+		if newKey != currentKey {
+			// watched, so a session created with the new key meanwhile fails the transaction
+			if err := tx.Watch(ctx, store.keySession(newKey)).Err(); err != nil {
+				return err
+			}
+
+			exists, err := tx.Exists(ctx, store.keySession(newKey)).Result()
+
+			if err != nil {
+				return err
+			}
+
+			if exists > 0 {
+				return ErrSessionKeyExists
+			}
+		}
+
+		var renamed *redis.BoolCmd
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, store.keySession(currentKey), redisHashValues(dataChanged))
+
+			if newKey != currentKey {
+				renamed = pipe.RenameNX(ctx, store.keySession(currentKey), store.keySession(newKey))
+				pipe.Set(ctx, idKey, newKey, redis.KeepTTL)
+			}
+
+			if expiresAt, changed := dataChanged[COLUMN_EXPIRES_AT]; changed {
+				pipe.ExpireAt(ctx, store.keySession(newKey), redisExpiresAt(expiresAt))
+				pipe.ExpireAt(ctx, idKey, redisExpiresAt(expiresAt))
+			}
+
+			if userID, changed := dataChanged[COLUMN_USER_ID]; changed && userID != currentUserID {
+				if currentUserID != "" {
+					pipe.SRem(ctx, store.keyUser(currentUserID), session.GetID())
+				}
+
+				if userID != "" {
+					pipe.SAdd(ctx, store.keyUser(userID), session.GetID())
+				}
+			}
+
+			return nil
+		})
+
+		if err == nil && renamed != nil && !renamed.Val() {
+			return ErrSessionKeyExists
+		}
+
+		return err
+	}, idKey)
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionUpdateMany sets the fields of the sessions matching the filters
+// of a query one at a time, see store.SessionUpdateMany
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	return sessionUpdateEach(ctx, store, query, fields)
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, see store.SessionFindByIDIncludingDeleted
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return sessionFindByIDIncludingDeleted(ctx, store.SessionList, sessionID)
+}
+
+// SessionRestore restores a soft deleted session, and records who
+// restored it, when and why, see store.SessionRestore. Expired
+// sessions are dropped by Redis, so only the live ones can be restored.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func (store *redisStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	session, err := sessionRestorePrepare(ctx, store, sessionID, options)
+
+	if err != nil {
+		return err
+	}
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// UserSessions returns the active sessions of a user, most recently
+// seen first, i.e. for a "Where you're logged in" page.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *redisStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	_, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+	return err
+}
+
+// PRIVATE METHODS ===========================================================
+
+// deleteByIDs deletes the sessions with the given ids in one transaction
+//
+// Parameters:
+//   - ctx - the context
+//   - ids - the session ids
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *redisStore) deleteByIDs(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	sessions, err := store.loadByIDs(ctx, ids)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, store.keyID(id))
+			pipe.ZRem(ctx, store.keyIndex(), id)
+		}
+
+		for _, session := range sessions {
+			pipe.Del(ctx, store.keySession(session.GetKey()))
+
+			if session.GetUserID() != "" {
+				pipe.SRem(ctx, store.keyUser(session.GetUserID()), session.GetID())
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(sessions)), nil
+}
+
+// loadByIDs loads the sessions with the given ids, skipping (and pruning)
+// the ones Redis has already expired
+func (store *redisStore) loadByIDs(ctx context.Context, ids []string) ([]SessionInterface, error) {
+	keys, missingIDs, err := store.keysByIDs(ctx, ids)
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	if len(missingIDs) > 0 {
+		// stale members, their sessions have expired
+		members := lo.ToAnySlice(missingIDs)
+		if err := store.client.ZRem(ctx, store.keyIndex(), members...).Err(); err != nil {
+			return []SessionInterface{}, err
+		}
+	}
+
+	return store.loadByKeys(ctx, keys)
+}
+
+// keysByIDs returns the session keys of the sessions with the given ids,
+// in order, and the ids of the sessions Redis has already expired
+func (store *redisStore) keysByIDs(ctx context.Context, ids []string) (keys []string, missingIDs []string, err error) {
+	if len(ids) == 0 {
+		return []string{}, []string{}, nil
+	}
+
+	idKeys := lo.Map(ids, func(id string, _ int) string {
+		return store.keyID(id)
+	})
+
+	values, err := store.client.MGet(ctx, idKeys...).Result()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys = []string{}
+	missingIDs = []string{}
+
+	for i, value := range values {
+		if key, ok := value.(string); ok && key != "" {
+			keys = append(keys, key)
+		} else {
+			missingIDs = append(missingIDs, ids[i])
+		}
+	}
+
+	return keys, missingIDs, nil
+}
+
+// loadByKeys loads the sessions with the given session keys, skipping
+// the ones which do not exist
+func (store *redisStore) loadByKeys(ctx context.Context, keys []string) ([]SessionInterface, error) {
+	if len(keys) == 0 {
+		return []SessionInterface{}, nil
+	}
+
+	pipe := store.client.Pipeline()
+
+	commands := lo.Map(keys, func(key string, _ int) *redis.MapStringStringCmd {
+		return pipe.HGetAll(ctx, store.keySession(key))
+	})
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return []SessionInterface{}, err
+	}
+
+	list := []SessionInterface{}
+
+	for _, command := range commands {
+		data, err := command.Result()
+
+		if err != nil {
+			return []SessionInterface{}, err
+		}
+
+		if len(data) == 0 {
+			continue
+		}
+
+		list = append(list, NewSessionFromExistingData(data))
+	}
+
+	return list, nil
+}
+
+// indexWalk returns a function returning the sessions of the created_at
+// index one at a time, in the keyset order of the query, from its cursor
+// to its created_at bound, nil after the last one. The members sharing
+// the score of the cursor sort by id, as the keyset order, those up to
+// the cursor are skipped.
+//
+// The index is read a batch at a time, and not pruned of the expired
+// sessions while walked, which would shift the batches.
+func (store *redisStore) indexWalk(ctx context.Context, query SessionQueryInterface, batch int) func() (SessionInterface, error) {
+	ascending := sessionQueryAscending(query)
+	rangeBy := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: int64(batch)}
+
+	if query.HasCreatedAtGte() {
+		rangeBy.Min = strconv.FormatFloat(redisScore(query.CreatedAtGte()), 'f', 0, 64)
+	}
+
+	if query.HasCreatedAtLte() {
+		rangeBy.Max = strconv.FormatFloat(redisScore(query.CreatedAtLte()), 'f', 0, 64)
+	}
+
+	var position sessionCursor
+	var positionScore float64
+
+	if query.HasCursor() {
+		position, _ = sessionCursorDecode(query.Cursor())
+		positionScore = redisScore(position.CreatedAt)
+		score := strconv.FormatFloat(positionScore, 'f', 0, 64)
+
+		if ascending && (!query.HasCreatedAtGte() || positionScore > redisScore(query.CreatedAtGte())) {
+			rangeBy.Min = score
+		}
+
+		if !ascending && (!query.HasCreatedAtLte() || positionScore < redisScore(query.CreatedAtLte())) {
+			rangeBy.Max = score
+		}
+	}
+
+	buffered := []SessionInterface{}
+	exhausted := false
+
+	return func() (SessionInterface, error) {
+		for len(buffered) == 0 {
+			if exhausted {
+				return nil, nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			var members []redis.Z
+			var err error
+
+			if ascending {
+				members, err = store.client.ZRangeByScoreWithScores(ctx, store.keyIndex(), rangeBy).Result()
+			} else {
+				members, err = store.client.ZRevRangeByScoreWithScores(ctx, store.keyIndex(), rangeBy).Result()
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			rangeBy.Offset += int64(len(members))
+			exhausted = len(members) < batch
+
+			ids := []string{}
+
+			for _, member := range members {
+				id := cast.ToString(member.Member)
+
+				if query.HasCursor() && member.Score == positionScore && (ascending && id <= position.ID || !ascending && id >= position.ID) {
+					continue // up to the cursor
+				}
+
+				ids = append(ids, id)
+			}
+
+			keys, _, err := store.keysByIDs(ctx, ids)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if buffered, err = store.loadByKeys(ctx, keys); err != nil {
+				return nil, err
+			}
+		}
+
+		session := buffered[0]
+		buffered = buffered[1:]
+
+		return session, nil
+	}
+}
+
+// pruneIndexes removes the ids of sessions, which have expired,
+// from the index and the user sets
+func (store *redisStore) pruneIndexes(ctx context.Context) error {
+	ids, err := store.client.ZRange(ctx, store.keyIndex(), 0, -1).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range lo.Chunk(ids, 500) {
+		if _, err := store.loadByIDs(ctx, chunk); err != nil {
+			return err
+		}
+	}
+
+	iter := store.client.Scan(ctx, 0, store.keyUser("*"), 100).Iterator()
+
+	for iter.Next(ctx) {
+		userKey := iter.Val()
+
+		members, err := store.client.SMembers(ctx, userKey).Result()
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range members {
+			exists, err := store.client.Exists(ctx, store.keyID(id)).Result()
+
+			if err != nil {
+				return err
+			}
+
+			if exists == 0 {
+				if err := store.client.SRem(ctx, userKey, id).Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return iter.Err()
+}
+
+// keySession returns the redis key of the session hash
+func (store *redisStore) keySession(sessionKey string) string {
+	return store.keyPrefix + "session:" + sessionKey
+}
+
+// keyID returns the redis key pointing from the session id to the session key
+func (store *redisStore) keyID(sessionID string) string {
+	return store.keyPrefix + "id:" + sessionID
+}
+
+// keyUser returns the redis key of the set of session ids of a user
+func (store *redisStore) keyUser(userID string) string {
+	return store.keyPrefix + "user:" + userID
+}
+
+// keyIndex returns the redis key of the sorted set of all session ids
+func (store *redisStore) keyIndex() string {
+	return store.keyPrefix + "index"
+}
+
+// logCommand logs the operation if debug is enabled
+func (store *redisStore) logCommand(operation string, subject string) {
+	if !store.debugEnabled {
+		return
+	}
+
+	store.logger.Debug("redis: "+operation, slog.String("subject", subject))
+}
+
+// redisExpiresAt converts an expires at datetime to a time for EXPIREAT
+func redisExpiresAt(expiresAt string) time.Time {
+	return carbon.Parse(expiresAt, carbon.UTC).StdTime()
+}
+
+// redisScore converts a datetime to a sorted set score (unix seconds)
+func redisScore(datetime string) float64 {
+	parsed := carbon.Parse(datetime, carbon.UTC)
+
+	if parsed.Error != nil || parsed.IsZero() {
+		return math.Inf(-1)
+	}
+
+	return float64(parsed.Timestamp())
+}
+
+// redisHashValues converts session data to HSET arguments
+func redisHashValues(data map[string]string) map[string]any {
+	values := make(map[string]any, len(data))
+
+	for key, value := range data {
+		values[key] = value
+	}
+
+	return values
+}
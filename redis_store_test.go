@@ -0,0 +1,278 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dromara/carbon/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func initRedisStore(t *testing.T) (*redisStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+
+	store, err := NewRedisStore(NewRedisStoreOptions{
+		Client: redis.NewClient(&redis.Options{Addr: server.Addr()}),
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	if err := store.AutoMigrate(context.Background()); err != nil {
+		t.Fatal("Automigrate failed: " + err.Error())
+	}
+
+	return store, server
+}
+
+func TestRedisStore_SessionCreateAndFind(t *testing.T) {
+	store, _ := initRedisStore(t)
+
+	session := NewSession().
+		SetUserID("1").
+		SetValue("one two three four")
+
+	err := store.SessionCreate(context.Background(), session)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	foundByKey, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if foundByKey == nil || foundByKey.GetID() != session.GetID() || foundByKey.GetValue() != "one two three four" {
+		t.Fatal("unexpected session found by key:", foundByKey)
+	}
+
+	foundByID, err := store.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if foundByID == nil || foundByID.GetKey() != session.GetKey() {
+		t.Fatal("unexpected session found by id:", foundByID)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("unexpected count:", count)
+	}
+}
+
+func TestRedisStore_NativeExpiry(t *testing.T) {
+	store, server := initRedisStore(t)
+
+	session := NewSession().
+		SetUserID("1").
+		SetExpiresAt(carbon.Now(carbon.UTC).AddSeconds(30).ToDateTimeString(carbon.UTC))
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ttl := server.TTL(store.keySession(session.GetKey()))
+
+	if ttl <= 0 || ttl > 31*time.Second {
+		t.Fatal("unexpected native ttl:", ttl)
+	}
+
+	server.FastForward(time.Minute)
+
+	found, err := store.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Session MUST be expired")
+	}
+
+	if err := store.pruneIndexes(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	members, _ := server.SMembers(store.keyUser("1"))
+
+	if len(members) != 0 {
+		t.Fatal("expired session MUST be pruned from the user set:", members)
+	}
+}
+
+func TestRedisStore_SessionUpdate(t *testing.T) {
+	store, _ := initRedisStore(t)
+
+	session := NewSession()
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	oldKey := session.GetKey()
+
+	session.SetValue("updated").SetUserID("2").SetKey(generateSessionKey(100))
+
+	if err := store.SessionUpdate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByKey(context.Background(), oldKey)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("old key MUST NOT be valid anymore")
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetUserID("2"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetValue() != "updated" || list[0].GetKey() != session.GetKey() {
+		t.Fatal("unexpected sessions of the new user:", list)
+	}
+}
+
+func TestRedisStore_SessionKeyExists(t *testing.T) {
+	store, _ := initRedisStore(t)
+
+	session := NewSession().SetValue("one")
+	other := NewSession().SetValue("two")
+
+	for _, s := range []SessionInterface{session, other} {
+		if err := store.SessionCreate(context.Background(), s); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	err := store.SessionCreate(context.Background(), NewSession().SetKey(session.GetKey()))
+
+	if !errors.Is(err, ErrSessionKeyExists) {
+		t.Fatal("expected ErrSessionKeyExists on create, found:", err)
+	}
+
+	other.SetKey(session.GetKey())
+
+	err = store.SessionUpdate(context.Background(), other)
+
+	if !errors.Is(err, ErrSessionKeyExists) {
+		t.Fatal("expected ErrSessionKeyExists on update, found:", err)
+	}
+
+	found, err := store.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetID() != session.GetID() || found.GetValue() != "one" {
+		t.Fatal("session holding the key MUST NOT be overwritten, found:", found)
+	}
+}
+
+func TestRedisStore_SessionDeleteByUserID(t *testing.T) {
+	store, _ := initRedisStore(t)
+
+	current := NewSession().SetUserID("1")
+
+	for _, session := range []SessionInterface{current, NewSession().SetUserID("1"), NewSession().SetUserID("2")} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	softDeleted, err := store.SessionSoftDeleteByUserID(context.Background(), "2", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if softDeleted != 1 {
+		t.Fatal("unexpected soft deleted count:", softDeleted)
+	}
+
+	deleted, err := store.SessionDeleteByUserID(context.Background(), "1", current.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1 {
+		t.Fatal("unexpected deleted count:", deleted)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("only the current session MUST remain active, found:", count)
+	}
+}
+
+func TestRedisStore_KeyLayout(t *testing.T) {
+	store, server := initRedisStore(t)
+
+	session := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	keys := server.Keys()
+
+	if len(keys) != 4 {
+		t.Fatal("Expected the session, id, user and index keys, found:", keys)
+	}
+
+	// one hash tag, so that on Redis Cluster the keys of a transaction are in one slot
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "{sessionstore}:") {
+			t.Fatal("Expected the key to start with the hash tag {sessionstore}, found:", key)
+		}
+	}
+
+	for prefix, expected := range map[string]string{
+		"myapp:session:":    "{myapp:session}:",
+		"myapp:{sessions}:": "myapp:{sessions}:",
+	} {
+		store, err := NewRedisStore(NewRedisStoreOptions{
+			Client:    store.client,
+			KeyPrefix: prefix,
+		})
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if store.keyIndex() != expected+"index" {
+			t.Fatal("Expected the key prefix", expected, "found:", store.keyIndex())
+		}
+	}
+}
+
+func TestRedisStore_SessionListPage(t *testing.T) {
+	store, _ := initRedisStore(t)
+	assertSessionIndexPages(t, store)
+}
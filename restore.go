@@ -0,0 +1,145 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+)
+
+// SessionRestoreOptions define the options for restoring a soft deleted session
+type SessionRestoreOptions struct {
+	// ExpiresAt is the new expiry time of the session (UTC), optional,
+	// required if the session has expired meanwhile
+	ExpiresAt string
+
+	// RestoredBy identifies who restores the session, i.e. a support
+	// agent, required, recorded with the session
+	RestoredBy string
+
+	// Reason is why the session is restored, i.e. a ticket, recorded with the session
+	Reason string
+}
+
+// sessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions. The stores implement
+// SessionFindByIDIncludingDeleted with it, over their own list function.
+//
+// Parameters:
+//   - ctx - the context
+//   - list - the list function of the store
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func sessionFindByIDIncludingDeleted(ctx context.Context, list func(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error), sessionID string) (SessionInterface, error) {
+	if sessionID == "" {
+		return nil, errors.New("session store > find by id including deleted: session id is required")
+	}
+
+	sessions, err := list(ctx, SessionQuery().
+		SetID(sessionID).
+		SetSoftDeletedIncluded(true).
+		SetLimit(1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sessions) > 0 {
+		return sessions[0], nil
+	}
+
+	return nil, nil
+}
+
+// sessionRestorePrepare finds a soft deleted session, and sets the
+// changes restoring it, the soft deleted time cleared, the new expiry
+// and who restored it and why
+//
+// Parameters:
+//   - ctx - the context
+//   - store - the store
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - SessionInterface - the session, with the changes to write
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func sessionRestorePrepare(ctx context.Context, store StoreInterface, sessionID string, options SessionRestoreOptions) (SessionInterface, error) {
+	if options.RestoredBy == "" {
+		return nil, errors.New("session restore: restored by cannot be empty")
+	}
+
+	expiresAt := ""
+
+	if options.ExpiresAt != "" {
+		parsed := carbon.Parse(options.ExpiresAt, carbon.UTC)
+
+		if parsed.Error != nil || parsed.IsZero() {
+			return nil, errors.New("session restore: expires at " + options.ExpiresAt + " is not a valid datetime")
+		}
+
+		expiresAt = parsed.ToDateTimeString(carbon.UTC)
+	}
+
+	session, err := storeFindByIDIncludingDeleted(ctx, store, sessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	if !session.IsSoftDeleted() {
+		return nil, errors.New("session restore: session is not soft deleted")
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	if expiresAt != "" {
+		session.SetExpiresAt(expiresAt)
+	}
+
+	if datetimeNormalize(session.GetExpiresAt()) <= now {
+		return nil, errors.New("session restore: session has expired, a new expiry is required")
+	}
+
+	session.SetSoftDeletedAt(sb.MAX_DATETIME).
+		SetRestoredAt(now).
+		SetRestoredBy(options.RestoredBy).
+		SetRestoreReason(options.Reason)
+
+	return session, nil
+}
+
+// storeFindByIDIncludingDeleted finds a session by id, including the soft
+// deleted and expired sessions, with SessionFindByIDIncludingDeleted if
+// the store implements RestoreStoreInterface, otherwise with a list
+func storeFindByIDIncludingDeleted(ctx context.Context, st StoreInterface, sessionID string) (SessionInterface, error) {
+	if restorer, ok := st.(RestoreStoreInterface); ok {
+		return restorer.SessionFindByIDIncludingDeleted(ctx, sessionID)
+	}
+
+	return sessionFindByIDIncludingDeleted(ctx, st.SessionList, sessionID)
+}
+
+// storeRestore restores a soft deleted session with SessionRestore if
+// the store implements RestoreStoreInterface, otherwise with an update
+func storeRestore(ctx context.Context, st StoreInterface, sessionID string, options SessionRestoreOptions) error {
+	if restorer, ok := st.(RestoreStoreInterface); ok {
+		return restorer.SessionRestore(ctx, sessionID, options)
+	}
+
+	session, err := sessionRestorePrepare(ctx, st, sessionID, options)
+
+	if err != nil {
+		return err
+	}
+
+	return st.SessionUpdate(ctx, session)
+}
@@ -1,10 +1,13 @@
 package sessionstore
 
 import (
+	"slices"
+
 	"github.com/dracory/dataobject"
 	"github.com/dracory/sb"
 	"github.com/dracory/uid"
 	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
 )
 
 var _ SessionInterface = (*session)(nil)
@@ -14,6 +17,9 @@ var _ SessionInterface = (*session)(nil)
 // session represents a user session.
 type session struct {
 	dataobject.DataObject
+
+	// columns are the loaded columns of a partial session, nil if all
+	columns []string
 }
 
 // == CONSTRUCTORS ============================================================
@@ -49,6 +55,84 @@ func NewSessionFromExistingData(data map[string]string) SessionInterface {
 	return o
 }
 
+// newPartialSession creates a session loaded with a subset of the
+// columns, i.e. from a session query with columns
+func newPartialSession(data map[string]string, columns []string) SessionInterface {
+	o := &session{columns: lo.Uniq(append([]string{}, columns...))}
+	loaded := map[string]string{}
+
+	for _, column := range o.columns {
+		loaded[column] = data[column] // empty if the store has no value
+	}
+
+	o.Hydrate(loaded)
+	return o
+}
+
+// sessionClone returns an independent copy of a session, with the same
+// changed (dirty) columns, i.e. to write it later without races
+func sessionClone(src SessionInterface) SessionInterface {
+	o := &session{}
+
+	if src.IsPartial() {
+		o.columns = lo.Filter(lo.Keys(src.Data()), func(column string, _ int) bool { return src.IsLoaded(column) })
+	}
+
+	o.Hydrate(lo.Assign(src.Data()))
+
+	for key, value := range src.DataChanged() {
+		o.Set(key, value)
+	}
+
+	return o
+}
+
+// sessionWithFields returns a copy of a session with the fields set as
+// changed (dirty) columns, i.e. for a bulk update one session at a time
+func sessionWithFields(src SessionInterface, fields map[string]string) SessionInterface {
+	o := &session{}
+	o.Hydrate(lo.Assign(src.Data()))
+
+	for column, value := range fields {
+		o.Set(column, value)
+	}
+
+	return o
+}
+
+// sessionUpdateCheck returns an error if a partial session cannot be
+// updated, the id and key identify the session, and only the loaded
+// columns can be changed, the updated at time aside, set by the store
+//
+// Parameters:
+//   - session - the session to update
+//
+// Returns:
+//   - error - nil if the session can be updated, otherwise ErrColumnNotLoaded
+func sessionUpdateCheck(session SessionInterface) error {
+	if !session.IsPartial() {
+		return nil
+	}
+
+	columns := []string{COLUMN_ID, COLUMN_SESSION_KEY}
+
+	for column := range session.DataChanged() {
+		if column != COLUMN_UPDATED_AT {
+			columns = append(columns, column)
+		}
+	}
+
+	slices.Sort(columns[2:]) // a stable error
+
+	for _, column := range columns {
+		if !session.IsLoaded(column) {
+			return &ErrColumnNotLoaded{Column: column, SessionID: session.GetID()}
+		}
+	}
+
+	return nil
+}
+
 // == METHODS =================================================================
 
 // IsExpired returns true if the session is expired
@@ -56,6 +140,19 @@ func (o *session) IsExpired() bool {
 	return o.GetExpiresAtCarbon().Compare("<", carbon.Now(carbon.UTC))
 }
 
+// IsPartial returns true if the session was loaded with a subset of the
+// columns, by a session query with columns
+func (o *session) IsPartial() bool {
+	return o.columns != nil
+}
+
+// IsLoaded returns true if the column was loaded, always true unless the
+// session is partial. The getters of a column not loaded return an empty
+// string, IsLoaded tells it apart from an empty value.
+func (o *session) IsLoaded(column string) bool {
+	return o.columns == nil || lo.Contains(o.columns, column)
+}
+
 // IsSoftDeleted returns true if the session is soft deleted
 func (o *session) IsSoftDeleted() bool {
 	return o.GetSoftDeletedAtCarbon().Compare("<", carbon.Now(carbon.UTC))
@@ -145,6 +242,39 @@ func (session *session) SetKey(key string) SessionInterface {
 	return session
 }
 
+// GetRestoredAt returns the time the session was last restored, empty if never restored.
+func (session *session) GetRestoredAt() string {
+	return session.Get(COLUMN_RESTORED_AT)
+}
+
+// SetRestoredAt sets the time the session was last restored.
+func (session *session) SetRestoredAt(restoredAt string) SessionInterface {
+	session.Set(COLUMN_RESTORED_AT, restoredAt)
+	return session
+}
+
+// GetRestoredBy returns who last restored the session, i.e. a support agent.
+func (session *session) GetRestoredBy() string {
+	return session.Get(COLUMN_RESTORED_BY)
+}
+
+// SetRestoredBy sets who last restored the session.
+func (session *session) SetRestoredBy(restoredBy string) SessionInterface {
+	session.Set(COLUMN_RESTORED_BY, restoredBy)
+	return session
+}
+
+// GetRestoreReason returns why the session was last restored.
+func (session *session) GetRestoreReason() string {
+	return session.Get(COLUMN_RESTORE_REASON)
+}
+
+// SetRestoreReason sets why the session was last restored.
+func (session *session) SetRestoreReason(restoreReason string) SessionInterface {
+	session.Set(COLUMN_RESTORE_REASON, restoreReason)
+	return session
+}
+
 // GetUpdatedAt returns the updated at time of the session.
 func (session *session) GetUpdatedAt() string {
 	return session.Get(COLUMN_UPDATED_AT)
@@ -183,6 +313,31 @@ func (session *session) SetUserID(userID string) SessionInterface {
 	return session
 }
 
+// GetTenantID returns the tenant id of the session, empty if it has no tenant.
+func (session *session) GetTenantID() string {
+	return session.Get(COLUMN_TENANT_ID)
+}
+
+// SetTenantID sets the tenant id of the session.
+func (session *session) SetTenantID(tenantID string) SessionInterface {
+	session.Set(COLUMN_TENANT_ID, tenantID)
+	return session
+}
+
+// GetMeta returns the value of a meta column of the session, empty if not set.
+//
+// The meta columns are registered with NewStoreOptions.MetaColumns, the
+// other stores keep any meta value with the session.
+func (session *session) GetMeta(name string) string {
+	return session.Get(name)
+}
+
+// SetMeta sets the value of a meta column of the session.
+func (session *session) SetMeta(name string, value string) SessionInterface {
+	session.Set(name, value)
+	return session
+}
+
 // GetValue returns the value of the session.
 func (session *session) GetValue() string {
 	return session.Get(COLUMN_SESSION_VALUE)
@@ -0,0 +1,207 @@
+package sessionstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// sessionCache is a bounded, thread safe LRU cache of session data,
+// keyed by session key. A nil data entry caches the absence of a key.
+type sessionCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // front is the most recently used
+
+	// secondary indexes, for invalidation by id and by user
+	keysByID     map[string]string
+	keysByUserID map[string]map[string]struct{}
+
+	// generation is incremented on every invalidation, so that a value read
+	// from the store before an invalidation is not cached after it
+	generation uint64
+}
+
+// sessionCacheEntry is a single cached session
+type sessionCacheEntry struct {
+	key       string
+	data      map[string]string
+	expiresAt time.Time
+}
+
+// newSessionCache creates a new session cache holding at most maxEntries
+func newSessionCache(maxEntries int) *sessionCache {
+	return &sessionCache{
+		maxEntries:   maxEntries,
+		entries:      map[string]*list.Element{},
+		order:        list.New(),
+		keysByID:     map[string]string{},
+		keysByUserID: map[string]map[string]struct{}{},
+	}
+}
+
+// get returns the cached data of a session key. found is false on a
+// cache miss, data is nil if the absence of the key is cached.
+func (cache *sessionCache) get(key string, now time.Time) (data map[string]string, found bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*sessionCacheEntry)
+
+	if !now.Before(entry.expiresAt) {
+		cache.removeElement(element)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+
+	if entry.data == nil {
+		return nil, true
+	}
+
+	return lo.Assign(entry.data), true
+}
+
+// currentGeneration returns the current invalidation generation, to be
+// passed to set after reading the value from the store
+func (cache *sessionCache) currentGeneration() uint64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.generation
+}
+
+// set caches the data of a session key until expiresAt, nil data caches
+// the absence of the key. The value is dropped if the cache has been
+// invalidated since the given generation.
+func (cache *sessionCache) set(key string, data map[string]string, expiresAt time.Time, generation uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+	}
+
+	entry := &sessionCacheEntry{key: key, expiresAt: expiresAt}
+
+	if data != nil {
+		entry.data = lo.Assign(data)
+
+		if id := data[COLUMN_ID]; id != "" {
+			cache.keysByID[id] = key
+		}
+
+		if userID := data[COLUMN_USER_ID]; userID != "" {
+			if cache.keysByUserID[userID] == nil {
+				cache.keysByUserID[userID] = map[string]struct{}{}
+			}
+			cache.keysByUserID[userID][key] = struct{}{}
+		}
+	}
+
+	cache.entries[key] = cache.order.PushFront(entry)
+
+	for cache.maxEntries > 0 && cache.order.Len() > cache.maxEntries {
+		cache.removeElement(cache.order.Back())
+	}
+}
+
+// invalidateKey removes a session key from the cache
+func (cache *sessionCache) invalidateKey(key string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+	}
+}
+
+// invalidateID removes the session with the given id from the cache
+func (cache *sessionCache) invalidateID(id string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+
+	if key, ok := cache.keysByID[id]; ok {
+		if element, ok := cache.entries[key]; ok {
+			cache.removeElement(element)
+		}
+	}
+}
+
+// invalidateUserID removes all the sessions of a user from the cache
+func (cache *sessionCache) invalidateUserID(userID string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+
+	for key := range cache.keysByUserID[userID] {
+		if element, ok := cache.entries[key]; ok {
+			cache.removeElement(element)
+		}
+	}
+
+	delete(cache.keysByUserID, userID)
+}
+
+// invalidateAll empties the cache
+func (cache *sessionCache) invalidateAll() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+
+	cache.entries = map[string]*list.Element{}
+	cache.order.Init()
+	cache.keysByID = map[string]string{}
+	cache.keysByUserID = map[string]map[string]struct{}{}
+}
+
+// len returns the number of cached entries
+func (cache *sessionCache) len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.order.Len()
+}
+
+// removeElement removes an entry and its index entries, the lock must be held
+func (cache *sessionCache) removeElement(element *list.Element) {
+	entry := element.Value.(*sessionCacheEntry)
+
+	cache.order.Remove(element)
+	delete(cache.entries, entry.key)
+
+	if entry.data == nil {
+		return
+	}
+
+	if id := entry.data[COLUMN_ID]; cache.keysByID[id] == entry.key {
+		delete(cache.keysByID, id)
+	}
+
+	if userID := entry.data[COLUMN_USER_ID]; userID != "" {
+		delete(cache.keysByUserID[userID], entry.key)
+
+		if len(cache.keysByUserID[userID]) == 0 {
+			delete(cache.keysByUserID, userID)
+		}
+	}
+}
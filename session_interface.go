@@ -13,6 +13,8 @@ type SessionInterface interface {
 
 	IsExpired() bool
 	IsSoftDeleted() bool
+	IsPartial() bool
+	IsLoaded(column string) bool
 
 	// Setters and Getters
 
@@ -25,6 +27,12 @@ type SessionInterface interface {
 	GetUserID() string
 	SetUserID(userID string) SessionInterface
 
+	GetTenantID() string
+	SetTenantID(tenantID string) SessionInterface
+
+	GetMeta(name string) string
+	SetMeta(name string, value string) SessionInterface
+
 	GetIPAddress() string
 	SetIPAddress(ipAddress string) SessionInterface
 
@@ -49,4 +57,13 @@ type SessionInterface interface {
 	GetSoftDeletedAt() string
 	GetSoftDeletedAtCarbon() *carbon.Carbon
 	SetSoftDeletedAt(deletedAt string) SessionInterface
+
+	GetRestoredAt() string
+	SetRestoredAt(restoredAt string) SessionInterface
+
+	GetRestoredBy() string
+	SetRestoredBy(restoredBy string) SessionInterface
+
+	GetRestoreReason() string
+	SetRestoreReason(restoreReason string) SessionInterface
 }
@@ -13,6 +13,13 @@ type SessionOptionsInterface interface {
 	HasUserAgent() bool
 	GetUserAgent() string
 	SetUserAgent(userAgent string)
+
+	HasBindingPolicy() bool
+	GetBindingPolicy() string
+	SetBindingPolicy(bindingPolicy string)
+
+	GetRevokeOnBindingMismatch() bool
+	SetRevokeOnBindingMismatch(revoke bool)
 }
 
 // SessionOptions shortcut for NewSessionOptions
@@ -32,6 +39,41 @@ type sessionOptions struct {
 	properties map[string]any
 }
 
+// HasBindingPolicy returns true if a binding policy is set
+func (s *sessionOptions) HasBindingPolicy() bool {
+	return s.hasProperty("binding_policy")
+}
+
+// GetBindingPolicy returns the binding policy, one of the BINDING_POLICY_* constants
+func (s *sessionOptions) GetBindingPolicy() string {
+	if !s.HasBindingPolicy() {
+		return ""
+	}
+
+	return s.properties["binding_policy"].(string)
+}
+
+// SetBindingPolicy sets how the IP address and user agent are matched
+// against the session. Without a binding policy they are used as exact
+// filters, and a mismatching session is treated as absent.
+func (s *sessionOptions) SetBindingPolicy(bindingPolicy string) {
+	s.properties["binding_policy"] = bindingPolicy
+}
+
+// GetRevokeOnBindingMismatch returns true if a session must be revoked on binding mismatch
+func (s *sessionOptions) GetRevokeOnBindingMismatch() bool {
+	if !s.hasProperty("revoke_on_binding_mismatch") {
+		return false
+	}
+
+	return s.properties["revoke_on_binding_mismatch"].(bool)
+}
+
+// SetRevokeOnBindingMismatch sets whether a session must be revoked on binding mismatch
+func (s *sessionOptions) SetRevokeOnBindingMismatch(revoke bool) {
+	s.properties["revoke_on_binding_mismatch"] = revoke
+}
+
 // HasIPAddress returns true if the session has an IP address
 func (s *sessionOptions) HasIPAddress() bool {
 	return s.hasProperty("ip_address")
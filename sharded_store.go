@@ -0,0 +1,1051 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*shardedStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*shardedStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*shardedStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*shardedStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*shardedStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*shardedStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*shardedStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*shardedStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*shardedStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// shardedStore spreads the sessions over several stores (shards), each
+// session living on the shard its key maps to on a consistent hash ring.
+//
+// Lookups by key go to a single shard, lookups by id or user and the
+// list and count queries fan out to all the shards. The per user session
+// limit of the shards only applies per shard.
+type shardedStore struct {
+	shards              []Shard
+	ring                []shardRingPoint // sorted by hash
+	fallbackToAllShards bool
+
+	userSessionHandleSecret []byte // keys the user session handles
+}
+
+// Shard is one of the stores of a sharded store
+type Shard struct {
+	// Name identifies the shard on the hash ring, it must not change
+	// when shards are added, or most sessions would move
+	Name string
+
+	// Store is the store of the shard
+	Store StoreInterface
+}
+
+// shardRingPoint is a virtual node of a shard on the hash ring
+type shardRingPoint struct {
+	hash  uint64
+	shard int
+}
+
+// NewShardedStoreOptions define the options for creating a new sharded session store
+type NewShardedStoreOptions struct {
+	Shards []Shard
+
+	// VirtualNodes is the number of points of each shard on the hash ring, default 100
+	VirtualNodes int
+
+	// FallbackToAllShards looks up the sessions not found on their shard
+	// on all the other shards, while SessionReshard moves them
+	FallbackToAllShards bool
+
+	// UserSessionHandleSecret keys the HMAC of the handles returned by
+	// UserSessions, required by UserSessions and UserSessionRevoke, which
+	// return ErrUserSessionHandleSecretRequired without it. All the
+	// instances sharing the sessions must set the same secret, kept across
+	// restarts, or the handles stop matching
+	UserSessionHandleSecret string
+}
+
+// == CONSTRUCTOR =============================================================
+
+// NewShardedStore creates a new sharded session store
+func NewShardedStore(opts NewShardedStoreOptions) (*shardedStore, error) {
+	if len(opts.Shards) == 0 {
+		return nil, errors.New("sharded session store: Shards are required")
+	}
+
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = 100
+	}
+
+	names := map[string]bool{}
+
+	for _, shard := range opts.Shards {
+		if shard.Name == "" {
+			return nil, errors.New("sharded session store: shard name is required")
+		}
+
+		if shard.Store == nil {
+			return nil, errors.New("sharded session store: shard " + shard.Name + " has no store")
+		}
+
+		if names[shard.Name] {
+			return nil, errors.New("sharded session store: shard name " + shard.Name + " is duplicated")
+		}
+
+		names[shard.Name] = true
+	}
+
+	store := &shardedStore{
+		shards:              opts.Shards,
+		fallbackToAllShards: opts.FallbackToAllShards,
+
+		userSessionHandleSecret: []byte(opts.UserSessionHandleSecret),
+	}
+
+	for i, shard := range opts.Shards {
+		for v := 0; v < opts.VirtualNodes; v++ {
+			store.ring = append(store.ring, shardRingPoint{
+				hash:  shardHash(shard.Name + "#" + strconv.Itoa(v)),
+				shard: i,
+			})
+		}
+	}
+
+	sort.Slice(store.ring, func(i, j int) bool {
+		return store.ring[i].hash < store.ring[j].hash
+	})
+
+	return store, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate migrates all the shards
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) AutoMigrate(ctx context.Context) error {
+	return store.eachShard(func(_ int, shard StoreInterface) error {
+		return shard.AutoMigrate(ctx)
+	})
+}
+
+// EnableDebug enables the debug mode of all the shards
+//
+// Parameters:
+//   - debug - true to enable, false to disable
+func (store *shardedStore) EnableDebug(debug bool) {
+	for _, shard := range store.shards {
+		shard.Store.EnableDebug(debug)
+	}
+}
+
+// SessionExpiryGoroutine runs the expiry goroutines of all the shards,
+// and returns as soon as one of them returns
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionExpiryGoroutine() error {
+	errs := make(chan error, len(store.shards))
+
+	for _, shard := range store.shards {
+		go func() {
+			errs <- shard.Store.SessionExpiryGoroutine()
+		}()
+	}
+
+	return <-errs
+}
+
+// SessionCount returns the count of sessions matching the query on all the shards
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options
+//
+// Returns:
+//   - int64 - the count of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	if query == nil {
+		return -1, errors.New("sharded session store: session query is nil")
+	}
+
+	counts := make([]int64, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		counts[i], err = shard.SessionCount(ctx, shardedQuery(query))
+		return err
+	})
+
+	if err != nil {
+		return -1, err
+	}
+
+	return lo.Sum(counts), nil
+}
+
+// SessionCreate creates a new session on the shard of its key
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("sessionstore > session create. session cannot be nil")
+	}
+
+	return store.shardOf(session.GetKey()).SessionCreate(ctx, session)
+}
+
+// SessionCreateMany creates sessions on the shards their keys map to,
+// with a SessionCreateMany per shard
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	perShard := make([][]SessionInterface, len(store.shards))
+
+	for _, session := range sessions {
+		if session == nil {
+			return errors.New("sessionstore > session create many. session cannot be nil")
+		}
+
+		i := store.shardIndexOf(session.GetKey())
+		perShard[i] = append(perShard[i], session)
+	}
+
+	return store.eachShard(func(i int, shard StoreInterface) error {
+		if len(perShard[i]) == 0 {
+			return nil
+		}
+
+		return storeCreateMany(ctx, shard, perShard[i])
+	})
+}
+
+// SessionDelete deletes a session
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	return store.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionDeleteByID deletes a session by id, on whichever shard it lives
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionDeleteByID(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return errors.New("session id is empty")
+	}
+
+	return store.eachShard(func(_ int, shard StoreInterface) error {
+		return shard.SessionDeleteByID(ctx, sessionID)
+	})
+}
+
+// SessionDeleteByUserID deletes all the sessions of a user on all the shards
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	counts := make([]int64, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		counts[i], err = storeDeleteByUserID(ctx, shard, userID, exceptSessionID)
+		return err
+	})
+
+	return lo.Sum(counts), err
+}
+
+// SessionDeleteMany deletes the sessions matching the filters of a
+// query from all the shards
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	counts := make([]int64, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		counts[i], err = storeDeleteMany(ctx, shard, query)
+		return err
+	})
+
+	return lo.Sum(counts), err
+}
+
+// SessionExtend extends a session's expiry time by the given seconds
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to extend
+//   - seconds - the number of seconds to extend the session by
+//
+// Returns:
+//   - error - ErrSessionNotFound if the fallback finds it on no shard, nil if successful, otherwise an error
+func (store *shardedStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	shard, err := store.shardOfSession(ctx, session)
+
+	if err != nil {
+		return err
+	}
+
+	return shard.SessionExtend(ctx, session, seconds)
+}
+
+// SessionFindByID finds a session by id, on whichever shard it lives
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	_, session, err := store.findByIDWithShard(ctx, sessionID)
+	return session, err
+}
+
+// SessionFindByKey finds a session by key, on the shard of the key
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	owner := store.shardIndexOf(sessionKey)
+
+	session, err := store.shards[owner].Store.SessionFindByKey(ctx, sessionKey)
+
+	if err != nil || session != nil || !store.fallbackToAllShards {
+		return session, err
+	}
+
+	for i, shard := range store.shards {
+		if i == owner {
+			continue
+		}
+
+		session, err := shard.Store.SessionFindByKey(ctx, sessionKey)
+
+		if err != nil || session != nil {
+			return session, err
+		}
+	}
+
+	return nil, nil
+}
+
+// SessionFlush flushes the buffered writes of all the shards
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionFlush(ctx context.Context) error {
+	return store.eachShard(func(_ int, shard StoreInterface) error {
+		return storeFlush(ctx, shard)
+	})
+}
+
+// SessionList returns a list of sessions matching the query from all
+// the shards, merged, ordered and paginated as a single store would
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options
+//
+// Returns:
+//   - []SessionInterface - list of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	if query == nil {
+		return []SessionInterface{}, errors.New("at session list > session query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return []SessionInterface{}, err
+	}
+
+	lists := make([][]SessionInterface, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		lists[i], err = shard.SessionList(ctx, shardedQuery(query))
+		return err
+	})
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	return sessionsApplyQuery(lo.Flatten(lists), query), nil
+}
+
+// SessionListPage returns a page of the sessions matching the query from
+// all the shards, merged as a single store would, and the cursor of the
+// next page, see store.SessionListPage
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 100)
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	return sessionListPage(ctx, store.SessionList, query)
+}
+
+// SessionIterate calls fn for each session matching the query from all
+// the shards, a page at a time, see store.SessionIterate
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 1000)
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *shardedStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return sessionIterate(ctx, store.SessionListPage, query, fn)
+}
+
+// SessionStats returns statistics of the sessions of all the shards, see
+// store.SessionStats. They are computed in memory, iterating over the
+// sessions, as the users of a shard may hold sessions in the others.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return sessionStatsIterate(ctx, store.SessionIterate, query)
+}
+
+// SessionPromote upgrades a guest session to an authenticated one,
+// moving it to the shard of its regenerated key
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	return sessionPromoteByUpdate(ctx, store, session, userID, mergeStrategy)
+}
+
+// SessionReshard moves the sessions living on another shard than the one
+// their key maps to, i.e. after shards have been added. Run it once with
+// the new set of shards, with FallbackToAllShards enabled meanwhile.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - int64 - the number of moved sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionReshard(ctx context.Context) (int64, error) {
+	const batchSize = 500
+
+	moved := int64(0)
+
+	for i, shard := range store.shards {
+		offset := 0
+
+		for {
+			batch, err := shard.Store.SessionList(ctx, SessionQuery().
+				SetSoftDeletedIncluded(true).
+				SetOrderBy(COLUMN_ID).
+				SetSortOrder(sb.ASC).
+				SetOffset(offset).
+				SetLimit(batchSize))
+
+			if err != nil {
+				return moved, err
+			}
+
+			for _, session := range batch {
+				owner := store.shardIndexOf(session.GetKey())
+
+				if owner == i {
+					offset++ // kept, the moved ones no longer count
+					continue
+				}
+
+				if err := store.sessionMove(ctx, session, shard.Store, store.shards[owner].Store); err != nil {
+					return moved, err
+				}
+
+				moved++
+			}
+
+			if len(batch) < batchSize {
+				break
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// SessionSoftDelete soft deletes a session
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to soft delete
+//
+// Returns:
+//   - error - ErrSessionNotFound if the fallback finds it on no shard, nil if successful, otherwise an error
+func (store *shardedStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	shard, err := store.shardOfSession(ctx, session)
+
+	if err != nil {
+		return err
+	}
+
+	return shard.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByID soft deletes a session by id, on whichever shard it lives
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - error - ErrSessionNotFound if not found, nil if successful, otherwise an error
+func (store *shardedStore) SessionSoftDeleteByID(ctx context.Context, sessionID string) error {
+	shard, session, err := store.findByIDWithShard(ctx, sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	return shard.SessionSoftDelete(ctx, session)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user on all the shards
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	counts := make([]int64, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		counts[i], err = storeSoftDeleteByUserID(ctx, shard, userID, exceptSessionID)
+		return err
+	})
+
+	return lo.Sum(counts), err
+}
+
+// SessionUpdate updates a session. If its key has changed, and maps to
+// another shard, the session is moved to that shard.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to update
+//
+// Returns:
+//   - error - ErrSessionNotFound if the fallback finds it on no shard, nil if successful, otherwise an error
+func (store *shardedStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("sessionstore > session update. session cannot be nil")
+	}
+
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
+	if _, keyChanged := session.DataChanged()[COLUMN_SESSION_KEY]; !keyChanged {
+		shard, err := store.shardOfSession(ctx, session)
+
+		if err != nil {
+			return err
+		}
+
+		return shard.SessionUpdate(ctx, session)
+	}
+
+	owner := store.shardOf(session.GetKey())
+
+	current, existing, err := store.findByIDWithShard(ctx, session.GetID())
+
+	if err != nil {
+		return err
+	}
+
+	if existing == nil || current == owner {
+		return owner.SessionUpdate(ctx, session)
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	moved := session
+
+	if session.IsPartial() {
+		moved = NewSessionFromExistingData(lo.Assign(existing.Data(), session.DataChanged()))
+	}
+
+	if err := store.sessionMove(ctx, moved, current, owner); err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
+
+// SessionUpdateMany sets the fields of the sessions matching the filters
+// of a query on all the shards. The keys cannot be updated in bulk, so
+// the sessions stay on their shards.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	if err := bulkFieldsValidate(fields); err != nil {
+		return 0, err
+	}
+
+	counts := make([]int64, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		counts[i], err = storeUpdateMany(ctx, shard, query, fields)
+		return err
+	})
+
+	return lo.Sum(counts), err
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, on whichever shard it lives
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	_, session, err := store.findWithShard(func(shard StoreInterface) (SessionInterface, error) {
+		return storeFindByIDIncludingDeleted(ctx, shard, sessionID)
+	})
+
+	return session, err
+}
+
+// SessionRestore restores a soft deleted session, on whichever shard it lives
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func (store *shardedStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	shard, session, err := store.findWithShard(func(shard StoreInterface) (SessionInterface, error) {
+		return storeFindByIDIncludingDeleted(ctx, shard, sessionID)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		return ErrSessionNotFound
+	}
+
+	return storeRestore(ctx, shard, sessionID, options)
+}
+
+// UserSessions returns the active sessions of a user, from all the shards
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *shardedStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *shardedStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	_, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+	return err
+}
+
+// PRIVATE METHODS ===========================================================
+
+// eachShard runs fn on all the shards concurrently, and joins their errors
+func (store *shardedStore) eachShard(fn func(index int, shard StoreInterface) error) error {
+	errs := make([]error, len(store.shards))
+
+	var wg sync.WaitGroup
+
+	for i, shard := range store.shards {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, shard.Store)
+		}()
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// findByIDWithShard finds a session by id, and the shard it lives on
+func (store *shardedStore) findByIDWithShard(ctx context.Context, sessionID string) (StoreInterface, SessionInterface, error) {
+	return store.findWithShard(func(shard StoreInterface) (SessionInterface, error) {
+		return shard.SessionFindByID(ctx, sessionID)
+	})
+}
+
+// findWithShard runs a find on all the shards, and returns the first
+// session found, with its shard
+func (store *shardedStore) findWithShard(find func(shard StoreInterface) (SessionInterface, error)) (StoreInterface, SessionInterface, error) {
+	found := make([]SessionInterface, len(store.shards))
+
+	err := store.eachShard(func(i int, shard StoreInterface) error {
+		var err error
+		found[i], err = find(shard)
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, session := range found {
+		if session != nil {
+			return store.shards[i].Store, session, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// sessionMove copies a session to another shard, then deletes it from
+// its current shard. A copy left by an interrupted move is replaced.
+func (store *shardedStore) sessionMove(ctx context.Context, session SessionInterface, from StoreInterface, to StoreInterface) error {
+	if err := to.SessionDeleteByID(ctx, session.GetID()); err != nil {
+		return err
+	}
+
+	if err := to.SessionCreate(ctx, NewSessionFromExistingData(session.Data())); err != nil {
+		return err
+	}
+
+	return from.SessionDeleteByID(ctx, session.GetID())
+}
+
+// shardIndexOf returns the index of the shard a session key maps to
+func (store *shardedStore) shardIndexOf(sessionKey string) int {
+	hash := shardHash(sessionKey)
+
+	i := sort.Search(len(store.ring), func(i int) bool {
+		return store.ring[i].hash >= hash
+	})
+
+	if i == len(store.ring) {
+		i = 0 // wrap around the ring
+	}
+
+	return store.ring[i].shard
+}
+
+// shardOf returns the store of the shard a session key maps to
+func (store *shardedStore) shardOf(sessionKey string) StoreInterface {
+	return store.shards[store.shardIndexOf(sessionKey)].Store
+}
+
+// shardOfSession returns the shard a session lives on. With the fallback
+// to all the shards, a session not yet moved to the shard of its key by
+// a reshard is written on its previous shard.
+func (store *shardedStore) shardOfSession(ctx context.Context, session SessionInterface) (StoreInterface, error) {
+	owner := store.shardOf(session.GetKey())
+
+	if !store.fallbackToAllShards {
+		return owner, nil
+	}
+
+	existing, err := storeFindByIDIncludingDeleted(ctx, owner, session.GetID())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return owner, nil
+	}
+
+	shard, existing, err := store.findWithShard(func(shard StoreInterface) (SessionInterface, error) {
+		return storeFindByIDIncludingDeleted(ctx, shard, session.GetID())
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	return shard, nil
+}
+
+// shardHash hashes a string onto the hash ring. FNV alone leaves similar
+// strings (i.e. the virtual nodes "a#1", "a#2") close together on the
+// ring, so its sum is mixed with the finalizer of MurmurHash3.
+func shardHash(s string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(s))
+
+	sum := hash.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+
+	return sum
+}
+
+// shardedQuery returns the query to send to each shard: the same filters
+// and order, without offset nor projection, and with the limit covering
+// the offset, so that the merged results can be paginated
+//
+// Parameters:
+//   - query - the query of the caller
+//
+// Returns:
+//   - SessionQueryInterface - the query for the shards
+func shardedQuery(query SessionQueryInterface) SessionQueryInterface {
+	shardQuery := SessionQuery()
+
+	if query.HasCreatedAtGte() {
+		shardQuery.SetCreatedAtGte(query.CreatedAtGte())
+	}
+
+	if query.HasCreatedAtLte() {
+		shardQuery.SetCreatedAtLte(query.CreatedAtLte())
+	}
+
+	if query.HasExpiresAtGte() {
+		shardQuery.SetExpiresAtGte(query.ExpiresAtGte())
+	}
+
+	if query.HasExpiresAtLte() {
+		shardQuery.SetExpiresAtLte(query.ExpiresAtLte())
+	}
+
+	if query.HasID() {
+		shardQuery.SetID(query.ID())
+	}
+
+	if query.HasIDIn() {
+		shardQuery.SetIDIn(query.IDIn())
+	}
+
+	if query.HasKey() {
+		shardQuery.SetKey(query.Key())
+	}
+
+	if query.HasUserAgent() {
+		shardQuery.SetUserAgent(query.UserAgent())
+	}
+
+	if query.HasUserID() {
+		shardQuery.SetUserID(query.UserID())
+	}
+
+	if query.HasTenantID() {
+		shardQuery.SetTenantID(query.TenantID())
+	}
+
+	if query.HasUserIpAddress() {
+		shardQuery.SetUserIpAddress(query.UserIpAddress())
+	}
+
+	for name, value := range query.Meta() {
+		shardQuery.SetMeta(name, value)
+	}
+
+	if query.HasUpdatedAtGte() {
+		shardQuery.SetUpdatedAtGte(query.UpdatedAtGte())
+	}
+
+	if query.HasUpdatedAtLte() {
+		shardQuery.SetUpdatedAtLte(query.UpdatedAtLte())
+	}
+
+	if query.HasKeyIn() {
+		shardQuery.SetKeyIn(query.KeyIn())
+	}
+
+	if query.HasUserAgentContains() {
+		shardQuery.SetUserAgentContains(query.UserAgentContains())
+	}
+
+	if query.HasUserIDIn() {
+		shardQuery.SetUserIDIn(query.UserIDIn())
+	}
+
+	if query.HasUserIDNotEmpty() {
+		shardQuery.SetUserIDNotEmpty(query.UserIDNotEmpty())
+	}
+
+	if query.HasUserIpAddressPrefix() {
+		shardQuery.SetUserIpAddressPrefix(query.UserIpAddressPrefix())
+	}
+
+	if query.HasUserIpAddressCIDR() {
+		shardQuery.SetUserIpAddressCIDR(query.UserIpAddressCIDR())
+	}
+
+	if query.HasSoftDeletedOnly() {
+		shardQuery.SetSoftDeletedOnly(query.SoftDeletedOnly())
+	}
+
+	if query.HasExpiredOnly() {
+		shardQuery.SetExpiredOnly(query.ExpiredOnly())
+	}
+
+	if query.HasCursor() {
+		shardQuery.SetCursor(query.Cursor())
+	}
+
+	if query.HasSoftDeletedIncluded() {
+		shardQuery.SetSoftDeletedIncluded(query.SoftDeletedIncluded())
+	}
+
+	if query.HasOrderBy() {
+		shardQuery.SetOrderBy(query.OrderBy())
+	}
+
+	if query.HasSortOrder() {
+		shardQuery.SetSortOrder(query.SortOrder())
+	}
+
+	if query.HasOrderByColumns() {
+		shardQuery.SetOrderByColumns(query.OrderByColumns())
+	}
+
+	if query.HasLimit() && !query.IsCountOnly() {
+		limit := query.Limit()
+
+		if query.HasOffset() {
+			limit += query.Offset()
+		}
+
+		shardQuery.SetLimit(limit)
+	}
+
+	return shardQuery
+}
@@ -0,0 +1,303 @@
+package sessionstore
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/dracory/sb"
+)
+
+func initShard(t *testing.T, name string) Shard {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	db.SetMaxOpenConns(1) // each connection to :memory: is a new database
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return Shard{Name: name, Store: store}
+}
+
+func initShardedStore(t *testing.T, shards []Shard, fallback bool) *shardedStore {
+	store, err := NewShardedStore(NewShardedStoreOptions{
+		Shards:              shards,
+		FallbackToAllShards: fallback,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return store
+}
+
+func TestShardedStore_CreateFindAndList(t *testing.T) {
+	shards := []Shard{initShard(t, "a"), initShard(t, "b"), initShard(t, "c")}
+	store := initShardedStore(t, shards, false)
+	ctx := context.Background()
+
+	sessions := []SessionInterface{}
+
+	for i := 0; i < 30; i++ {
+		session := NewSession().
+			SetUserID("user").
+			SetValue(strconv.Itoa(i)).
+			SetCreatedAt("2026-01-01 00:00:" + strconv.Itoa(10+i))
+
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	for _, shard := range shards {
+		count, err := shard.Store.SessionCount(ctx, SessionQuery())
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if count == 0 {
+			t.Fatal("Expected the sessions to be spread over all the shards, shard " + shard.Name + " is empty")
+		}
+	}
+
+	for _, session := range sessions {
+		found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if found == nil || found.GetID() != session.GetID() {
+			t.Fatal("Expected the session to be found by key, found:", found)
+		}
+	}
+
+	count, err := store.SessionCount(ctx, SessionQuery().SetUserID("user"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 30 {
+		t.Fatal("Expected 30 sessions, found:", count)
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().
+		SetOrderBy(COLUMN_CREATED_AT).
+		SetSortOrder(sb.ASC).
+		SetOffset(5).
+		SetLimit(10).
+		SetColumns([]string{COLUMN_ID}))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 10 {
+		t.Fatal("Expected 10 sessions, found:", len(list))
+	}
+
+	for i, session := range list {
+		if session.GetID() != sessions[5+i].GetID() {
+			t.Fatal("Expected the merged list to be ordered and paginated, wrong session at", i)
+		}
+	}
+}
+
+func TestShardedStore_SessionUpdateMovesSession(t *testing.T) {
+	shards := []Shard{initShard(t, "a"), initShard(t, "b")}
+	store := initShardedStore(t, shards, false)
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("user")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	from := store.shardIndexOf(session.GetKey())
+
+	// regenerate the key until it maps to the other shard
+	newKey := generateSessionKey(100)
+	for store.shardIndexOf(newKey) == from {
+		newKey = generateSessionKey(100)
+	}
+
+	session.SetKey(newKey).SetValue("moved")
+
+	if err := store.SessionUpdate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := shards[from].Store.SessionFindByID(ctx, session.GetID()); found != nil {
+		t.Fatal("Session MUST be removed from its previous shard")
+	}
+
+	found, err := store.SessionFindByKey(ctx, newKey)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetID() != session.GetID() || found.GetValue() != "moved" {
+		t.Fatal("Expected the moved session to be found by its new key, found:", found)
+	}
+
+	if err := store.SessionSoftDeleteByID(ctx, session.GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := store.SessionFindByKey(ctx, newKey); found != nil {
+		t.Fatal("Soft deleted session MUST NOT be found")
+	}
+}
+
+func TestShardedStore_SessionReshard(t *testing.T) {
+	a, b := initShard(t, "a"), initShard(t, "b")
+	ctx := context.Background()
+
+	before := initShardedStore(t, []Shard{a, b}, false)
+
+	keys := []string{}
+
+	for i := 0; i < 40; i++ {
+		session := NewSession()
+
+		if err := before.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		keys = append(keys, session.GetKey())
+	}
+
+	after := initShardedStore(t, []Shard{a, b, initShard(t, "c")}, true)
+
+	// while resharding, the sessions are found on their previous shard
+	for _, key := range keys {
+		if found, err := after.SessionFindByKey(ctx, key); err != nil || found == nil {
+			t.Fatal("Expected the session to be found with the fallback, error:", err)
+		}
+	}
+
+	moved, err := after.SessionReshard(ctx)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if moved == 0 || moved == int64(len(keys)) {
+		t.Fatal("Expected some, but not all, sessions to move to the new shard, moved:", moved)
+	}
+
+	after.fallbackToAllShards = false
+
+	for _, key := range keys {
+		if found, err := after.SessionFindByKey(ctx, key); err != nil || found == nil {
+			t.Fatal("Expected the session to be found on its new shard, error:", err)
+		}
+	}
+
+	count, err := after.SessionCount(ctx, SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != int64(len(keys)) {
+		t.Fatal("Expected", len(keys), "sessions after resharding, found:", count)
+	}
+}
+
+func TestShardedStore_WritesDuringReshard(t *testing.T) {
+	a, b := initShard(t, "a"), initShard(t, "b")
+	ctx := context.Background()
+
+	before := initShardedStore(t, []Shard{a, b}, false)
+
+	sessions := []SessionInterface{}
+
+	for i := 0; i < 40; i++ {
+		session := NewSession().SetUserID("user")
+
+		if err := before.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	c := initShard(t, "c")
+	after := initShardedStore(t, []Shard{a, b, c}, true)
+
+	// the sessions whose key now maps to the new shard still live on their previous shard
+	stale := []SessionInterface{}
+
+	for _, session := range sessions {
+		if after.shardOf(session.GetKey()) == c.Store {
+			stale = append(stale, session)
+		}
+	}
+
+	if len(stale) < 3 {
+		t.Fatal("Expected at least 3 sessions to map to the new shard, found:", len(stale))
+	}
+
+	if err := after.SessionUpdate(ctx, stale[0].SetValue("updated")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expiresAt := datetimeNormalize(stale[1].GetExpiresAt())
+
+	if err := after.SessionExtend(ctx, stale[1], 86400); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := after.SessionSoftDelete(ctx, stale[2]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	updated, err := after.SessionFindByKey(ctx, stale[0].GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated == nil || updated.GetValue() != "updated" {
+		t.Fatal("Expected the session to be updated on its previous shard, found:", updated)
+	}
+
+	extended, err := after.SessionFindByKey(ctx, stale[1].GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if extended == nil || datetimeNormalize(extended.GetExpiresAt()) <= expiresAt {
+		t.Fatal("Expected the session to be extended on its previous shard, found:", extended)
+	}
+
+	if deleted, err := after.SessionFindByKey(ctx, stale[2].GetKey()); err != nil || deleted != nil {
+		t.Fatal("Expected the session to be soft deleted on its previous shard, error:", err)
+	}
+
+	if err := after.SessionExtend(ctx, NewSession(), 3600); err != ErrSessionNotFound {
+		t.Fatal("Expected ErrSessionNotFound for a session on no shard, found:", err)
+	}
+}
@@ -1,11 +1,60 @@
 package sessionstore
 
 import (
+	"strings"
+
 	"github.com/dracory/sb"
+	"github.com/samber/lo"
 )
 
-// SQLCreateTable returns a SQL string for creating the cache table
+// sessionTableIndex defines an index of the session table
+type sessionTableIndex struct {
+	name    string
+	columns []string
+	unique  bool
+
+	// migration is the version of the migration creating the index
+	migration int
+}
+
+// sessionTableColumns returns the columns of the session table, without
+// the meta columns
+func sessionTableColumns() []string {
+	return []string{
+		COLUMN_ID,
+		COLUMN_SESSION_KEY,
+		COLUMN_USER_ID,
+		COLUMN_TENANT_ID,
+		COLUMN_IP_ADDRESS,
+		COLUMN_USER_AGENT,
+		COLUMN_SESSION_VALUE,
+		COLUMN_EXPIRES_AT,
+		COLUMN_CREATED_AT,
+		COLUMN_UPDATED_AT,
+		COLUMN_SOFT_DELETED_AT,
+		COLUMN_RESTORED_AT,
+		COLUMN_RESTORED_BY,
+		COLUMN_RESTORE_REASON,
+	}
+}
+
+// SQLCreateTable returns a SQL string for creating the session table, as
+// created by the first migration. Later columns are added by migrations.
+//
+// On Postgres the datetimes are TIMESTAMPTZ, and the value is JSONB if
+// ValueColumnJSONB is enabled.
 func (store *store) SQLCreateTable() string {
+	datetimeType := sb.COLUMN_TYPE_DATETIME
+	valueType := sb.COLUMN_TYPE_TEXT
+
+	if store.dbDriverName == sb.DIALECT_POSTGRES {
+		datetimeType = "TIMESTAMPTZ"
+	}
+
+	if store.valueColumnJSONB {
+		valueType = "JSONB"
+	}
+
 	sql := sb.NewBuilder(store.dbDriverName).
 		Table(store.sessionTableName).
 		Column(sb.Column{
@@ -35,23 +84,209 @@ func (store *store) SQLCreateTable() string {
 			Length: 1024,
 		}).
 		Column(sb.Column{
-			Name: COLUMN_SESSION_VALUE,
-			Type: sb.COLUMN_TYPE_TEXT,
+			Name:     COLUMN_SESSION_VALUE,
+			Type:     valueType,
+			Nullable: store.valueColumnJSONB, // empty values are stored as NULL
 		}).
 		Column(sb.Column{
 			Name: COLUMN_EXPIRES_AT,
-			Type: sb.COLUMN_TYPE_DATETIME,
+			Type: datetimeType,
 		}).
 		Column(sb.Column{
 			Name: COLUMN_CREATED_AT,
-			Type: sb.COLUMN_TYPE_DATETIME,
+			Type: datetimeType,
 		}).
 		Column(sb.Column{
 			Name: COLUMN_UPDATED_AT,
-			Type: sb.COLUMN_TYPE_DATETIME,
+			Type: datetimeType,
 		}).
 		Column(sb.Column{
 			Name: COLUMN_SOFT_DELETED_AT,
+			Type: datetimeType,
+		}).
+		CreateIfNotExists()
+
+	return sql
+}
+
+// SQLCreateChangeLogTable returns a SQL string for creating the change log table
+func (store *store) SQLCreateChangeLogTable() string {
+	sql := sb.NewBuilder(store.dbDriverName).
+		Table(store.changeLogTableName).
+		Column(sb.Column{
+			Name:       COLUMN_ID,
+			Type:       sb.COLUMN_TYPE_STRING,
+			Length:     40,
+			PrimaryKey: true,
+		}).
+		Column(sb.Column{
+			Name:   COLUMN_OPERATION,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 20,
+		}).
+		Column(sb.Column{
+			Name:   COLUMN_SESSION_ID,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		}).
+		Column(sb.Column{
+			Name:   COLUMN_USER_ID,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 40,
+		}).
+		Column(sb.Column{
+			Name: COLUMN_OCCURRED_AT,
+			Type: sb.COLUMN_TYPE_DATETIME,
+		}).
+		CreateIfNotExists()
+
+	return sql
+}
+
+// SQLCreateIndexes returns the SQL strings for creating the indexes of
+// the session table, a unique index on the session key, and indexes on
+// the expiry (for the sweep), on the user id and on the tenant id
+func (store *store) SQLCreateIndexes() []string {
+	sqls := []string{}
+
+	for _, index := range store.sessionTableIndexes() {
+		sqls = append(sqls, store.sqlCreateIndex(index))
+	}
+
+	return sqls
+}
+
+// sessionTableIndexes returns the indexes of the session table, the
+// names are prefixed with the table name, as on Postgres index names
+// are unique per schema
+func (store *store) sessionTableIndexes() []sessionTableIndex {
+	return []sessionTableIndex{
+		{
+			name:      store.sessionTableName + "_" + COLUMN_SESSION_KEY + "_uindex",
+			columns:   []string{COLUMN_SESSION_KEY},
+			unique:    true,
+			migration: 2,
+		},
+		{
+			name:      store.sessionTableName + "_" + COLUMN_EXPIRES_AT + "_index",
+			columns:   []string{COLUMN_EXPIRES_AT},
+			migration: 2,
+		},
+		{
+			name:      store.sessionTableName + "_" + COLUMN_USER_ID + "_index",
+			columns:   []string{COLUMN_USER_ID},
+			migration: 2,
+		},
+		{
+			name:      store.sessionTableName + "_" + COLUMN_TENANT_ID + "_index",
+			columns:   []string{COLUMN_TENANT_ID, COLUMN_USER_ID},
+			migration: 3,
+		},
+	}
+}
+
+// sqlCreateIndex returns a SQL string for creating an index of the session table
+func (store *store) sqlCreateIndex(index sessionTableIndex) string {
+	if index.unique {
+		return store.sqlCreateUniqueIndex(index)
+	}
+
+	return sb.NewBuilder(store.dbDriverName).
+		Table(store.sessionTableName).
+		CreateIndex(index.name, index.columns...)
+}
+
+// sqlCreateUniqueIndex returns a SQL string for creating a unique index
+// of the session table, which the builder does not support
+func (store *store) sqlCreateUniqueIndex(index sessionTableIndex) string {
+	columns := lo.Map(index.columns, func(column string, _ int) string {
+		return store.sqlQuote(column)
+	})
+
+	return "CREATE UNIQUE INDEX " + store.sqlQuote(index.name) + " ON " + store.sqlQuote(store.sessionTableName) + " (" + strings.Join(columns, ",") + ");"
+}
+
+// sqlSessionKeysDeduplicate returns a SQL string for deleting the sessions
+// sharing their key with a more recently updated one
+func (store *store) sqlSessionKeysDeduplicate() string {
+	table := store.sqlQuote(store.sessionTableName)
+	id := store.sqlQuote(COLUMN_ID)
+
+	return "DELETE FROM " + table + " WHERE " + id + " IN (" +
+		"SELECT " + id + " FROM (" +
+		"SELECT " + id + ", ROW_NUMBER() OVER (PARTITION BY " + store.sqlQuote(COLUMN_SESSION_KEY) +
+		" ORDER BY " + store.sqlQuote(COLUMN_UPDATED_AT) + " DESC, " + id + " DESC) AS " + store.sqlQuote("duplicate_number") +
+		" FROM " + table + ") " + store.sqlQuote("ranked") +
+		" WHERE " + store.sqlQuote("duplicate_number") + " > 1);"
+}
+
+// sqlQuote quotes a table, column or index name, as the builder does
+func (store *store) sqlQuote(name string) string {
+	switch store.dbDriverName {
+	case sb.DIALECT_MYSQL:
+		return "`" + name + "`"
+	case sb.DIALECT_MSSQL:
+		return "[" + name + "]"
+	default:
+		return `"` + name + `"`
+	}
+}
+
+// sqlDropIndex returns a SQL string for dropping an index of the session
+// table, MySQL and SQL Server name the table too
+func (store *store) sqlDropIndex(index sessionTableIndex) string {
+	switch store.dbDriverName {
+	case sb.DIALECT_MYSQL, sb.DIALECT_MSSQL:
+		return "DROP INDEX " + store.sqlQuote(index.name) + " ON " + store.sqlQuote(store.sessionTableName) + ";"
+	default:
+		return "DROP INDEX " + store.sqlQuote(index.name) + ";"
+	}
+}
+
+// sqlAddColumn returns a SQL string for adding a column to the session
+// table, with a default value for the existing rows
+func (store *store) sqlAddColumn(column sb.Column, defaultValue string) (string, error) {
+	sql, err := sb.NewBuilder(store.dbDriverName).TableColumnAdd(store.sessionTableName, column)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(sql, ";") + " DEFAULT '" + strings.ReplaceAll(defaultValue, "'", "''") + "';", nil
+}
+
+// sqlDropColumn returns a SQL string for dropping a column of the session table
+func (store *store) sqlDropColumn(columnName string) (string, error) {
+	return sb.NewBuilder(store.dbDriverName).TableColumnDrop(store.sessionTableName, columnName)
+}
+
+// sqlAlterDatetimeColumn returns a SQL string for changing the type of a
+// datetime column of the session table on Postgres, between TIMESTAMP and
+// TIMESTAMPTZ. The TIMESTAMP values are UTC times.
+func (store *store) sqlAlterDatetimeColumn(columnName string, columnType string) string {
+	return "ALTER TABLE " + store.sqlQuote(store.sessionTableName) +
+		" ALTER COLUMN " + store.sqlQuote(columnName) +
+		" TYPE " + columnType +
+		" USING " + store.sqlQuote(columnName) + " AT TIME ZONE 'UTC';"
+}
+
+// SQLCreateMigrationTable returns a SQL string for creating the table
+// recording the applied schema migrations
+func (store *store) SQLCreateMigrationTable() string {
+	sql := sb.NewBuilder(store.dbDriverName).
+		Table(store.migrationTableName).
+		Column(sb.Column{
+			Name:       COLUMN_VERSION,
+			Type:       sb.COLUMN_TYPE_INTEGER,
+			PrimaryKey: true,
+		}).
+		Column(sb.Column{
+			Name:   COLUMN_NAME,
+			Type:   sb.COLUMN_TYPE_STRING,
+			Length: 100,
+		}).
+		Column(sb.Column{
+			Name: COLUMN_APPLIED_AT,
 			Type: sb.COLUMN_TYPE_DATETIME,
 		}).
 		CreateIfNotExists()
@@ -0,0 +1,222 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// StatsQuery defines the statistics returned by SessionStats
+type StatsQuery struct {
+	// Query filters the sessions counted (i.e. by tenant or creation
+	// time), optional. It cannot be paginated or sorted
+	Query SessionQueryInterface
+
+	// CreatedPer counts the sessions created per STATS_PERIOD_HOUR or
+	// STATS_PERIOD_DAY (UTC), empty to skip
+	CreatedPer string
+
+	// TopLimit is the number of top user agents and IP addresses of the
+	// active sessions, 0 to skip
+	TopLimit int
+}
+
+// SessionStats are the statistics of the sessions, see SessionStats
+type SessionStats struct {
+	// ActiveSessions is the number of sessions neither expired nor soft deleted
+	ActiveSessions int64 `json:"active_sessions"`
+
+	// ActiveUsers is the number of distinct users of the active sessions
+	ActiveUsers int64 `json:"active_users"`
+
+	// AuthenticatedSessions is the number of active sessions with a user
+	AuthenticatedSessions int64 `json:"authenticated_sessions"`
+
+	// AnonymousSessions is the number of active sessions without a user
+	AnonymousSessions int64 `json:"anonymous_sessions"`
+
+	// CreatedPerPeriod is the number of sessions created per period, in
+	// ascending order of period, the periods without sessions are omitted
+	CreatedPerPeriod []SessionStatsCount `json:"created_per_period,omitempty"`
+
+	// TopUserAgents are the most frequent user agents of the active sessions
+	TopUserAgents []SessionStatsCount `json:"top_user_agents,omitempty"`
+
+	// TopIPAddresses are the most frequent IP addresses of the active sessions
+	TopIPAddresses []SessionStatsCount `json:"top_ip_addresses,omitempty"`
+}
+
+// SessionStatsCount is the number of sessions with a value, i.e. a user
+// agent, or a period formatted as "YYYY-MM-DD HH:00:00" per hour and
+// "YYYY-MM-DD" per day
+type SessionStatsCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// statsQueryValidate validates the statistics query, and returns the
+// session query, all the sessions if not set
+//
+// Parameters:
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionQueryInterface - the session query
+//   - error - nil if valid, otherwise an error
+func statsQueryValidate(query StatsQuery) (SessionQueryInterface, error) {
+	if query.CreatedPer != "" && !lo.Contains([]string{STATS_PERIOD_HOUR, STATS_PERIOD_DAY}, query.CreatedPer) {
+		return nil, errors.New("stats query: CreatedPer " + query.CreatedPer + " is not supported")
+	}
+
+	if query.TopLimit < 0 {
+		return nil, errors.New("stats query: TopLimit cannot be negative")
+	}
+
+	sessionQuery := query.Query
+
+	if sessionQuery == nil {
+		return SessionQuery(), nil
+	}
+
+	if err := sessionQuery.Validate(); err != nil {
+		return nil, err
+	}
+
+	if sessionQuery.HasLimit() || sessionQuery.HasOffset() || sessionQuery.HasCursor() || sessionQuery.HasOrderBy() || sessionQuery.HasOrderByColumns() {
+		return nil, errors.New("stats query: the session query cannot be paginated or sorted")
+	}
+
+	return sessionQuery, nil
+}
+
+// sessionStatsIterate computes the statistics in memory, iterating over
+// the sessions, for the stores which cannot aggregate in SQL
+//
+// Parameters:
+//   - ctx - the context
+//   - iterate - the SessionIterate function of the store
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func sessionStatsIterate(ctx context.Context, iterate func(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error, query StatsQuery) (SessionStats, error) {
+	stats := SessionStats{}
+
+	sessionQuery, err := statsQueryValidate(query)
+
+	if err != nil {
+		return stats, err
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	users := map[string]bool{}
+	periods := map[string]int64{}
+	userAgents := map[string]int64{}
+	ipAddresses := map[string]int64{}
+
+	err = iterate(ctx, sessionQuery, func(session SessionInterface) error {
+		if query.CreatedPer != "" {
+			periods[statsPeriod(session.GetCreatedAt(), query.CreatedPer)]++
+		}
+
+		if datetimeNormalize(session.GetExpiresAt()) <= now || datetimeNormalize(session.GetSoftDeletedAt()) <= now {
+			return nil // not active
+		}
+
+		stats.ActiveSessions++
+
+		if session.GetUserID() == "" {
+			stats.AnonymousSessions++
+		} else {
+			stats.AuthenticatedSessions++
+			users[session.GetUserID()] = true
+		}
+
+		if query.TopLimit > 0 {
+			userAgents[session.GetUserAgent()]++
+			ipAddresses[session.GetIPAddress()]++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return SessionStats{}, err
+	}
+
+	stats.ActiveUsers = int64(len(users))
+
+	if query.CreatedPer != "" {
+		stats.CreatedPerPeriod = statsCounts(periods)
+
+		sort.Slice(stats.CreatedPerPeriod, func(i, j int) bool {
+			return stats.CreatedPerPeriod[i].Value < stats.CreatedPerPeriod[j].Value
+		})
+	}
+
+	if query.TopLimit > 0 {
+		stats.TopUserAgents = statsTop(userAgents, query.TopLimit)
+		stats.TopIPAddresses = statsTop(ipAddresses, query.TopLimit)
+	}
+
+	return stats, nil
+}
+
+// statsPeriod returns the period of a datetime, "YYYY-MM-DD HH:00:00"
+// per hour and "YYYY-MM-DD" per day
+func statsPeriod(datetime string, per string) string {
+	datetime = datetimeNormalize(datetime)
+
+	if len(datetime) < 13 {
+		return datetime
+	}
+
+	if per == STATS_PERIOD_DAY {
+		return datetime[:10]
+	}
+
+	return datetime[:13] + ":00:00"
+}
+
+// statsCounts returns the counts of a map, in no particular order
+func statsCounts(counts map[string]int64) []SessionStatsCount {
+	return lo.MapToSlice(counts, func(value string, count int64) SessionStatsCount {
+		return SessionStatsCount{Value: value, Count: count}
+	})
+}
+
+// statsTop returns the most frequent values of a map, by descending
+// count then ascending value, as the SQL store orders them
+func statsTop(counts map[string]int64, limit int) []SessionStatsCount {
+	top := statsCounts(counts)
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+
+		return top[i].Value < top[j].Value
+	})
+
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	return top
+}
+
+// storeStats aggregates sessions with SessionStats if the store
+// implements StatsStoreInterface, otherwise by iterating them
+func storeStats(ctx context.Context, st StoreInterface, query StatsQuery) (SessionStats, error) {
+	if stats, ok := st.(StatsStoreInterface); ok {
+		return stats.SessionStats(ctx, query)
+	}
+
+	return sessionStatsIterate(ctx, func(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+		return storeIterate(ctx, st, query, fn)
+	}, query)
+}
@@ -16,6 +16,7 @@ import (
 	_ "github.com/doug-martin/goqu/v9/dialect/postgres"  // importing postgres dialect
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"   // importing sqlite3 dialect
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlserver" // importing sqlserver dialect
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/dracory/database"
 	"github.com/dracory/sb"
 	"github.com/dromara/carbon/v2"
@@ -26,7 +27,15 @@ import (
 
 // == INTERFACE ===============================================================
 
-var _ StoreInterface = (*store)(nil) // verify it extends the store interface
+var _ StoreInterface = (*store)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*store)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*store)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*store)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*store)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*store)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*store)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*store)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*store)(nil) // verify it extends the user sessions store interface
 
 // == TYPE ====================================================================
 
@@ -39,11 +48,34 @@ type store struct {
 	automigrateEnabled bool
 	debugEnabled       bool
 	sqlLogger          *slog.Logger
+	maxSessionsPerUser int
+	evictionPolicy     string
+	eventHandler       SessionEventHandler
+
+	changeNotificationsEnabled bool
+	changeLogTableName         string
+	changeLogRetentionSeconds  int64
+
+	writeBehindInterval time.Duration
+	writeBehind         *writeBehindBuffer
+
+	valueColumnJSONB bool
+
+	migrationTableName string
+
+	// metaColumns are the extra columns of the session table, see MetaColumn
+	metaColumns []MetaColumn
+
+	// tenantIDs are the tenants of a view returned by ForTenant, empty for the store
+	tenantIDs []string
+
+	userSessionHandleSecret []byte // keys the user session handles
 }
 
 // PUBLIC METHODS ============================================================
 
-// AutoMigrate creates the session table if it does not exist
+// AutoMigrate applies the pending schema migrations, see Migrate, and
+// creates the change log table if change notifications are enabled
 //
 // Parameters:
 //   - ctx - the context
@@ -51,17 +83,19 @@ type store struct {
 // Returns:
 //   - error - nil if successful, otherwise an error
 func (store *store) AutoMigrate(ctx context.Context) error {
-	sqlStr := store.SQLCreateTable()
+	if store.db == nil {
+		return errors.New("session store: database is nil")
+	}
 
-	if sqlStr == "" {
-		return errors.New("session store: table create sql is empty")
+	if err := store.Migrate(ctx); err != nil {
+		return err
 	}
 
-	if store.db == nil {
-		return errors.New("session store: database is nil")
+	if !store.changeNotificationsEnabled {
+		return nil
 	}
 
-	_, err := database.Execute(database.Context(ctx, store.db), sqlStr)
+	_, err := database.Execute(database.Context(ctx, store.db), store.SQLCreateChangeLogTable())
 
 	if err != nil {
 		return err
@@ -105,7 +139,7 @@ func (st *store) SessionExpiryGoroutine() error {
 
 		sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
 			From(st.sessionTableName).
-			Where(goqu.C(COLUMN_EXPIRES_AT).Lt(time.Now())).
+			Where(st.tenantScope(goqu.C(COLUMN_EXPIRES_AT).Lt(time.Now()))...).
 			Delete().
 			Prepared(true).
 			ToSQL()
@@ -132,6 +166,12 @@ func (st *store) SessionExpiryGoroutine() error {
 			return nil
 		}
 
+		if st.changeNotificationsEnabled {
+			if err := st.changeLogPrune(context.Background()); err != nil {
+				log.Println("Session Store. ExpireSessionGoroutine. Change log prune error: ", err)
+			}
+		}
+
 		time.Sleep(60 * time.Second) // Every minute
 	}
 }
@@ -157,21 +197,15 @@ func (store *store) Extend(ctx context.Context, sessionKey string, seconds int64
 		return errors.New("session not found")
 	}
 
-	expiresAt := carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC)
-
-	session.SetExpiresAt(expiresAt)
-
-	err := store.SessionUpdate(ctx, session)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return store.SessionExtend(ctx, session, seconds)
 }
 
 // Delete deletes a session.
 //
+// Under a binding policy the session is resolved like FindByKey does, so
+// a session accepted by Has and Get can be deleted from a moved IP
+// address or an updated browser, and is then deleted by id.
+//
 // Parameters:
 //   - ctx - the context
 //   - sessionKey - the session key
@@ -180,6 +214,20 @@ func (store *store) Extend(ctx context.Context, sessionKey string, seconds int64
 // Returns:
 //   - error - nil if successful, otherwise an error
 func (st *store) Delete(ctx context.Context, sessionKey string, options SessionOptionsInterface) error {
+	if options.HasBindingPolicy() {
+		session, err := st.findByKeyWithBinding(ctx, sessionKey, options)
+
+		if err != nil {
+			return err
+		}
+
+		if session == nil {
+			return nil
+		}
+
+		return st.SessionDeleteByID(ctx, session.GetID())
+	}
+
 	wheres := []goqu.Expression{
 		goqu.C(COLUMN_SESSION_KEY).Eq(sessionKey),
 	}
@@ -196,6 +244,8 @@ func (st *store) Delete(ctx context.Context, sessionKey string, options SessionO
 		wheres = append(wheres, goqu.C(COLUMN_IP_ADDRESS).Eq(options.GetIPAddress()))
 	}
 
+	wheres = st.tenantScope(wheres...)
+
 	sqlStr, sqlParams, err := goqu.Dialect(st.dbDriverName).
 		From(st.sessionTableName).
 		Where(wheres...).
@@ -211,7 +261,19 @@ func (st *store) Delete(ctx context.Context, sessionKey string, options SessionO
 		log.Println(sqlStr)
 	}
 
-	_, err = st.db.Exec(sqlStr, sqlParams...)
+	err = st.runInTransactionIf(ctx, st.changeNotificationsEnabled, func(qctx database.QueryableContext) error {
+		changes, err := st.changesForWhere(qctx, CHANGE_OPERATION_DELETE, wheres...)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := database.Execute(qctx, sqlStr, sqlParams...); err != nil {
+			return err
+		}
+
+		return st.changesPublish(qctx, changes...)
+	})
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -244,6 +306,10 @@ func (store *store) FindByKey(ctx context.Context, sessionKey string, options Se
 		return nil, errors.New("session store > find by key: session key is required")
 	}
 
+	if options.HasBindingPolicy() {
+		return store.findByKeyWithBinding(ctx, sessionKey, options)
+	}
+
 	query := SessionQuery().
 		SetKey(sessionKey).
 		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
@@ -274,6 +340,60 @@ func (store *store) FindByKey(ctx context.Context, sessionKey string, options Se
 	return nil, nil
 }
 
+// findByKeyWithBinding finds a session by key, and validates the IP address
+// and user agent in the options according to the options' binding policy.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//   - options - the session options
+//
+// Returns:
+//   - SessionInterface - the found session, nil on mismatch
+//   - error - *ErrBindingMismatch on mismatch, nil if successful, otherwise an error
+func (store *store) findByKeyWithBinding(ctx context.Context, sessionKey string, options SessionOptionsInterface) (SessionInterface, error) {
+	if !isBindingPolicySupported(options.GetBindingPolicy()) {
+		return nil, errors.New("session store > find by key: binding policy " + options.GetBindingPolicy() + " is not supported")
+	}
+
+	query := SessionQuery().
+		SetKey(sessionKey).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetLimit(1)
+
+	if options.HasUserID() {
+		query.SetUserID(options.GetUserID())
+	}
+
+	list, err := store.SessionList(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) < 1 {
+		return nil, nil
+	}
+
+	mismatch := sessionBindingCheck(list[0], options)
+
+	if mismatch == nil {
+		return list[0], nil
+	}
+
+	if options.GetRevokeOnBindingMismatch() {
+		if err := store.SessionDeleteByID(ctx, list[0].GetID()); err != nil {
+			return nil, errors.Join(mismatch, err)
+		}
+
+		mismatch.Revoked = true
+
+		store.emitRevokedEvents(ctx, list[0].GetUserID(), []string{list[0].GetID()})
+	}
+
+	return nil, mismatch
+}
+
 // Get is a shortcut for getting the value of a session, or a default value if not found
 //
 // # It is a convenience method for getting the value of a session wrapping
@@ -380,6 +500,16 @@ func (store *store) Has(ctx context.Context, sessionKey string, options SessionO
 		return false, errors.New("session store > find by key: session key is required")
 	}
 
+	if options.HasBindingPolicy() {
+		session, err := store.FindByKey(ctx, sessionKey, options)
+
+		if err != nil {
+			return false, err
+		}
+
+		return session != nil, nil
+	}
+
 	query := SessionQuery().
 		SetKey(sessionKey).
 		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
@@ -466,7 +596,7 @@ func (store *store) SessionCount(ctx context.Context, query SessionQueryInterfac
 		log.Println(sqlStr)
 	}
 
-	mapped, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, params...)
+	mapped, err := database.SelectToMapString(store.toQueryableContext(ctx), sqlStr, params...)
 
 	if err != nil {
 		return -1, err
@@ -501,24 +631,8 @@ func (st *store) SessionCreate(ctx context.Context, session SessionInterface) er
 		return errors.New("sessionstore > session create. session cannot be nil")
 	}
 
-	if session.GetKey() == "" {
-		return errors.New("sessionstore > session create. key cannot be empty")
-	}
-
-	if session.GetExpiresAt() == "" {
-		return errors.New("sessionstore > session create. expires at cannot be empty")
-	}
-
-	if session.GetCreatedAt() == "" {
-		session.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
-	}
-
-	if session.GetUpdatedAt() == "" {
-		session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
-	}
-
-	if session.GetSoftDeletedAt() == "" {
-		session.SetSoftDeletedAt(sb.MAX_DATETIME)
+	if err := st.sessionCreatePrepare(session); err != nil {
+		return err
 	}
 
 	data := session.Data()
@@ -526,7 +640,7 @@ func (st *store) SessionCreate(ctx context.Context, session SessionInterface) er
 	sqlStr, sqlParams, sqlErr := goqu.Dialect(st.dbDriverName).
 		Insert(st.sessionTableName).
 		Prepared(true).
-		Rows(data).
+		Rows(st.sqlRecord(data)).
 		ToSQL()
 
 	if sqlErr != nil {
@@ -535,7 +649,28 @@ func (st *store) SessionCreate(ctx context.Context, session SessionInterface) er
 
 	st.logSql("create", sqlStr, sqlParams)
 
-	_, err := st.db.Exec(sqlStr, sqlParams...)
+	evictedIDs := []string{}
+
+	transactionRequired := st.isSessionLimitApplicable(session.GetUserID()) || st.changeNotificationsEnabled
+
+	err := st.runInTransactionIf(ctx, transactionRequired, func(qctx database.QueryableContext) error {
+		var errEnforce error
+		evictedIDs, errEnforce = st.sessionLimitEnforce(qctx, session.GetUserID(), session.GetID())
+
+		if errEnforce != nil {
+			return errEnforce
+		}
+
+		if _, err := database.Execute(qctx, sqlStr, sqlParams...); err != nil {
+			return err
+		}
+
+		return st.changesPublish(qctx, SessionChange{
+			Operation: CHANGE_OPERATION_CREATE,
+			SessionID: session.GetID(),
+			UserID:    session.GetUserID(),
+		})
+	})
 
 	if err != nil {
 		return err
@@ -543,9 +678,47 @@ func (st *store) SessionCreate(ctx context.Context, session SessionInterface) er
 
 	session.MarkAsNotDirty()
 
+	st.emitRevokedEvents(ctx, session.GetUserID(), evictedIDs)
+
 	return nil
 }
 
+// sessionCreatePrepare validates a session to create, and sets the
+// defaults of its times and its tenant
+//
+// Parameters:
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if valid, otherwise an error
+func (st *store) sessionCreatePrepare(session SessionInterface) error {
+	if session.GetKey() == "" {
+		return errors.New("sessionstore > session create. key cannot be empty")
+	}
+
+	if session.GetExpiresAt() == "" {
+		return errors.New("sessionstore > session create. expires at cannot be empty")
+	}
+
+	if session.GetCreatedAt() == "" {
+		session.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetUpdatedAt() == "" {
+		session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	}
+
+	if session.GetSoftDeletedAt() == "" {
+		session.SetSoftDeletedAt(sb.MAX_DATETIME)
+	}
+
+	if err := st.metaColumnsCheck(session.Data()); err != nil {
+		return err
+	}
+
+	return st.tenantAssign(session)
+}
+
 // SessionDelete deletes a session.
 //
 // Parameters:
@@ -586,7 +759,7 @@ func (store *store) SessionDeleteByID(ctx context.Context, id string) error {
 	sqlStr, params, errSql := goqu.Dialect(store.dbDriverName).
 		Delete(store.sessionTableName).
 		Prepared(true).
-		Where(goqu.C(COLUMN_ID).Eq(id)).
+		Where(store.tenantScope(goqu.C(COLUMN_ID).Eq(id))...).
 		ToSQL()
 
 	if errSql != nil {
@@ -595,9 +768,16 @@ func (store *store) SessionDeleteByID(ctx context.Context, id string) error {
 
 	store.logSql("delete", sqlStr, params...)
 
-	_, err := store.db.Exec(sqlStr, params...)
+	return store.runInTransactionIf(ctx, store.changeNotificationsEnabled, func(qctx database.QueryableContext) error {
+		if _, err := database.Execute(qctx, sqlStr, params...); err != nil {
+			return err
+		}
 
-	return err
+		return store.changesPublish(qctx, SessionChange{
+			Operation: CHANGE_OPERATION_DELETE,
+			SessionID: id,
+		})
+	})
 }
 
 // SessionDeleteByKey deletes a session by key.
@@ -615,7 +795,7 @@ func (store *store) SessionDeleteByKey(sessionKey string) error {
 	sqlStr, params, errSql := goqu.Dialect(store.dbDriverName).
 		Delete(store.sessionTableName).
 		Prepared(true).
-		Where(goqu.C(COLUMN_SESSION_KEY).Eq(sessionKey)).
+		Where(store.tenantScope(goqu.C(COLUMN_SESSION_KEY).Eq(sessionKey))...).
 		ToSQL()
 
 	if errSql != nil {
@@ -624,9 +804,19 @@ func (store *store) SessionDeleteByKey(sessionKey string) error {
 
 	store.logSql("delete", sqlStr, params...)
 
-	_, err := store.db.Exec(sqlStr, params...)
+	return store.runInTransactionIf(context.Background(), store.changeNotificationsEnabled, func(qctx database.QueryableContext) error {
+		changes, err := store.changesForWhere(qctx, CHANGE_OPERATION_DELETE, store.tenantScope(goqu.C(COLUMN_SESSION_KEY).Eq(sessionKey))...)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := database.Execute(qctx, sqlStr, params...); err != nil {
+			return err
+		}
 
-	return err
+		return store.changesPublish(qctx, changes...)
+	})
 }
 
 // SessionExtend extends a session's expiry time by the given seconds.
@@ -643,10 +833,16 @@ func (store *store) SessionExtend(ctx context.Context, session SessionInterface,
 		return errors.New("session is nil")
 	}
 
+	previousExpiresAt := session.GetExpiresAt()
+
 	expiresAt := carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC)
 
 	session.SetExpiresAt(expiresAt)
 
+	if store.sessionExtendBuffered(session, previousExpiresAt) {
+		return nil
+	}
+
 	return store.SessionUpdate(ctx, session)
 }
 
@@ -746,7 +942,7 @@ func (store *store) SessionList(ctx context.Context, query SessionQueryInterface
 		return []SessionInterface{}, errors.New("userstore: database is nil")
 	}
 
-	modelMaps, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+	modelMaps, err := database.SelectToMapString(store.toQueryableContext(ctx), sqlStr, sqlParams...)
 
 	if err != nil {
 		return []SessionInterface{}, err
@@ -756,6 +952,11 @@ func (store *store) SessionList(ctx context.Context, query SessionQueryInterface
 
 	lo.ForEach(modelMaps, func(modelMap map[string]string, index int) {
 		model := NewSessionFromExistingData(modelMap)
+
+		if len(query.Columns()) > 0 {
+			model = newPartialSession(modelMap, query.Columns())
+		}
+
 		list = append(list, model)
 	})
 
@@ -802,19 +1003,25 @@ func (store *store) SessionSoftDeleteByID(ctx context.Context, id string) error
 	return store.SessionSoftDelete(ctx, session)
 }
 
-// SessionUpdate updates a session.
+// SessionUpdate updates the changed columns of a session. A partial
+// session, loaded by a session query with columns, can only change the
+// loaded columns, and must have the id and key loaded.
 //
 // Parameters:
 //   - ctx - the context
 //   - session - the session to update
 //
 // Returns:
-//   - error - nil if successful, otherwise an error
+//   - error - ErrColumnNotLoaded if a partial session cannot be updated, nil if successful, otherwise an error
 func (store *store) SessionUpdate(ctx context.Context, session SessionInterface) error {
 	if session == nil {
 		return errors.New("sessionstore > session update. session cannot be nil")
 	}
 
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
 	if store.db == nil {
 		return errors.New("sessionstore > session update. db cannot be nil")
 	}
@@ -829,12 +1036,26 @@ func (store *store) SessionUpdate(ctx context.Context, session SessionInterface)
 
 	delete(dataChanged, COLUMN_ID) // ID cannot be updated
 
+	if err := store.metaColumnsCheck(dataChanged); err != nil {
+		return err
+	}
+
+	if tenantID, ok := dataChanged[COLUMN_TENANT_ID]; ok && len(store.tenantIDs) > 0 && !lo.Contains(store.tenantIDs, tenantID) {
+		return errors.New("sessionstore > session update. session cannot be moved to another tenant")
+	}
+
+	if _, ok := dataChanged[COLUMN_EXPIRES_AT]; ok && store.writeBehind != nil {
+		store.writeBehind.remove(session.GetID()) // superseded by this update
+	}
+
 	sqlStr, sqlParams, sqlErr := goqu.Dialect(store.dbDriverName).
 		Update(store.sessionTableName).
 		Prepared(true).
-		Where(goqu.C(COLUMN_SESSION_KEY).Eq(session.GetKey())).
-		Where(goqu.C(COLUMN_ID).Eq(session.GetID())).
-		Set(dataChanged).
+		Where(store.tenantScope(
+			goqu.C(COLUMN_SESSION_KEY).Eq(session.GetKey()),
+			goqu.C(COLUMN_ID).Eq(session.GetID()),
+		)...).
+		Set(store.sqlRecord(dataChanged)).
 		ToSQL()
 
 	if sqlErr != nil {
@@ -843,12 +1064,44 @@ func (store *store) SessionUpdate(ctx context.Context, session SessionInterface)
 
 	store.logSql("update", sqlStr, sqlParams...)
 
-	_, err := database.Execute(database.Context(ctx, store.db), sqlStr, sqlParams...)
+	userID, userIDChanged := dataChanged[COLUMN_USER_ID]
+	limitApplicable := userIDChanged && store.isSessionLimitApplicable(userID)
+
+	change := SessionChange{
+		Operation: CHANGE_OPERATION_UPDATE,
+		SessionID: session.GetID(),
+		UserID:    session.GetUserID(),
+	}
+
+	if softDeletedAt, ok := dataChanged[COLUMN_SOFT_DELETED_AT]; ok && softDeletedAt <= session.GetUpdatedAt() {
+		change.Operation = CHANGE_OPERATION_SOFT_DELETE
+	}
+
+	evictedIDs := []string{}
+
+	err := store.runInTransactionIf(ctx, limitApplicable || store.changeNotificationsEnabled, func(qctx database.QueryableContext) error {
+		if limitApplicable {
+			var errEnforce error
+			evictedIDs, errEnforce = store.sessionLimitEnforce(qctx, userID, session.GetID())
+
+			if errEnforce != nil {
+				return errEnforce
+			}
+		}
+
+		if _, err := database.Execute(qctx, sqlStr, sqlParams...); err != nil {
+			return err
+		}
+
+		return store.changesPublish(qctx, change)
+	})
 
 	if err != nil {
 		return err
 	}
 
+	store.emitRevokedEvents(ctx, userID, evictedIDs)
+
 	return nil
 }
 
@@ -881,7 +1134,7 @@ func (st *store) Set(ctx context.Context, sessionKey string, value string, secon
 			SetIPAddress(options.GetIPAddress()).
 			SetExpiresAt(expiresAt)
 
-		return st.SessionCreate(ctx, newSession)
+		return st.sessionUpsert(ctx, newSession, options) // atomic, if created meanwhile
 	} else {
 		session.SetValue(value)
 		session.SetExpiresAt(expiresAt)
@@ -951,6 +1204,14 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 
 	q := goqu.Dialect(store.dbDriverName).From(store.sessionTableName)
 
+	if scope := store.tenantScope(); len(scope) > 0 {
+		q = q.Where(scope...)
+	}
+
+	if options.HasTenantID() {
+		q = q.Where(goqu.C(COLUMN_TENANT_ID).Eq(options.TenantID()))
+	}
+
 	if options.HasCreatedAtGte() && options.HasCreatedAtLte() {
 		q = q.Where(
 			goqu.C(COLUMN_CREATED_AT).Gte(options.CreatedAtGte()),
@@ -973,6 +1234,14 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 		q = q.Where(goqu.C(COLUMN_EXPIRES_AT).Lte(options.ExpiresAtLte()))
 	}
 
+	if options.HasUpdatedAtGte() {
+		q = q.Where(goqu.C(COLUMN_UPDATED_AT).Gte(options.UpdatedAtGte()))
+	}
+
+	if options.HasUpdatedAtLte() {
+		q = q.Where(goqu.C(COLUMN_UPDATED_AT).Lte(options.UpdatedAtLte()))
+	}
+
 	if options.HasID() {
 		q = q.Where(goqu.C(COLUMN_ID).Eq(options.ID()))
 	}
@@ -985,18 +1254,67 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 		q = q.Where(goqu.C(COLUMN_SESSION_KEY).Eq(options.Key()))
 	}
 
+	if options.HasKeyIn() {
+		q = q.Where(goqu.C(COLUMN_SESSION_KEY).In(options.KeyIn()))
+	}
+
 	if options.HasUserAgent() {
 		q = q.Where(goqu.C(COLUMN_USER_AGENT).Eq(options.UserAgent()))
 	}
 
+	if options.HasUserAgentContains() {
+		q = q.Where(store.sqlLike(COLUMN_USER_AGENT, "%"+likeEscape(options.UserAgentContains())+"%"))
+	}
+
 	if options.HasUserID() {
 		q = q.Where(goqu.C(COLUMN_USER_ID).Eq(options.UserID()))
 	}
 
+	if options.HasUserIDIn() {
+		q = q.Where(goqu.C(COLUMN_USER_ID).In(options.UserIDIn()))
+	}
+
+	if options.UserIDNotEmpty() {
+		q = q.Where(goqu.C(COLUMN_USER_ID).Neq(""), goqu.C(COLUMN_USER_ID).IsNotNull())
+	}
+
 	if options.HasUserIpAddress() {
 		q = q.Where(goqu.C(COLUMN_IP_ADDRESS).Eq(options.UserIpAddress()))
 	}
 
+	if options.HasUserIpAddressPrefix() {
+		q = q.Where(store.sqlLike(COLUMN_IP_ADDRESS, likeEscape(options.UserIpAddressPrefix())+"%"))
+	}
+
+	if options.HasUserIpAddressCIDR() {
+		patterns, _ := ipv4CIDRPatterns(options.UserIpAddressCIDR()) // validated
+
+		q = q.Where(goqu.Or(lo.Map(patterns, func(pattern string, _ int) goqu.Expression {
+			if strings.HasSuffix(pattern, ".") {
+				return goqu.C(COLUMN_IP_ADDRESS).Like(pattern + "%")
+			}
+
+			return goqu.Or(
+				goqu.C(COLUMN_IP_ADDRESS).Eq(pattern),
+				goqu.C(COLUMN_IP_ADDRESS).Like(pattern+":%"), // with a port
+			)
+		})...))
+	}
+
+	if options.ExpiredOnly() {
+		q = q.Where(goqu.C(COLUMN_EXPIRES_AT).Lt(carbon.Now(carbon.UTC).ToDateTimeString()))
+	}
+
+	metaWheres, err := store.metaWheres(options)
+
+	if err != nil {
+		return nil, []any{}, err
+	}
+
+	if len(metaWheres) > 0 {
+		q = q.Where(metaWheres...)
+	}
+
 	if !options.IsCountOnly() {
 		if options.HasLimit() {
 			q = q.Limit(uint(options.Limit()))
@@ -1012,11 +1330,44 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 		sortOrder = options.SortOrder()
 	}
 
-	if options.HasOrderBy() && options.OrderBy() != "" {
+	if sorts := sessionQuerySorts(options); len(sorts) > 0 {
+		orders := []exp.OrderedExpression{}
+
+		for _, sort := range sorts {
+			if !lo.Contains(sessionTableColumns(), sort.Column) && !lo.ContainsBy(store.metaColumns, func(column MetaColumn) bool { return column.Name == sort.Column }) {
+				return nil, []any{}, &ErrInvalidSort{Column: sort.Column, Order: sort.Order}
+			}
+
+			if strings.EqualFold(sort.Order, sb.ASC) {
+				orders = append(orders, goqu.C(sort.Column).Asc())
+			} else {
+				orders = append(orders, goqu.C(sort.Column).Desc())
+			}
+		}
+
+		// ties in id order, for a stable order across pages
+		if strings.EqualFold(sorts[len(sorts)-1].Order, sb.ASC) {
+			orders = append(orders, goqu.C(COLUMN_ID).Asc())
+		} else {
+			orders = append(orders, goqu.C(COLUMN_ID).Desc())
+		}
+
+		q = q.Order(orders...)
+	}
+
+	if options.HasCursor() {
+		position, _ := sessionCursorDecode(options.Cursor()) // validated
+
 		if strings.EqualFold(sortOrder, sb.ASC) {
-			q = q.Order(goqu.I(options.OrderBy()).Asc())
+			q = q.Where(goqu.Or(
+				goqu.C(COLUMN_CREATED_AT).Gt(position.CreatedAt),
+				goqu.And(goqu.C(COLUMN_CREATED_AT).Eq(position.CreatedAt), goqu.C(COLUMN_ID).Gt(position.ID)),
+			))
 		} else {
-			q = q.Order(goqu.I(options.OrderBy()).Desc())
+			q = q.Where(goqu.Or(
+				goqu.C(COLUMN_CREATED_AT).Lt(position.CreatedAt),
+				goqu.And(goqu.C(COLUMN_CREATED_AT).Eq(position.CreatedAt), goqu.C(COLUMN_ID).Lt(position.ID)),
+			))
 		}
 	}
 
@@ -1026,6 +1377,13 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 		columns = append(columns, column)
 	}
 
+	if options.SoftDeletedOnly() {
+		softDeleted := goqu.C(COLUMN_SOFT_DELETED_AT).
+			Lte(carbon.Now(carbon.UTC).ToDateTimeString())
+
+		return q.Where(softDeleted), columns, nil
+	}
+
 	if options.SoftDeletedIncluded() {
 		return q, columns, nil // soft deleted sessions requested specifically
 	}
@@ -1036,6 +1394,57 @@ func (store *store) sessionSelectQuery(options SessionQueryInterface) (selectDat
 	return q.Where(softDeleted), columns, nil
 }
 
+// runInTransactionIf runs fn inside a database transaction when required
+// is true, otherwise directly against the database. If the context already
+// carries a transaction, it is reused and left for the caller to commit.
+//
+// Parameters:
+//   - ctx - the context
+//   - required - whether a transaction is required
+//   - fn - the function to run
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) runInTransactionIf(ctx context.Context, required bool, fn func(qctx database.QueryableContext) error) error {
+	if store.db == nil {
+		return errors.New("sessionstore: database is nil")
+	}
+
+	qctx := store.toQueryableContext(ctx)
+
+	if !required || qctx.IsTx() {
+		return fn(qctx)
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(database.Context(ctx, tx)); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			return errors.Join(err, errRollback)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// toQueryableContext returns the context as a queryable context, reusing
+// the transaction or connection it already carries, if any.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - database.QueryableContext - the queryable context
+func (store *store) toQueryableContext(ctx context.Context) database.QueryableContext {
+	return database.ContextOr(ctx, store.db)
+}
+
 // logSql logs SQL statements if debug is enabled.
 //
 // Parameters:
@@ -1051,3 +1460,69 @@ func (store *store) logSql(sqlOperationType string, sql string, params ...interf
 		store.sqlLogger.Debug("sql: "+sqlOperationType, slog.String("sql", sql), slog.Any("params", params))
 	}
 }
+
+// sqlRecord returns the session data as a record to insert or update,
+// storing an empty value as NULL in a JSONB value column, and empty meta
+// values as NULL.
+//
+// Parameters:
+//   - data - the session data
+//
+// Returns:
+//   - goqu.Record - the record
+func (store *store) sqlRecord(data map[string]string) goqu.Record {
+	record := goqu.Record{}
+
+	for column, value := range data {
+		record[column] = value
+	}
+
+	if value, ok := data[COLUMN_SESSION_VALUE]; ok {
+		record[COLUMN_SESSION_VALUE] = store.sqlValue(value)
+	}
+
+	for _, column := range store.metaColumns {
+		if value, ok := data[column.Name]; ok && value == "" {
+			record[column.Name] = nil // empty meta values are stored as NULL
+		}
+	}
+
+	if value, ok := data[COLUMN_RESTORED_AT]; ok && value == "" {
+		record[COLUMN_RESTORED_AT] = nil // not restored
+	}
+
+	return record
+}
+
+// sqlLike returns a case insensitive LIKE condition on a column, with "!"
+// as the escape character of the pattern, see likeEscape
+//
+// Parameters:
+//   - column - the column
+//   - pattern - the LIKE pattern
+//
+// Returns:
+//   - goqu.Expression - the condition
+func (store *store) sqlLike(column string, pattern string) goqu.Expression {
+	if store.dbDriverName == sb.DIALECT_POSTGRES {
+		return goqu.L("? ILIKE ? ESCAPE '!'", goqu.C(column), pattern)
+	}
+
+	return goqu.L("? LIKE ? ESCAPE '!'", goqu.C(column), pattern)
+}
+
+// sqlValue returns the session value to write, NULL for an empty value
+// in a JSONB value column, as an empty string is not valid JSON.
+//
+// Parameters:
+//   - value - the session value
+//
+// Returns:
+//   - any - the value to write
+func (store *store) sqlValue(value string) any {
+	if store.valueColumnJSONB && value == "" {
+		return nil
+	}
+
+	return value
+}
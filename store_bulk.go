@@ -0,0 +1,341 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// SessionCreateMany creates sessions with multi-row inserts, chunked to
+// the parameter limit of the dialect, in a single transaction, so either
+// all the sessions are created or none.
+//
+// With MaxSessionsPerUser set, the sessions of users are inserted one at
+// a time in the same transaction, after making room for each of them.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	for _, session := range sessions {
+		if session == nil {
+			return errors.New("sessionstore > session create many. session cannot be nil")
+		}
+
+		if err := store.sessionCreatePrepare(session); err != nil {
+			return err
+		}
+	}
+
+	limited, batched := lo.FilterReject(sessions, func(session SessionInterface, _ int) bool {
+		return store.isSessionLimitApplicable(session.GetUserID())
+	})
+
+	evictedIDs := map[string][]string{}
+
+	err := store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		for _, group := range sessionsByColumns(batched) {
+			size := store.sqlParamsMax() / len(group[0].Data())
+
+			for _, chunk := range lo.Chunk(group, max(size, 1)) {
+				if err := store.sqlInsertSessions(qctx, chunk); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, session := range limited {
+			evicted, err := store.sessionLimitEnforce(qctx, session.GetUserID(), session.GetID())
+
+			if err != nil {
+				return err
+			}
+
+			evictedIDs[session.GetUserID()] = append(evictedIDs[session.GetUserID()], evicted...)
+
+			if err := store.sqlInsertSessions(qctx, []SessionInterface{session}); err != nil {
+				return err
+			}
+		}
+
+		return store.changesPublish(qctx, lo.Map(sessions, func(session SessionInterface, _ int) SessionChange {
+			return SessionChange{
+				Operation: CHANGE_OPERATION_CREATE,
+				SessionID: session.GetID(),
+				UserID:    session.GetUserID(),
+			}
+		})...)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		session.MarkAsNotDirty()
+	}
+
+	for _, userID := range lo.Uniq(lo.Map(limited, func(session SessionInterface, _ int) string { return session.GetUserID() })) {
+		store.emitRevokedEvents(ctx, userID, evictedIDs[userID])
+	}
+
+	return nil
+}
+
+// SessionDeleteMany deletes the sessions matching the filters of a query
+// with a delete statement, chunked to the parameter limit of the dialect
+// if the query lists many keys or user ids, in a single transaction.
+// The query cannot be paginated or sorted, an empty query deletes all
+// the sessions, except the soft deleted ones unless included.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return store.sessionWriteMany(ctx, CHANGE_OPERATION_DELETE, query, 0, func(q *goqu.SelectDataset) (string, []any, error) {
+		return q.Delete().Prepared(true).ToSQL()
+	})
+}
+
+// SessionUpdateMany sets the fields of the sessions matching the filters
+// of a query with an update statement, chunked to the parameter limit of
+// the dialect if the query lists many keys or user ids, in a single
+// transaction. The updated at time is set, unless one of the fields.
+//
+// The id and key cannot be updated in bulk, nor the user id while
+// MaxSessionsPerUser is set, as the limit is enforced per session.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	if err := bulkFieldsValidate(fields); err != nil {
+		return 0, err
+	}
+
+	for column := range fields {
+		if _, ok := store.metaColumn(column); !ok && !lo.Contains(sessionTableColumns(), column) {
+			return 0, errors.New("sessionstore > session update many. " + column + " is not a session column")
+		}
+	}
+
+	if tenantID, ok := fields[COLUMN_TENANT_ID]; ok && len(store.tenantIDs) > 0 && !lo.Contains(store.tenantIDs, tenantID) {
+		return 0, errors.New("sessionstore > session update many. sessions cannot be moved to another tenant")
+	}
+
+	if userID, ok := fields[COLUMN_USER_ID]; ok && store.isSessionLimitApplicable(userID) {
+		return 0, errors.New("sessionstore > session update many. user id cannot be updated in bulk with MaxSessionsPerUser set")
+	}
+
+	if _, ok := fields[COLUMN_EXPIRES_AT]; ok && store.writeBehind != nil {
+		if err := store.SessionFlush(ctx); err != nil { // the buffered extensions would overwrite the update
+			return 0, err
+		}
+	}
+
+	record := store.sqlRecord(fields)
+
+	if _, ok := record[COLUMN_UPDATED_AT]; !ok {
+		record[COLUMN_UPDATED_AT] = carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	}
+
+	return store.sessionWriteMany(ctx, CHANGE_OPERATION_UPDATE, query, len(record), func(q *goqu.SelectDataset) (string, []any, error) {
+		return q.Update().Set(record).Prepared(true).ToSQL()
+	})
+}
+
+// PRIVATE METHODS ===========================================================
+
+// sessionWriteMany runs a delete or update statement built from the
+// select query of each chunk of a bulk query, in a transaction, and
+// publishes a change for each session written
+//
+// Parameters:
+//   - ctx - the context
+//   - operation - the change operation
+//   - query - the session query
+//   - reserved - the number of parameters used by the statement itself
+//   - toSQL - builds the statement from a select query
+//
+// Returns:
+//   - int64 - the number of sessions written
+//   - error - nil if successful, otherwise an error
+func (store *store) sessionWriteMany(ctx context.Context, operation string, query SessionQueryInterface, reserved int, toSQL func(q *goqu.SelectDataset) (string, []any, error)) (int64, error) {
+	if err := bulkQueryValidate(query); err != nil {
+		return 0, err
+	}
+
+	if store.db == nil {
+		return 0, errors.New("sessionstore: database is nil")
+	}
+
+	// room for the other filters of the query, the tenant scope and meta values
+	size := store.sqlParamsMax() - reserved - 64 - len(store.tenantIDs) - len(query.Meta())
+
+	affected := int64(0)
+
+	err := store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		for _, chunk := range bulkQueryChunks(query, size) {
+			q, _, err := store.sessionSelectQuery(chunk)
+
+			if err != nil {
+				return err
+			}
+
+			changes, err := store.changesForSelect(qctx, operation, q)
+
+			if err != nil {
+				return err
+			}
+
+			sqlStr, sqlParams, errSql := toSQL(q)
+
+			if errSql != nil {
+				return errSql
+			}
+
+			store.logSql(operation, sqlStr, sqlParams...)
+
+			result, err := database.Execute(qctx, sqlStr, sqlParams...)
+
+			if err != nil {
+				return err
+			}
+
+			count, err := result.RowsAffected()
+
+			if err != nil {
+				return err
+			}
+
+			affected += count
+
+			if err := store.changesPublish(qctx, changes...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// changesForSelect returns a change for each session selected by a
+// query, to be published before the sessions are written, see changesForWhere
+func (store *store) changesForSelect(ctx database.QueryableContext, operation string, q *goqu.SelectDataset) ([]SessionChange, error) {
+	if !store.changeNotificationsEnabled {
+		return []SessionChange{}, nil
+	}
+
+	sqlStr, sqlParams, errSql := q.Select(COLUMN_ID, COLUMN_USER_ID).Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return []SessionChange{}, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return []SessionChange{}, err
+	}
+
+	return lo.Map(rows, func(row map[string]string, _ int) SessionChange {
+		return SessionChange{
+			Operation: operation,
+			SessionID: row[COLUMN_ID],
+			UserID:    row[COLUMN_USER_ID],
+		}
+	}), nil
+}
+
+// sqlInsertSessions inserts sessions with the same columns in a single
+// statement
+func (store *store) sqlInsertSessions(ctx database.QueryableContext, sessions []SessionInterface) error {
+	rows := lo.Map(sessions, func(session SessionInterface, _ int) any {
+		return store.sqlRecord(session.Data())
+	})
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		Insert(store.sessionTableName).
+		Prepared(true).
+		Rows(rows...).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	store.logSql("create", sqlStr, sqlParams...)
+
+	_, err := database.Execute(ctx, sqlStr, sqlParams...)
+
+	return err
+}
+
+// sqlParamsMax returns the maximum number of parameters of a statement
+// in the dialect of the store
+func (store *store) sqlParamsMax() int {
+	switch store.dbDriverName {
+	case sb.DIALECT_MSSQL:
+		return 2000 // 2100, less a margin
+	case sb.DIALECT_POSTGRES, sb.DIALECT_MYSQL:
+		return 65535
+	default:
+		return 999 // SQLite before 3.32
+	}
+}
+
+// sessionsByColumns groups sessions by their columns, as the rows of a
+// multi-row insert must have the same columns, in the order of the sessions
+func sessionsByColumns(sessions []SessionInterface) [][]SessionInterface {
+	groups := [][]SessionInterface{}
+	index := map[string]int{}
+
+	for _, session := range sessions {
+		columns := lo.Keys(session.Data())
+		slices.Sort(columns)
+		key := strings.Join(columns, ",")
+
+		i, ok := index[key]
+
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, []SessionInterface{})
+		}
+
+		groups[i] = append(groups[i], session)
+	}
+
+	return groups
+}
@@ -0,0 +1,362 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/samber/lo"
+)
+
+// sqlIndexesMissing returns the SQL strings for creating the indexes of
+// a migration missing from the session table, i.e. of tables created by
+// an earlier version of the store.
+//
+// Creating the unique index on the session key fails if the existing
+// table holds duplicate keys, so they are deleted first, keeping the most
+// recently updated session of each key.
+//
+// Parameters:
+//   - ctx - the context
+//   - migration - the version of the migration creating the indexes
+//
+// Returns:
+//   - []string - the SQL strings
+//   - error - nil if successful, otherwise an error
+func (store *store) sqlIndexesMissing(ctx context.Context, migration int) ([]string, error) {
+	existing, err := store.indexNames(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sqls := []string{}
+
+	for _, index := range store.sessionTableIndexes() {
+		if index.migration != migration || lo.Contains(existing, strings.ToLower(index.name)) {
+			continue
+		}
+
+		if index.unique {
+			duplicated, err := store.sessionKeysDuplicated(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if duplicated {
+				sqls = append(sqls, store.sqlSessionKeysDeduplicate())
+			}
+		}
+
+		sqls = append(sqls, store.sqlCreateIndex(index))
+	}
+
+	return sqls, nil
+}
+
+// sessionKeysDuplicated returns whether sessions of the session table
+// share their key, i.e. in tables created by an earlier version of the
+// store, without the unique index. A missing table holds none.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - bool - true if a session key is duplicated
+//   - error - nil if successful, otherwise an error
+func (store *store) sessionKeysDuplicated(ctx context.Context) (bool, error) {
+	exists, err := store.tableExists(ctx, store.sessionTableName)
+
+	if err != nil || !exists {
+		return false, err
+	}
+
+	dialect := goqu.Dialect(store.dbDriverName)
+
+	duplicates := dialect.From(store.sessionTableName).
+		Select(goqu.C(COLUMN_SESSION_KEY)).
+		GroupBy(goqu.C(COLUMN_SESSION_KEY)).
+		Having(goqu.L("COUNT(*) > 1"))
+
+	sqlStr, _, errSql := dialect.From(duplicates.As("duplicates")).
+		Select(goqu.COUNT(goqu.Star()).As("count")).
+		ToSQL()
+
+	if errSql != nil {
+		return false, errSql
+	}
+
+	store.logSql("select", sqlStr)
+
+	count, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(count) > 0 && count[0]["count"] != "0", nil
+}
+
+// sqlIndexesExisting returns the SQL strings for dropping the indexes of
+// a migration which exist in the session table.
+//
+// Parameters:
+//   - ctx - the context
+//   - migration - the version of the migration creating the indexes
+//
+// Returns:
+//   - []string - the SQL strings
+//   - error - nil if successful, otherwise an error
+func (store *store) sqlIndexesExisting(ctx context.Context, migration int) ([]string, error) {
+	existing, err := store.indexNames(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sqls := []string{}
+
+	for _, index := range store.sessionTableIndexes() {
+		if index.migration == migration && lo.Contains(existing, strings.ToLower(index.name)) {
+			sqls = append(sqls, store.sqlDropIndex(index))
+		}
+	}
+
+	return sqls, nil
+}
+
+// indexNames returns the names of the indexes of the session table,
+// lower cased, read from the catalog of the database.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - []string - the index names
+//   - error - nil if successful, otherwise an error
+func (store *store) indexNames(ctx context.Context) ([]string, error) {
+	var query *goqu.SelectDataset
+
+	dialect := goqu.Dialect(store.dbDriverName)
+
+	switch store.dbDriverName {
+	case sb.DIALECT_SQLITE:
+		query = dialect.From("sqlite_master").
+			Select(goqu.C("name").As("name")).
+			Where(
+				goqu.C("type").Eq("index"),
+				goqu.C("tbl_name").Eq(store.sessionTableName),
+			)
+	case sb.DIALECT_POSTGRES:
+		query = dialect.From("pg_indexes").
+			Select(goqu.C("indexname").As("name")).
+			Where(
+				goqu.C("schemaname").Eq(goqu.Func("current_schema")),
+				goqu.C("tablename").Eq(store.sessionTableName),
+			)
+	case sb.DIALECT_MYSQL:
+		query = dialect.From(goqu.S("information_schema").Table("statistics")).
+			Select(goqu.C("index_name").As("name")).
+			Distinct().
+			Where(
+				goqu.C("table_schema").Eq(goqu.Func("DATABASE")),
+				goqu.C("table_name").Eq(store.sessionTableName),
+			)
+	case sb.DIALECT_MSSQL:
+		query = dialect.From(goqu.S("sys").Table("indexes")).
+			Select(goqu.C("name").As("name")).
+			Where(
+				goqu.C("object_id").Eq(goqu.Func("OBJECT_ID", store.sessionTableName)),
+				goqu.C("name").IsNotNull(),
+			)
+	default:
+		return nil, errors.New("session store: listing indexes is not supported for " + store.dbDriverName)
+	}
+
+	sqlStr, sqlParams, errSql := query.Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return nil, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(rows, func(row map[string]string, _ int) string {
+		return strings.ToLower(row["name"])
+	}), nil
+}
+
+// columnNames returns the names of the columns of the session table,
+// lower cased, read from the catalog of the database.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - []string - the column names
+//   - error - nil if successful, otherwise an error
+func (store *store) columnNames(ctx context.Context) ([]string, error) {
+	var query *goqu.SelectDataset
+
+	dialect := goqu.Dialect(store.dbDriverName)
+
+	switch store.dbDriverName {
+	case sb.DIALECT_SQLITE:
+		query = dialect.From(goqu.Func("pragma_table_info", store.sessionTableName)).
+			Select(goqu.C("name").As("name"))
+	case sb.DIALECT_POSTGRES:
+		query = dialect.From(goqu.S("information_schema").Table("columns")).
+			Select(goqu.C("column_name").As("name")).
+			Where(
+				goqu.C("table_schema").Eq(goqu.Func("current_schema")),
+				goqu.C("table_name").Eq(store.sessionTableName),
+			)
+	case sb.DIALECT_MYSQL:
+		query = dialect.From(goqu.S("information_schema").Table("columns")).
+			Select(goqu.C("column_name").As("name")).
+			Where(
+				goqu.C("table_schema").Eq(goqu.Func("DATABASE")),
+				goqu.C("table_name").Eq(store.sessionTableName),
+			)
+	case sb.DIALECT_MSSQL:
+		query = dialect.From(goqu.S("sys").Table("columns")).
+			Select(goqu.C("name").As("name")).
+			Where(goqu.C("object_id").Eq(goqu.Func("OBJECT_ID", store.sessionTableName)))
+	default:
+		return nil, errors.New("session store: listing columns is not supported for " + store.dbDriverName)
+	}
+
+	sqlStr, sqlParams, errSql := query.Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return nil, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(rows, func(row map[string]string, _ int) string {
+		return strings.ToLower(row["name"])
+	}), nil
+}
+
+// columnNamesOfType returns the names of the columns of the session table
+// with a data type, read from the catalog of a Postgres database.
+//
+// Parameters:
+//   - ctx - the context
+//   - dataType - the data type, as named by information_schema (i.e. "timestamp without time zone")
+//
+// Returns:
+//   - []string - the column names
+//   - error - nil if successful, otherwise an error
+func (store *store) columnNamesOfType(ctx context.Context, dataType string) ([]string, error) {
+	if store.dbDriverName != sb.DIALECT_POSTGRES {
+		return nil, errors.New("session store: listing columns by type is not supported for " + store.dbDriverName)
+	}
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		From(goqu.S("information_schema").Table("columns")).
+		Select(goqu.C("column_name").As("name")).
+		Where(
+			goqu.C("table_schema").Eq(goqu.Func("current_schema")),
+			goqu.C("table_name").Eq(store.sessionTableName),
+			goqu.C("data_type").Eq(dataType),
+		).
+		Order(goqu.C("ordinal_position").Asc()).
+		Prepared(true).
+		ToSQL()
+
+	if errSql != nil {
+		return nil, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(rows, func(row map[string]string, _ int) string {
+		return row["name"]
+	}), nil
+}
+
+// tableExists returns whether a table exists, read from the catalog of
+// the database.
+//
+// Parameters:
+//   - ctx - the context
+//   - tableName - the table name
+//
+// Returns:
+//   - bool - true if the table exists
+//   - error - nil if successful, otherwise an error
+func (store *store) tableExists(ctx context.Context, tableName string) (bool, error) {
+	var query *goqu.SelectDataset
+
+	dialect := goqu.Dialect(store.dbDriverName)
+
+	switch store.dbDriverName {
+	case sb.DIALECT_SQLITE:
+		query = dialect.From("sqlite_master").
+			Select(goqu.C("name").As("name")).
+			Where(
+				goqu.C("type").Eq("table"),
+				goqu.C("name").Eq(tableName),
+			)
+	case sb.DIALECT_POSTGRES:
+		query = dialect.From(goqu.S("information_schema").Table("tables")).
+			Select(goqu.C("table_name").As("name")).
+			Where(
+				goqu.C("table_schema").Eq(goqu.Func("current_schema")),
+				goqu.C("table_name").Eq(tableName),
+			)
+	case sb.DIALECT_MYSQL:
+		query = dialect.From(goqu.S("information_schema").Table("tables")).
+			Select(goqu.C("table_name").As("name")).
+			Where(
+				goqu.C("table_schema").Eq(goqu.Func("DATABASE")),
+				goqu.C("table_name").Eq(tableName),
+			)
+	case sb.DIALECT_MSSQL:
+		query = dialect.From(goqu.S("sys").Table("tables")).
+			Select(goqu.C("name").As("name")).
+			Where(goqu.C("name").Eq(tableName))
+	default:
+		return false, errors.New("session store: listing tables is not supported for " + store.dbDriverName)
+	}
+
+	sqlStr, sqlParams, errSql := query.Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return false, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(rows) > 0, nil
+}
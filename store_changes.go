@@ -0,0 +1,326 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dracory/uid"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+var _ SessionChangeSubscriberInterface = (*store)(nil) // verify it publishes its changes
+
+// changeLogLookback is how far back each poll of the change log looks,
+// so that changes committed late by slow transactions are not missed
+const changeLogLookback = 30 * time.Second
+
+// SessionChangesSubscribe delivers the changes published by all the
+// instances sharing the database to the handler, until the context is done.
+//
+// Delivery is at least once, and starts with a CHANGE_OPERATION_RESET
+// change, as changes may have been missed before subscribing. If an error
+// is returned the subscription can simply be restarted.
+//
+// Parameters:
+//   - ctx - the context, cancel it to unsubscribe
+//   - opts - the subscribe options
+//
+// Returns:
+//   - error - nil if the context is done, otherwise an error
+func (store *store) SessionChangesSubscribe(ctx context.Context, opts SessionChangesSubscribeOptions) error {
+	if !store.changeNotificationsEnabled {
+		return errors.New("session store: change notifications are not enabled")
+	}
+
+	if opts.Handler == nil {
+		return errors.New("session store: change handler is required")
+	}
+
+	if opts.Listener != nil && store.dbDriverName != sb.DIALECT_POSTGRES {
+		return errors.New("session store: notification listener is only supported on postgres")
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	if opts.Listener != nil {
+		if err := opts.Listener.Listen(ctx, store.changeLogTableName); err != nil {
+			return err
+		}
+	}
+
+	opts.Handler(ctx, SessionChange{
+		Operation:  CHANGE_OPERATION_RESET,
+		OccurredAt: carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC),
+	})
+
+	if opts.Listener != nil {
+		return store.changesListen(ctx, opts.Listener, opts.Handler)
+	}
+
+	seen := map[string]struct{}{}
+
+	for {
+		if err := store.changesPoll(ctx, seen, opts.Handler); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// changesListen delivers the changes received via NOTIFY to the handler
+//
+// Parameters:
+//   - ctx - the context
+//   - listener - the notification listener, already listening
+//   - handler - the change handler
+//
+// Returns:
+//   - error - nil if the context is done, otherwise an error
+func (store *store) changesListen(ctx context.Context, listener NotificationListener, handler SessionChangeHandler) error {
+	for {
+		payload, err := listener.WaitForNotification(ctx)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		change := SessionChange{}
+
+		if err := json.Unmarshal([]byte(payload), &change); err != nil {
+			store.sqlLogger.Error("session store: invalid change notification", "payload", payload, "error", err)
+			continue
+		}
+
+		handler(ctx, change)
+	}
+}
+
+// changesPoll delivers the changes of the change log not seen yet to the handler
+//
+// Parameters:
+//   - ctx - the context
+//   - seen - the ids of the changes already delivered, updated in place
+//   - handler - the change handler
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) changesPoll(ctx context.Context, seen map[string]struct{}, handler SessionChangeHandler) error {
+	since := time.Now().UTC().Add(-changeLogLookback).Format("20060102150405")
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		From(store.changeLogTableName).
+		Prepared(true).
+		Where(goqu.C(COLUMN_ID).Gte(since)).
+		Order(goqu.C(COLUMN_ID).Asc()).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	for id := range seen {
+		if id < since {
+			delete(seen, id)
+		}
+	}
+
+	for _, row := range rows {
+		if _, ok := seen[row[COLUMN_ID]]; ok {
+			continue
+		}
+
+		seen[row[COLUMN_ID]] = struct{}{}
+
+		handler(ctx, SessionChange{
+			ID:         row[COLUMN_ID],
+			Operation:  row[COLUMN_OPERATION],
+			SessionID:  row[COLUMN_SESSION_ID],
+			UserID:     row[COLUMN_USER_ID],
+			OccurredAt: row[COLUMN_OCCURRED_AT],
+		})
+	}
+
+	return nil
+}
+
+// changesPublish records changes in the change log, and on Postgres
+// notifies the listeners. Must be run in the transaction of the write,
+// so that the changes are only published if the write is committed.
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - changes - the changes to publish
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) changesPublish(ctx database.QueryableContext, changes ...SessionChange) error {
+	if !store.changeNotificationsEnabled || len(changes) == 0 {
+		return nil
+	}
+
+	occurredAt := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	rows := []any{}
+
+	for i := range changes {
+		changes[i].ID = uid.HumanUid()
+		changes[i].OccurredAt = occurredAt
+
+		rows = append(rows, map[string]any{
+			COLUMN_ID:          changes[i].ID,
+			COLUMN_OPERATION:   changes[i].Operation,
+			COLUMN_SESSION_ID:  changes[i].SessionID,
+			COLUMN_USER_ID:     changes[i].UserID,
+			COLUMN_OCCURRED_AT: changes[i].OccurredAt,
+		})
+	}
+
+	for _, chunk := range lo.Chunk(rows, store.sqlParamsMax()/5) { // 5 columns per change
+		sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+			Insert(store.changeLogTableName).
+			Prepared(true).
+			Rows(chunk...).
+			ToSQL()
+
+		if errSql != nil {
+			return errSql
+		}
+
+		store.logSql("insert", sqlStr, sqlParams...)
+
+		if _, err := database.Execute(ctx, sqlStr, sqlParams...); err != nil {
+			return err
+		}
+	}
+
+	if store.dbDriverName != sb.DIALECT_POSTGRES {
+		return nil
+	}
+
+	for _, change := range changes {
+		payload, err := json.Marshal(change)
+
+		if err != nil {
+			return err
+		}
+
+		sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+			Select(goqu.Func("pg_notify", store.changeLogTableName, string(payload))).
+			Prepared(true).
+			ToSQL()
+
+		if errSql != nil {
+			return errSql
+		}
+
+		store.logSql("notify", sqlStr, sqlParams...)
+
+		if _, err := database.Execute(ctx, sqlStr, sqlParams...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changesForWhere returns a change for each session matching the
+// conditions, to be published before the sessions are deleted by them
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - operation - the change operation
+//   - wheres - the conditions of the write
+//
+// Returns:
+//   - []SessionChange - the changes, empty if change notifications are disabled
+//   - error - nil if successful, otherwise an error
+func (store *store) changesForWhere(ctx database.QueryableContext, operation string, wheres ...goqu.Expression) ([]SessionChange, error) {
+	if !store.changeNotificationsEnabled {
+		return []SessionChange{}, nil
+	}
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		From(store.sessionTableName).
+		Prepared(true).
+		Select(COLUMN_ID, COLUMN_USER_ID).
+		Where(wheres...).
+		ToSQL()
+
+	if errSql != nil {
+		return []SessionChange{}, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return []SessionChange{}, err
+	}
+
+	return lo.Map(rows, func(row map[string]string, _ int) SessionChange {
+		return SessionChange{
+			Operation: operation,
+			SessionID: row[COLUMN_ID],
+			UserID:    row[COLUMN_USER_ID],
+		}
+	}), nil
+}
+
+// changeLogPrune deletes the changes older than the retention period
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) changeLogPrune(ctx context.Context) error {
+	before := time.Now().UTC().
+		Add(-time.Duration(store.changeLogRetentionSeconds) * time.Second).
+		Format("20060102150405")
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		Delete(store.changeLogTableName).
+		Prepared(true).
+		Where(goqu.C(COLUMN_ID).Lt(before)).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	store.logSql("delete", sqlStr, sqlParams...)
+
+	_, err := database.Execute(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	return err
+}
@@ -0,0 +1,144 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dromara/carbon/v2"
+)
+
+// SessionDeleteByUserID deletes all the sessions of a user in a single
+// statement, i.e. to log the user out everywhere.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("sessionstore > session delete by user id. user id cannot be empty")
+	}
+
+	q := goqu.Dialect(store.dbDriverName).
+		Delete(store.sessionTableName).
+		Prepared(true).
+		Where(store.tenantScope(goqu.C(COLUMN_USER_ID).Eq(userID))...)
+
+	if exceptSessionID != "" {
+		q = q.Where(goqu.C(COLUMN_ID).Neq(exceptSessionID))
+	}
+
+	sqlStr, sqlParams, errSql := q.ToSQL()
+
+	if errSql != nil {
+		return 0, errSql
+	}
+
+	store.logSql("delete", sqlStr, sqlParams...)
+
+	return store.executeRevoke(ctx, CHANGE_OPERATION_DELETE, sqlStr, sqlParams, userID, exceptSessionID)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user in a
+// single statement, i.e. on password reset.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if userID == "" {
+		return 0, errors.New("sessionstore > session soft delete by user id. user id cannot be empty")
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	q := goqu.Dialect(store.dbDriverName).
+		Update(store.sessionTableName).
+		Prepared(true).
+		Set(goqu.Record{
+			COLUMN_SOFT_DELETED_AT: now,
+			COLUMN_UPDATED_AT:      now,
+		}).
+		Where(store.tenantScope(
+			goqu.C(COLUMN_USER_ID).Eq(userID),
+			goqu.C(COLUMN_SOFT_DELETED_AT).Gt(now),
+		)...)
+
+	if exceptSessionID != "" {
+		q = q.Where(goqu.C(COLUMN_ID).Neq(exceptSessionID))
+	}
+
+	sqlStr, sqlParams, errSql := q.ToSQL()
+
+	if errSql != nil {
+		return 0, errSql
+	}
+
+	store.logSql("update", sqlStr, sqlParams...)
+
+	return store.executeRevoke(ctx, CHANGE_OPERATION_SOFT_DELETE, sqlStr, sqlParams, userID, exceptSessionID)
+}
+
+// executeRevoke executes a statement revoking the sessions of a user,
+// and emits a revoked event if any sessions were affected
+//
+// Parameters:
+//   - ctx - the context
+//   - operation - the change operation, CHANGE_OPERATION_DELETE or CHANGE_OPERATION_SOFT_DELETE
+//   - sqlStr - the SQL statement
+//   - sqlParams - the SQL parameters
+//   - userID - the user id
+//   - exceptSessionID - the session left untouched, if any
+//
+// Returns:
+//   - int64 - the number of affected sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) executeRevoke(ctx context.Context, operation string, sqlStr string, sqlParams []any, userID string, exceptSessionID string) (int64, error) {
+	affected := int64(0)
+
+	err := store.runInTransactionIf(ctx, store.changeNotificationsEnabled, func(qctx database.QueryableContext) error {
+		result, err := database.Execute(qctx, sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+
+		if err != nil || affected < 1 {
+			return err
+		}
+
+		// published for the whole user, the cached sessions are dropped by user id
+		return store.changesPublish(qctx, SessionChange{
+			Operation: operation,
+			UserID:    userID,
+		})
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	if affected > 0 {
+		store.emitEvent(ctx, SessionEvent{
+			Type:            SESSION_EVENT_REVOKED,
+			UserID:          userID,
+			ExceptSessionID: exceptSessionID,
+			Count:           affected,
+		})
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,41 @@
+package sessionstore
+
+import (
+	"context"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// emitEvent notifies the configured event handler, if any, of a session event
+//
+// Parameters:
+//   - ctx - the context
+//   - event - the event
+func (store *store) emitEvent(ctx context.Context, event SessionEvent) {
+	if store.eventHandler == nil {
+		return
+	}
+
+	if event.OccurredAt == "" {
+		event.OccurredAt = carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	}
+
+	store.eventHandler(ctx, event)
+}
+
+// emitRevokedEvents emits a revoked event for each of the given sessions
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user the sessions belonged to
+//   - sessionIDs - the ids of the revoked sessions
+func (store *store) emitRevokedEvents(ctx context.Context, userID string, sessionIDs []string) {
+	for _, sessionID := range sessionIDs {
+		store.emitEvent(ctx, SessionEvent{
+			Type:      SESSION_EVENT_REVOKED,
+			SessionID: sessionID,
+			UserID:    userID,
+			Count:     1,
+		})
+	}
+}
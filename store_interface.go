@@ -20,3 +20,58 @@ type StoreInterface interface {
 	SessionSoftDeleteByID(ctx context.Context, sessionID string) error
 	SessionUpdate(ctx context.Context, session SessionInterface) error
 }
+
+// The optional interfaces below are implemented by the stores of this
+// package. They are kept out of StoreInterface, so the stores implemented
+// elsewhere keep satisfying it. The decorators (cached, sharded, tiered)
+// type-assert their inner stores for them, and fall back to the methods
+// of StoreInterface otherwise.
+
+// FlusherInterface is implemented by stores buffering writes
+type FlusherInterface interface {
+	// SessionFlush writes the buffered writes
+	SessionFlush(ctx context.Context) error
+}
+
+// BulkStoreInterface is implemented by stores writing many sessions at once
+type BulkStoreInterface interface {
+	SessionCreateMany(ctx context.Context, sessions []SessionInterface) error
+	SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error)
+	SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error)
+}
+
+// PagingStoreInterface is implemented by stores reading sessions a page at a time
+type PagingStoreInterface interface {
+	SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error
+	SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error)
+}
+
+// RestoreStoreInterface is implemented by stores restoring soft deleted sessions
+type RestoreStoreInterface interface {
+	SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error)
+	SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error
+}
+
+// UserStoreInterface is implemented by stores deleting all the sessions
+// of a user at once
+type UserStoreInterface interface {
+	SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error)
+	SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error)
+}
+
+// PromoteStoreInterface is implemented by stores promoting guest sessions
+type PromoteStoreInterface interface {
+	SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error
+}
+
+// StatsStoreInterface is implemented by stores aggregating sessions for dashboards
+type StatsStoreInterface interface {
+	SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error)
+}
+
+// UserSessionsStoreInterface is implemented by stores listing the sessions
+// of a user for account security pages
+type UserSessionsStoreInterface interface {
+	UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error)
+	UserSessionRevoke(ctx context.Context, userID string, handle string) error
+}
@@ -0,0 +1,121 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dracory/database"
+	"github.com/spf13/cast"
+)
+
+// SessionListPage returns a page of the sessions matching the query, and
+// the cursor of the next page, which is set on the query to fetch it.
+// The pages are in the order of creation (then id), descending unless
+// the query sorts ascending, so sessions created while paging do not
+// shift the pages, as with an offset.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 100)
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	return sessionListPage(ctx, store.sessionListRows, query)
+}
+
+// SessionIterate calls fn for each session matching the query, in the
+// order of SessionListPage. The sessions are read a page at a time, so
+// exports over millions of sessions run in constant memory, and fn may
+// use the store (i.e. to update the session).
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, the limit is the page size (default 1000)
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *store) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return sessionIterate(ctx, store.SessionListPage, query, fn)
+}
+
+// sessionListRows lists the sessions matching the query, as SessionList,
+// reading the rows one at a time, without the intermediate maps of
+// database.SelectToMapString
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query
+//
+// Returns:
+//   - []SessionInterface - the sessions
+//   - error - nil if successful, otherwise an error
+func (store *store) sessionListRows(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	if store.db == nil {
+		return []SessionInterface{}, errors.New("session store: database is nil")
+	}
+
+	q, columns, err := store.sessionSelectQuery(query)
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	sqlStr, sqlParams, errSql := q.Prepared(true).Select(columns...).ToSQL()
+
+	if errSql != nil {
+		return []SessionInterface{}, errSql
+	}
+
+	store.logSql("list", sqlStr, sqlParams...)
+
+	rows, err := database.Query(store.toQueryableContext(ctx), sqlStr, sqlParams...)
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	defer rows.Close()
+
+	names, err := rows.Columns()
+
+	if err != nil {
+		return []SessionInterface{}, err
+	}
+
+	values := make([]any, len(names))
+	pointers := make([]any, len(names))
+
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	list := []SessionInterface{}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return []SessionInterface{}, err
+		}
+
+		data := make(map[string]string, len(names))
+
+		for i, name := range names {
+			data[name] = cast.ToString(values[i])
+		}
+
+		if len(query.Columns()) > 0 {
+			list = append(list, newPartialSession(data, query.Columns()))
+		} else {
+			list = append(list, NewSessionFromExistingData(data))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return []SessionInterface{}, err
+	}
+
+	return list, nil
+}
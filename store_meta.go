@@ -0,0 +1,260 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/samber/lo"
+)
+
+// MetaColumn defines an extra column of the session table, holding
+// metadata of the sessions (i.e. the authentication method), which can
+// be read and written with GetMeta and SetMeta, and filtered on
+type MetaColumn struct {
+	// Name is the column name, lower case letters, digits and underscores
+	Name string
+
+	// Type is the column type, one of sb.COLUMN_TYPE_STRING (default),
+	// sb.COLUMN_TYPE_TEXT, sb.COLUMN_TYPE_INTEGER or sb.COLUMN_TYPE_DATETIME
+	Type string
+
+	// Length is the length of a string column, default 255
+	Length int
+
+	// Index creates an index on the column, not supported for the
+	// sb.COLUMN_TYPE_TEXT columns
+	Index bool
+}
+
+var columnNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// metaColumnsValidate validates the meta columns, and sets their defaults
+//
+// Parameters:
+//   - columns - the meta columns
+//
+// Returns:
+//   - []MetaColumn - the meta columns, with the defaults set
+//   - error - nil if valid, otherwise an error
+func metaColumnsValidate(columns []MetaColumn) ([]MetaColumn, error) {
+	validated := []MetaColumn{}
+
+	for _, column := range columns {
+		if !columnNameRegex.MatchString(column.Name) {
+			return nil, errors.New("session store: meta column name " + column.Name + " is not valid")
+		}
+
+		if lo.Contains(sessionTableColumns(), column.Name) {
+			return nil, errors.New("session store: meta column name " + column.Name + " is reserved")
+		}
+
+		if lo.ContainsBy(validated, func(existing MetaColumn) bool { return existing.Name == column.Name }) {
+			return nil, errors.New("session store: meta column " + column.Name + " is registered twice")
+		}
+
+		if column.Type == "" {
+			column.Type = sb.COLUMN_TYPE_STRING
+		}
+
+		if !lo.Contains([]string{
+			sb.COLUMN_TYPE_STRING,
+			sb.COLUMN_TYPE_TEXT,
+			sb.COLUMN_TYPE_INTEGER,
+			sb.COLUMN_TYPE_DATETIME,
+		}, column.Type) {
+			return nil, errors.New("session store: meta column type " + column.Type + " is not supported")
+		}
+
+		if column.Type == sb.COLUMN_TYPE_TEXT && column.Index {
+			return nil, errors.New("session store: meta column " + column.Name + " of type text cannot be indexed")
+		}
+
+		if column.Type == sb.COLUMN_TYPE_STRING && column.Length <= 0 {
+			column.Length = 255
+		}
+
+		validated = append(validated, column)
+	}
+
+	return validated, nil
+}
+
+// metaColumn returns the registered meta column with the name
+func (store *store) metaColumn(name string) (MetaColumn, bool) {
+	return lo.Find(store.metaColumns, func(column MetaColumn) bool {
+		return column.Name == name
+	})
+}
+
+// metaColumnsCheck checks that the columns of the session data, to be
+// written, are columns of the session table or registered meta columns
+//
+// Parameters:
+//   - data - the session data
+//
+// Returns:
+//   - error - nil if valid, an error naming a meta column which is not registered
+func (store *store) metaColumnsCheck(data map[string]string) error {
+	names := lo.Keys(data)
+	slices.Sort(names) // a stable error
+
+	for _, name := range names {
+		if lo.Contains(sessionTableColumns(), name) {
+			continue
+		}
+
+		if _, ok := store.metaColumn(name); !ok {
+			return errors.New("session store: meta column " + name + " is not registered, see NewStoreOptions.MetaColumns")
+		}
+	}
+
+	return nil
+}
+
+// metaIndexes returns the indexes of the meta columns with Index set
+func (store *store) metaIndexes() []sessionTableIndex {
+	indexes := []sessionTableIndex{}
+
+	for _, column := range store.metaColumns {
+		if column.Index {
+			indexes = append(indexes, sessionTableIndex{
+				name:    store.sessionTableName + "_" + column.Name + "_index",
+				columns: []string{column.Name},
+			})
+		}
+	}
+
+	return indexes
+}
+
+// metaColumnsMigrate adds the meta columns, and their indexes, missing
+// from the session table, in a transaction
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) metaColumnsMigrate(ctx context.Context) error {
+	sqls, err := store.sqlMetaColumnsMissing(ctx)
+
+	if err != nil || len(sqls) == 0 {
+		return err
+	}
+
+	return store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		for _, sqlStr := range sqls {
+			store.logSql("migrate", sqlStr)
+
+			if _, err := database.Execute(qctx, sqlStr); err != nil {
+				return errors.New("session store: adding the meta columns failed: " + err.Error())
+			}
+		}
+
+		return nil
+	})
+}
+
+// sqlMetaColumnsMissing returns the SQL strings for adding the meta
+// columns, and their indexes, missing from the session table. The
+// columns are nullable, an empty meta value is stored as NULL.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - []string - the SQL strings
+//   - error - nil if successful, otherwise an error
+func (store *store) sqlMetaColumnsMissing(ctx context.Context) ([]string, error) {
+	if len(store.metaColumns) == 0 {
+		return []string{}, nil
+	}
+
+	existingColumns, err := store.columnNames(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	existingIndexes, err := store.indexNames(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sqls := []string{}
+
+	for _, column := range store.metaColumns {
+		if lo.Contains(existingColumns, column.Name) {
+			continue
+		}
+
+		columnType := column.Type
+
+		if columnType == sb.COLUMN_TYPE_DATETIME && store.dbDriverName == sb.DIALECT_POSTGRES {
+			columnType = "TIMESTAMPTZ"
+		}
+
+		sqlStr, err := sb.NewBuilder(store.dbDriverName).TableColumnAdd(store.sessionTableName, sb.Column{
+			Name:     column.Name,
+			Type:     columnType,
+			Length:   column.Length,
+			Nullable: true,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		sqls = append(sqls, sqlStr)
+	}
+
+	for _, index := range store.metaIndexes() {
+		if !lo.Contains(existingIndexes, strings.ToLower(index.name)) {
+			sqls = append(sqls, store.sqlCreateIndex(index))
+		}
+	}
+
+	return sqls, nil
+}
+
+// metaWheres returns the conditions filtering on the meta values of a
+// query, an empty value matches the sessions without the meta value
+//
+// Parameters:
+//   - query - the session query
+//
+// Returns:
+//   - []goqu.Expression - the conditions
+//   - error - nil if successful, an error if a meta column is not registered
+func (store *store) metaWheres(query SessionQueryInterface) ([]goqu.Expression, error) {
+	wheres := []goqu.Expression{}
+
+	if !query.HasMeta() {
+		return wheres, nil
+	}
+
+	meta := query.Meta()
+	names := lo.Keys(meta)
+	slices.Sort(names) // a stable statement
+
+	for _, name := range names {
+		if _, ok := store.metaColumn(name); !ok {
+			return nil, errors.New("session store: meta column " + name + " is not registered")
+		}
+
+		if meta[name] == "" {
+			wheres = append(wheres, goqu.C(name).IsNull())
+		} else {
+			wheres = append(wheres, goqu.C(name).Eq(meta[name]))
+		}
+	}
+
+	return wheres, nil
+}
@@ -0,0 +1,150 @@
+package sessionstore
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dracory/sb"
+)
+
+func TestStore_MetaColumns(t *testing.T) {
+	store := initMigrationStore(t)
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// registered later, on the existing table
+	store.metaColumns, _ = metaColumnsValidate([]MetaColumn{
+		{Name: "auth_method", Index: true},
+		{Name: "mfa_verified_at", Type: sb.COLUMN_TYPE_DATETIME},
+	})
+
+	sqls, err := store.MigrateDryRun(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	joined := strings.Join(sqls, "\n")
+
+	for _, expected := range []string{
+		`ALTER TABLE "session" ADD COLUMN "auth_method"`,
+		`ALTER TABLE "session" ADD COLUMN "mfa_verified_at"`,
+		`CREATE INDEX "session_auth_method_index"`,
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Fatal("dry run MUST contain:", expected, joined)
+		}
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	names, err := store.indexNames(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !slices.Contains(names, "session_auth_method_index") {
+		t.Fatal("meta column index MUST be created, got:", names)
+	}
+
+	sqls, err = store.MigrateDryRun(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(sqls) != 0 {
+		t.Fatal("dry run MUST be empty once migrated, got:", sqls)
+	}
+
+	passkey := NewSession().SetUserID("1").SetMeta("auth_method", "passkey").SetMeta("mfa_verified_at", "2026-10-19 10:00:00")
+	password := NewSession().SetUserID("1").SetMeta("auth_method", "password")
+	unknown := NewSession().SetUserID("1").SetMeta("auth_method", "")
+
+	for _, session := range []SessionInterface{passkey, password, unknown} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	found, err := store.SessionFindByID(context.Background(), passkey.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.GetMeta("auth_method") != "passkey" || !strings.HasPrefix(found.GetMeta("mfa_verified_at"), "2026-10-19 10:00:00") {
+		t.Fatal("meta values MUST be stored, got:", found.Data())
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetMeta("auth_method", "password"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetID() != password.GetID() {
+		t.Fatal("sessions MUST be filtered by meta value, got:", len(list))
+	}
+
+	list, err = store.SessionList(context.Background(), SessionQuery().SetMeta("mfa_verified_at", ""))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 2 || slices.ContainsFunc(list, func(session SessionInterface) bool { return session.GetID() == passkey.GetID() }) {
+		t.Fatal("empty meta value MUST match the sessions without it, got:", len(list))
+	}
+
+	if _, err := store.SessionList(context.Background(), SessionQuery().SetMeta("org_id", "1")); err == nil {
+		t.Fatal("filtering on an unregistered meta column MUST fail")
+	}
+
+	err = store.SessionCreate(context.Background(), NewSession().SetMeta("org_id", "1"))
+
+	if err == nil || !strings.Contains(err.Error(), "meta column org_id is not registered") {
+		t.Fatal("creating a session with an unregistered meta column MUST fail, got:", err)
+	}
+
+	err = store.SessionUpdate(context.Background(), password.SetMeta("org_id", "1"))
+
+	if err == nil || !strings.Contains(err.Error(), "meta column org_id is not registered") {
+		t.Fatal("updating a session with an unregistered meta column MUST fail, got:", err)
+	}
+}
+
+func TestNewStore_MetaColumnsInvalid(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	defer db.Close()
+
+	for _, columns := range [][]MetaColumn{
+		{{Name: "Org-ID"}},
+		{{Name: COLUMN_USER_ID}},
+		{{Name: "org_id"}, {Name: "org_id"}},
+		{{Name: "org_id", Type: sb.COLUMN_TYPE_BLOB}},
+		{{Name: "org_id", Type: sb.COLUMN_TYPE_TEXT, Index: true}},
+	} {
+		_, err := NewStore(NewStoreOptions{
+			DB:               db,
+			SessionTableName: "session",
+			MetaColumns:      columns,
+		})
+
+		if err == nil {
+			t.Fatal("meta columns MUST be rejected:", columns)
+		}
+	}
+}
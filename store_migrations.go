@@ -0,0 +1,576 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+var _ MigratorInterface = (*store)(nil) // verify it extends the migrator interface
+
+// schemaMigration defines a step of the schema of the session table.
+//
+// The up and down functions return the SQL for the dialect of the store,
+// they may read the catalog of the database (i.e. to skip the indexes
+// which exist already), but must not change anything.
+type schemaMigration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, store *store) ([]string, error)
+	down    func(ctx context.Context, store *store) ([]string, error)
+}
+
+// schemaMigrations returns the migrations of the session table, in
+// ascending order of version. Released migrations must never change,
+// schema changes are added as new migrations at the end.
+//
+// The first migrations are safe to apply to tables created by earlier
+// versions of the store, which had no migration table.
+func schemaMigrations() []schemaMigration {
+	return []schemaMigration{
+		{
+			version: 1,
+			name:    "create_session_table",
+			up: func(ctx context.Context, store *store) ([]string, error) {
+				return []string{store.SQLCreateTable()}, nil
+			},
+			down: func(ctx context.Context, store *store) ([]string, error) {
+				return []string{sb.NewBuilder(store.dbDriverName).Table(store.sessionTableName).DropIfExists()}, nil
+			},
+		},
+		{
+			version: 2,
+			name:    "create_session_indexes",
+			up: func(ctx context.Context, store *store) ([]string, error) {
+				return store.sqlIndexesMissing(ctx, 2)
+			},
+			down: func(ctx context.Context, store *store) ([]string, error) {
+				return store.sqlIndexesExisting(ctx, 2)
+			},
+		},
+		{
+			version: 3,
+			name:    "add_tenant_id",
+			up: func(ctx context.Context, store *store) ([]string, error) {
+				addColumn, err := store.sqlAddColumn(sb.Column{
+					Name:   COLUMN_TENANT_ID,
+					Type:   sb.COLUMN_TYPE_STRING,
+					Length: 40,
+				}, "")
+
+				if err != nil {
+					return nil, err
+				}
+
+				indexes, err := store.sqlIndexesMissing(ctx, 3)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return append([]string{addColumn}, indexes...), nil
+			},
+			down: func(ctx context.Context, store *store) ([]string, error) {
+				indexes, err := store.sqlIndexesExisting(ctx, 3)
+
+				if err != nil {
+					return nil, err
+				}
+
+				dropColumn, err := store.sqlDropColumn(COLUMN_TENANT_ID)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return append(indexes, dropColumn), nil
+			},
+		},
+		{
+			version: 4,
+			name:    "add_restore_columns",
+			up: func(ctx context.Context, store *store) ([]string, error) {
+				datetimeType := sb.COLUMN_TYPE_DATETIME
+
+				if store.dbDriverName == sb.DIALECT_POSTGRES {
+					datetimeType = "TIMESTAMPTZ"
+				}
+
+				restoredAt, err := sb.NewBuilder(store.dbDriverName).TableColumnAdd(store.sessionTableName, sb.Column{
+					Name:     COLUMN_RESTORED_AT,
+					Type:     datetimeType,
+					Nullable: true, // NULL unless restored
+				})
+
+				if err != nil {
+					return nil, err
+				}
+
+				restoredBy, err := store.sqlAddColumn(sb.Column{
+					Name:   COLUMN_RESTORED_BY,
+					Type:   sb.COLUMN_TYPE_STRING,
+					Length: 255,
+				}, "")
+
+				if err != nil {
+					return nil, err
+				}
+
+				restoreReason, err := store.sqlAddColumn(sb.Column{
+					Name:   COLUMN_RESTORE_REASON,
+					Type:   sb.COLUMN_TYPE_STRING,
+					Length: 1024,
+				}, "")
+
+				if err != nil {
+					return nil, err
+				}
+
+				return []string{restoredAt, restoredBy, restoreReason}, nil
+			},
+			down: func(ctx context.Context, store *store) ([]string, error) {
+				sqls := []string{}
+
+				for _, column := range []string{COLUMN_RESTORE_REASON, COLUMN_RESTORED_BY, COLUMN_RESTORED_AT} {
+					dropColumn, err := store.sqlDropColumn(column)
+
+					if err != nil {
+						return nil, err
+					}
+
+					sqls = append(sqls, dropColumn)
+				}
+
+				return sqls, nil
+			},
+		},
+		{
+			version: 5,
+			name:    "postgres_timestamptz",
+			up: func(ctx context.Context, store *store) ([]string, error) {
+				return store.sqlDatetimeColumnsAlter(ctx, "timestamp without time zone", "TIMESTAMPTZ")
+			},
+			down: func(ctx context.Context, store *store) ([]string, error) {
+				return store.sqlDatetimeColumnsAlter(ctx, "timestamp with time zone", "TIMESTAMP")
+			},
+		},
+	}
+}
+
+// sqlDatetimeColumnsAlter returns the SQL for changing the datetime columns
+// of the session table from one type to the other on Postgres, where
+// tables created by earlier versions of the store have TIMESTAMP columns.
+// The other dialects have nothing to change.
+//
+// Parameters:
+//   - ctx - the context
+//   - fromDataType - the data type of the columns to change, as named by information_schema
+//   - toType - the SQL type to change them to
+//
+// Returns:
+//   - []string - the SQL statements
+//   - error - nil if successful, otherwise an error
+func (store *store) sqlDatetimeColumnsAlter(ctx context.Context, fromDataType string, toType string) ([]string, error) {
+	if store.dbDriverName != sb.DIALECT_POSTGRES {
+		return nil, nil
+	}
+
+	columns, err := store.columnNamesOfType(ctx, fromDataType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.Map(columns, func(column string, _ int) string {
+		return store.sqlAlterDatetimeColumn(column, toType)
+	}), nil
+}
+
+// Migrate creates the migration table if it does not exist, and applies
+// the pending migrations in ascending order of version. Each migration
+// runs in its own transaction, together with recording it as applied.
+//
+// The registered meta columns missing from the session table, and their
+// indexes, are added last. They are not versioned, a meta column which
+// is no longer registered is kept, with its data.
+//
+// MySQL commits DDL statements implicitly, so a failed migration may be
+// applied partially there. Run migrations from a single instance, i.e.
+// on deployment, concurrent runs fail on recording the same version.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) Migrate(ctx context.Context) error {
+	if store.db == nil {
+		return errors.New("session store: database is nil")
+	}
+
+	sqlStr := store.SQLCreateMigrationTable()
+
+	store.logSql("create table", sqlStr)
+
+	if _, err := database.Execute(database.Context(ctx, store.db), sqlStr); err != nil {
+		return err
+	}
+
+	applied, err := store.migrationsApplied(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range schemaMigrations() {
+		if _, ok := applied[migration.version]; ok {
+			continue
+		}
+
+		sqls, err := migration.up(ctx, store)
+
+		if err != nil {
+			return err
+		}
+
+		recordSql, recordParams, err := store.sqlMigrationRecord(migration, true)
+
+		if err != nil {
+			return err
+		}
+
+		if err := store.migrationRun(ctx, migration, sqls, recordSql, recordParams); err != nil {
+			return err
+		}
+	}
+
+	return store.metaColumnsMigrate(ctx)
+}
+
+// MigrateDryRun returns the SQL Migrate would run, for review, without
+// running it. The SQL includes the creation of the migration table, if
+// it does not exist, and the recording of each migration as applied.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - []string - the SQL strings, in order
+//   - error - nil if successful, otherwise an error
+func (store *store) MigrateDryRun(ctx context.Context) ([]string, error) {
+	if store.db == nil {
+		return nil, errors.New("session store: database is nil")
+	}
+
+	sqls := []string{}
+
+	exists, err := store.tableExists(ctx, store.migrationTableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Migration{}
+
+	if exists {
+		if applied, err = store.migrationsApplied(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		sqls = append(sqls, store.SQLCreateMigrationTable())
+	}
+
+	for _, migration := range schemaMigrations() {
+		if _, ok := applied[migration.version]; ok {
+			continue
+		}
+
+		up, err := migration.up(ctx, store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		recordSql, _, err := store.sqlMigrationRecord(migration, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sqls = append(sqls, lo.Compact(up)...)
+		sqls = append(sqls, recordSql)
+	}
+
+	metaSqls, err := store.sqlMetaColumnsMissing(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sqls, metaSqls...), nil
+}
+
+// MigrateDown reverts the applied migrations newer than the version, in
+// descending order of version, i.e. MigrateDown(ctx, 0) reverts all of
+// them and drops the session table. Each migration runs in its own
+// transaction, together with removing it from the applied migrations.
+//
+// Parameters:
+//   - ctx - the context
+//   - version - the version to revert to
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) MigrateDown(ctx context.Context, version int) error {
+	if store.db == nil {
+		return errors.New("session store: database is nil")
+	}
+
+	exists, err := store.tableExists(ctx, store.migrationTableName)
+
+	if err != nil || !exists {
+		return err
+	}
+
+	reverts, err := store.migrationsToRevert(ctx, version)
+
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range reverts {
+		sqls, err := migration.down(ctx, store)
+
+		if err != nil {
+			return err
+		}
+
+		removeSql, removeParams, err := store.sqlMigrationRemove(migration, true)
+
+		if err != nil {
+			return err
+		}
+
+		if err := store.migrationRun(ctx, migration, sqls, removeSql, removeParams); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDownDryRun returns the SQL MigrateDown would run, for review,
+// without running it.
+//
+// Parameters:
+//   - ctx - the context
+//   - version - the version to revert to
+//
+// Returns:
+//   - []string - the SQL strings, in order
+//   - error - nil if successful, otherwise an error
+func (store *store) MigrateDownDryRun(ctx context.Context, version int) ([]string, error) {
+	if store.db == nil {
+		return nil, errors.New("session store: database is nil")
+	}
+
+	sqls := []string{}
+
+	exists, err := store.tableExists(ctx, store.migrationTableName)
+
+	if err != nil || !exists {
+		return sqls, err
+	}
+
+	reverts, err := store.migrationsToRevert(ctx, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range reverts {
+		down, err := migration.down(ctx, store)
+
+		if err != nil {
+			return nil, err
+		}
+
+		removeSql, _, err := store.sqlMigrationRemove(migration, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sqls = append(sqls, lo.Compact(down)...)
+		sqls = append(sqls, removeSql)
+	}
+
+	return sqls, nil
+}
+
+// MigrationStatus returns the known migrations in ascending order of
+// version, and whether they have been applied. Migrations applied by a
+// newer version of the store are included too.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - []Migration - the migrations
+//   - error - nil if successful, otherwise an error
+func (store *store) MigrationStatus(ctx context.Context) ([]Migration, error) {
+	if store.db == nil {
+		return nil, errors.New("session store: database is nil")
+	}
+
+	exists, err := store.tableExists(ctx, store.migrationTableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Migration{}
+
+	if exists {
+		if applied, err = store.migrationsApplied(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := []Migration{}
+
+	for _, migration := range schemaMigrations() {
+		status, ok := applied[migration.version]
+
+		if !ok {
+			status = Migration{Version: migration.version}
+		}
+
+		status.Name = migration.name
+		statuses = append(statuses, status)
+
+		delete(applied, migration.version)
+	}
+
+	statuses = append(statuses, lo.Values(applied)...) // unknown to this version
+
+	slices.SortFunc(statuses, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return statuses, nil
+}
+
+// PRIVATE METHODS ===========================================================
+
+// migrationRun runs the SQL of a migration, and the SQL recording (or
+// removing) it, in a transaction
+func (store *store) migrationRun(ctx context.Context, migration schemaMigration, sqls []string, bookkeepingSql string, bookkeepingParams []any) error {
+	return store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		for _, sqlStr := range lo.Compact(sqls) {
+			store.logSql("migrate", sqlStr)
+
+			if _, err := database.Execute(qctx, sqlStr); err != nil {
+				return errors.New("session store: migration " + strconv.Itoa(migration.version) + " " + migration.name + " failed: " + err.Error())
+			}
+		}
+
+		store.logSql("migrate", bookkeepingSql, bookkeepingParams...)
+
+		_, err := database.Execute(qctx, bookkeepingSql, bookkeepingParams...)
+
+		return err
+	})
+}
+
+// migrationsApplied returns the applied migrations, by version
+func (store *store) migrationsApplied(ctx context.Context) (map[int]Migration, error) {
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		From(store.migrationTableName).
+		Select(COLUMN_VERSION, COLUMN_NAME, COLUMN_APPLIED_AT).
+		Prepared(true).
+		ToSQL()
+
+	if errSql != nil {
+		return nil, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(database.Context(ctx, store.db), sqlStr, sqlParams...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Migration{}
+
+	for _, row := range rows {
+		version := cast.ToInt(row[COLUMN_VERSION])
+
+		applied[version] = Migration{
+			Version:   version,
+			Name:      row[COLUMN_NAME],
+			Applied:   true,
+			AppliedAt: row[COLUMN_APPLIED_AT],
+		}
+	}
+
+	return applied, nil
+}
+
+// migrationsToRevert returns the applied migrations newer than the
+// version, in descending order of version
+func (store *store) migrationsToRevert(ctx context.Context, version int) ([]schemaMigration, error) {
+	applied, err := store.migrationsApplied(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reverts := []schemaMigration{}
+
+	for _, migration := range lo.Reverse(schemaMigrations()) {
+		if _, ok := applied[migration.version]; ok && migration.version > version {
+			reverts = append(reverts, migration)
+		}
+	}
+
+	for applied := range applied {
+		if applied > version && !lo.ContainsBy(reverts, func(migration schemaMigration) bool { return migration.version == applied }) {
+			return nil, errors.New("session store: migration " + strconv.Itoa(applied) + " is unknown to this version, and cannot be reverted")
+		}
+	}
+
+	return reverts, nil
+}
+
+// sqlMigrationRecord returns the SQL recording a migration as applied
+func (store *store) sqlMigrationRecord(migration schemaMigration, prepared bool) (string, []any, error) {
+	return goqu.Dialect(store.dbDriverName).
+		Insert(store.migrationTableName).
+		Prepared(prepared).
+		Rows(goqu.Record{
+			COLUMN_VERSION:    migration.version,
+			COLUMN_NAME:       migration.name,
+			COLUMN_APPLIED_AT: carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC),
+		}).
+		ToSQL()
+}
+
+// sqlMigrationRemove returns the SQL removing a migration from the applied ones
+func (store *store) sqlMigrationRemove(migration schemaMigration, prepared bool) (string, []any, error) {
+	return goqu.Dialect(store.dbDriverName).
+		Delete(store.migrationTableName).
+		Prepared(prepared).
+		Where(goqu.C(COLUMN_VERSION).Eq(migration.version)).
+		ToSQL()
+}
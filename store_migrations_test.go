@@ -0,0 +1,294 @@
+package sessionstore
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cast"
+)
+
+func initMigrationStore(t *testing.T) *store {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	db.SetMaxOpenConns(1) // one in-memory database
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewStore(NewStoreOptions{
+		DB:               db,
+		SessionTableName: "session",
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	return store
+}
+
+func TestStore_MigrateDryRun(t *testing.T) {
+	store := initMigrationStore(t)
+
+	sqls, err := store.MigrateDryRun(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	joined := strings.Join(sqls, "\n")
+
+	for _, expected := range []string{
+		`CREATE TABLE IF NOT EXISTS "session_migrations"`,
+		`CREATE TABLE IF NOT EXISTS "session"`,
+		`CREATE UNIQUE INDEX "session_session_key_uindex"`,
+		`INSERT INTO "session_migrations"`,
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Fatal("dry run MUST contain:", expected, joined)
+		}
+	}
+
+	exists, err := store.tableExists(context.Background(), "session")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if exists {
+		t.Fatal("dry run MUST NOT create the session table")
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sqls, err = store.MigrateDryRun(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(sqls) != 0 {
+		t.Fatal("dry run MUST be empty once migrated, got:", sqls)
+	}
+}
+
+func TestStore_MigrateAndStatus(t *testing.T) {
+	store := initMigrationStore(t)
+
+	statuses, err := store.MigrationStatus(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(statuses) != len(schemaMigrations()) || statuses[0].Applied {
+		t.Fatal("no migration MUST be applied yet, got:", statuses)
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// a second run has nothing to apply
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	statuses, err = store.MigrationStatus(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt == "" {
+			t.Fatal("migration MUST be applied:", status)
+		}
+	}
+
+	if err := store.SessionCreate(context.Background(), NewSession()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sqls, err := store.MigrateDownDryRun(context.Background(), 1)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	joined := strings.Join(sqls, "\n")
+
+	for _, expected := range []string{
+		`DROP INDEX "session_tenant_id_index"`,
+		`ALTER TABLE "session" DROP COLUMN "tenant_id"`,
+		`DROP INDEX "session_session_key_uindex"`,
+		`DELETE FROM "session_migrations" WHERE ("version" = 2)`,
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Fatal("down dry run MUST contain:", expected, joined)
+		}
+	}
+
+	var sqliteVersion string
+
+	if err := store.db.QueryRow("SELECT sqlite_version()").Scan(&sqliteVersion); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if semverLess(sqliteVersion, "3.35.0") {
+		t.Skip("DROP COLUMN requires SQLite 3.35, linked:", sqliteVersion)
+	}
+
+	if err := store.MigrateDown(context.Background(), 1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	names, err := store.indexNames(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if slices.Contains(names, "session_session_key_uindex") || slices.Contains(names, "session_tenant_id_index") {
+		t.Fatal("indexes MUST be dropped, got:", names)
+	}
+
+	statuses, err = store.MigrationStatus(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Fatal("only migration 1 MUST remain applied, got:", statuses)
+	}
+
+	if err := store.MigrateDown(context.Background(), 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	exists, err := store.tableExists(context.Background(), "session")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if exists {
+		t.Fatal("session table MUST be dropped")
+	}
+}
+
+// semverLess returns true if the dotted version a is lower than b
+func semverLess(a string, b string) bool {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		if cast.ToInt(partsA[i]) != cast.ToInt(partsB[i]) {
+			return cast.ToInt(partsA[i]) < cast.ToInt(partsB[i])
+		}
+	}
+
+	return len(partsA) < len(partsB)
+}
+
+func TestStore_MigrationStatus_UnknownVersion(t *testing.T) {
+	store := initMigrationStore(t)
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// applied by a newer version of the store
+	_, err := store.db.Exec(`INSERT INTO "session_migrations" ("version", "name", "applied_at") VALUES (999, 'from_the_future', '2026-10-19 00:00:00')`)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	statuses, err := store.MigrationStatus(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	last := statuses[len(statuses)-1]
+
+	if last.Version != 999 || last.Name != "from_the_future" || !last.Applied {
+		t.Fatal("unknown applied migration MUST be listed last, got:", statuses)
+	}
+
+	if err := store.MigrateDown(context.Background(), 0); err == nil {
+		t.Fatal("unknown migrations MUST NOT be reverted")
+	}
+}
+
+func TestStore_Migrate_DuplicateSessionKeys(t *testing.T) {
+	store := initMigrationStore(t)
+	ctx := context.Background()
+
+	// a table of an earlier version of the store, without the unique index
+	if _, err := store.db.ExecContext(ctx, store.SQLCreateTable()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for i, updatedAt := range []string{"2026-01-01 00:00:01", "2026-01-01 00:00:03", "2026-01-01 00:00:02"} {
+		_, err := store.db.ExecContext(ctx, `INSERT INTO "session" ("id", "session_key", "user_id", "ip_address", "user_agent", "session_value", "expires_at", "created_at", "updated_at", "soft_deleted_at") VALUES (?, ?, '', '', '', '', ?, ?, ?, ?)`,
+			"id"+cast.ToString(i), "duplicated", "2099-01-01 00:00:00", updatedAt, updatedAt, "9999-12-31 23:59:59")
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	sqls, err := store.MigrateDryRun(ctx)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !strings.Contains(strings.Join(sqls, "\n"), `DELETE FROM "session" WHERE "id" IN`) {
+		t.Fatal("dry run MUST delete the duplicate session keys:", sqls)
+	}
+
+	if err := store.Migrate(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sessions, err := store.SessionList(ctx, SessionQuery().SetKey("duplicated"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(sessions) != 1 || sessions[0].GetID() != "id1" {
+		t.Fatal("Expected the most recently updated session of the key to be kept, found:", sessions)
+	}
+}
+
+func TestNewStore_AutoMigrateError(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	db.Close()
+
+	_, err = NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+	})
+
+	if err == nil {
+		t.Fatal("NewStore MUST return the error of the automigration")
+	}
+}
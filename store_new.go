@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/dracory/sb"
+	"github.com/samber/lo"
 )
 
 // NewStoreOptions define the options for creating a new session store
@@ -18,6 +20,55 @@ type NewStoreOptions struct {
 	AutomigrateEnabled bool
 	DebugEnabled       bool
 	SqlLogger          *slog.Logger
+
+	// MaxSessionsPerUser limits the active sessions a user may hold, 0 means unlimited
+	MaxSessionsPerUser int
+
+	// SessionEvictionPolicy decides what happens when MaxSessionsPerUser is reached,
+	// one of EVICTION_POLICY_REJECT (default), EVICTION_POLICY_EVICT_OLDEST
+	// or EVICTION_POLICY_EVICT_LEAST_RECENTLY_UPDATED
+	SessionEvictionPolicy string
+
+	// EventHandler, if set, is notified of session events (i.e. revocations)
+	EventHandler SessionEventHandler
+
+	// ChangeNotificationsEnabled publishes every write to the change log
+	// table (and on Postgres via NOTIFY), see SessionChangesSubscribe
+	ChangeNotificationsEnabled bool
+
+	// ChangeLogTableName is the name of the change log table, also used as
+	// the NOTIFY channel, default SessionTableName + "_changes"
+	ChangeLogTableName string
+
+	// ChangeLogRetentionSeconds is how long changes are kept, default 1 hour
+	ChangeLogRetentionSeconds int64
+
+	// WriteBehindInterval, if set, buffers the expiry extensions of
+	// SessionExtend in memory and writes them in batches at this interval,
+	// see SessionFlushGoroutine. Other changes are always written synchronously
+	WriteBehindInterval time.Duration
+
+	// ValueColumnJSONB stores the session value in a JSONB column on
+	// Postgres, new tables only. The values must then be valid JSON (i.e.
+	// set with SetAny or SetMap), empty values are stored as NULL. Ignored
+	// on the other databases
+	ValueColumnJSONB bool
+
+	// MigrationTableName is the name of the table recording the applied
+	// schema migrations, default SessionTableName + "_migrations"
+	MigrationTableName string
+
+	// MetaColumns registers extra columns of the session table, added by
+	// Migrate, read and written with GetMeta and SetMeta, and filtered on
+	// with SessionQuery().SetMeta
+	MetaColumns []MetaColumn
+
+	// UserSessionHandleSecret keys the HMAC of the handles returned by
+	// UserSessions, required by UserSessions and UserSessionRevoke, which
+	// return ErrUserSessionHandleSecretRequired without it. All the
+	// instances sharing the sessions must set the same secret, kept across
+	// restarts, or the handles stop matching
+	UserSessionHandleSecret string
 }
 
 // NewStore creates a new session store
@@ -30,6 +81,19 @@ func NewStore(opts NewStoreOptions) (*store, error) {
 		debugEnabled:       opts.DebugEnabled,
 		timeoutSeconds:     opts.TimeoutSeconds,
 		sqlLogger:          opts.SqlLogger,
+		maxSessionsPerUser: opts.MaxSessionsPerUser,
+		evictionPolicy:     opts.SessionEvictionPolicy,
+		eventHandler:       opts.EventHandler,
+
+		changeNotificationsEnabled: opts.ChangeNotificationsEnabled,
+		changeLogTableName:         opts.ChangeLogTableName,
+		changeLogRetentionSeconds:  opts.ChangeLogRetentionSeconds,
+
+		writeBehindInterval: opts.WriteBehindInterval,
+
+		migrationTableName: opts.MigrationTableName,
+
+		userSessionHandleSecret: []byte(opts.UserSessionHandleSecret),
 	}
 
 	if store.sessionTableName == "" {
@@ -40,10 +104,36 @@ func NewStore(opts NewStoreOptions) (*store, error) {
 		return nil, errors.New("session store: DB is required")
 	}
 
+	if store.maxSessionsPerUser < 0 {
+		return nil, errors.New("session store: MaxSessionsPerUser cannot be negative")
+	}
+
+	if store.evictionPolicy == "" {
+		store.evictionPolicy = EVICTION_POLICY_REJECT
+	}
+
+	if !lo.Contains([]string{
+		EVICTION_POLICY_REJECT,
+		EVICTION_POLICY_EVICT_OLDEST,
+		EVICTION_POLICY_EVICT_LEAST_RECENTLY_UPDATED,
+	}, store.evictionPolicy) {
+		return nil, errors.New("session store: SessionEvictionPolicy " + store.evictionPolicy + " is not supported")
+	}
+
+	metaColumns, err := metaColumnsValidate(opts.MetaColumns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	store.metaColumns = metaColumns
+
 	if store.dbDriverName == "" {
 		store.dbDriverName = sb.DatabaseDriverName(store.db)
 	}
 
+	store.valueColumnJSONB = opts.ValueColumnJSONB && store.dbDriverName == sb.DIALECT_POSTGRES
+
 	if store.sqlLogger == nil {
 		store.sqlLogger = slog.Default()
 	}
@@ -52,8 +142,30 @@ func NewStore(opts NewStoreOptions) (*store, error) {
 		store.timeoutSeconds = 2 * 60 * 60 // 2 hours
 	}
 
+	if store.writeBehindInterval < 0 {
+		return nil, errors.New("session store: WriteBehindInterval cannot be negative")
+	}
+
+	if store.writeBehindInterval > 0 {
+		store.writeBehind = newWriteBehindBuffer()
+	}
+
+	if store.changeLogTableName == "" {
+		store.changeLogTableName = store.sessionTableName + "_changes"
+	}
+
+	if store.migrationTableName == "" {
+		store.migrationTableName = store.sessionTableName + "_migrations"
+	}
+
+	if store.changeLogRetentionSeconds <= 0 {
+		store.changeLogRetentionSeconds = 60 * 60 // 1 hour
+	}
+
 	if store.automigrateEnabled {
-		store.AutoMigrate(context.Background())
+		if err := store.AutoMigrate(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 
 	return store, nil
@@ -0,0 +1,126 @@
+package sessionstore
+
+import (
+	"context"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dromara/carbon/v2"
+)
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, for investigations
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return sessionFindByIDIncludingDeleted(ctx, store.SessionList, sessionID)
+}
+
+// SessionRestore restores a soft deleted session, clearing its soft
+// deleted time, and records who restored it, when and why. An expired
+// session requires a new expiry in the options.
+//
+// With MaxSessionsPerUser set, the restored session counts towards the
+// limit of its user, and the oldest sessions are revoked to make room.
+//
+// The session is read and updated in one transaction, the update only
+// matching it while soft deleted, so concurrent restores restore it once.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, or it was deleted or restored meanwhile, nil if successful, otherwise an error
+func (store *store) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	var session SessionInterface
+
+	evictedIDs := []string{}
+
+	err := store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		var errPrepare error
+		session, errPrepare = sessionRestorePrepare(qctx, store, sessionID, options)
+
+		if errPrepare != nil {
+			return errPrepare
+		}
+
+		dataChanged := session.DataChanged()
+		delete(dataChanged, COLUMN_ID)
+
+		sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+			Update(store.sessionTableName).
+			Prepared(true).
+			Where(store.tenantScope(
+				goqu.C(COLUMN_ID).Eq(session.GetID()),
+				goqu.C(COLUMN_SOFT_DELETED_AT).Lte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)), // not restored meanwhile
+			)...).
+			Set(store.sqlRecord(dataChanged)).
+			ToSQL()
+
+		if errSql != nil {
+			return errSql
+		}
+
+		store.logSql("update", sqlStr, sqlParams...)
+
+		if store.isSessionLimitApplicable(session.GetUserID()) {
+			var errEnforce error
+			evictedIDs, errEnforce = store.sessionLimitEnforce(qctx, session.GetUserID(), session.GetID())
+
+			if errEnforce != nil {
+				return errEnforce
+			}
+		}
+
+		result, err := database.Execute(qctx, sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if affected < 1 {
+			return ErrSessionNotFound // deleted or restored by another request
+		}
+
+		if _, ok := dataChanged[COLUMN_EXPIRES_AT]; ok && store.writeBehind != nil {
+			store.writeBehind.remove(session.GetID()) // superseded by this update
+		}
+
+		return store.changesPublish(qctx, SessionChange{
+			Operation: CHANGE_OPERATION_UPDATE,
+			SessionID: session.GetID(),
+			UserID:    session.GetUserID(),
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	store.emitRevokedEvents(ctx, session.GetUserID(), evictedIDs)
+
+	store.emitEvent(ctx, SessionEvent{
+		Type:      SESSION_EVENT_RESTORED,
+		SessionID: session.GetID(),
+		UserID:    session.GetUserID(),
+		Count:     1,
+	})
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package sessionstore
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// isSessionLimitApplicable returns true if the per user session limit
+// must be enforced for a session belonging to the given user
+//
+// Parameters:
+//   - userID - the user id of the session
+//
+// Returns:
+//   - bool - true if the limit must be enforced
+func (store *store) isSessionLimitApplicable(userID string) bool {
+	return store.maxSessionsPerUser > 0 && userID != ""
+}
+
+// sessionLimitEnforce makes room for one more active session of the user,
+// according to the configured eviction policy.
+//
+// Must be run inside the same transaction as the statement attaching the
+// session to the user. The transactions attaching sessions to the same
+// user are serialized by sessionLimitLock, so that concurrent requests
+// cannot both pass the check.
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - userID - the user id
+//   - excludeSessionID - the session being created or updated, not counted
+//
+// Returns:
+//   - []string - the ids of the evicted sessions
+//   - error - ErrMaxSessionsPerUserReached if rejected, nil if successful, otherwise an error
+func (store *store) sessionLimitEnforce(ctx database.QueryableContext, userID string, excludeSessionID string) (evictedIDs []string, err error) {
+	if !store.isSessionLimitApplicable(userID) {
+		return []string{}, nil
+	}
+
+	if err := store.sessionLimitLock(ctx, userID); err != nil {
+		return []string{}, err
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	orderColumn := COLUMN_CREATED_AT
+	if store.evictionPolicy == EVICTION_POLICY_EVICT_LEAST_RECENTLY_UPDATED {
+		orderColumn = COLUMN_UPDATED_AT
+	}
+
+	var table any = store.sessionTableName
+
+	if store.dbDriverName == sb.DIALECT_MSSQL {
+		// range locks on the user's rows, held to the end of the transaction
+		table = goqu.L(`"` + store.sessionTableName + `" WITH (UPDLOCK, HOLDLOCK)`)
+	}
+
+	q := goqu.Dialect(store.dbDriverName).
+		From(table).
+		Select(COLUMN_ID).
+		Where(store.tenantScope(
+			goqu.C(COLUMN_USER_ID).Eq(userID),
+			goqu.C(COLUMN_EXPIRES_AT).Gte(now),
+			goqu.C(COLUMN_SOFT_DELETED_AT).Gt(now),
+		)...).
+		Order(goqu.C(orderColumn).Asc(), goqu.C(COLUMN_ID).Asc())
+
+	if excludeSessionID != "" {
+		q = q.Where(goqu.C(COLUMN_ID).Neq(excludeSessionID))
+	}
+
+	if store.dbDriverName == sb.DIALECT_MYSQL {
+		// next-key locks on the user id index, which block the inserts of
+		// other sessions of the user (REPEATABLE READ, the default)
+		q = q.ForUpdate(exp.Wait)
+	}
+
+	sqlStr, sqlParams, errSql := q.Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return []string{}, errSql
+	}
+
+	store.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return []string{}, err
+	}
+
+	if len(rows) < store.maxSessionsPerUser {
+		return []string{}, nil
+	}
+
+	if store.evictionPolicy == EVICTION_POLICY_REJECT {
+		return []string{}, ErrMaxSessionsPerUserReached
+	}
+
+	excess := len(rows) - store.maxSessionsPerUser + 1
+
+	evictedIDs = lo.Map(rows[:excess], func(row map[string]string, _ int) string {
+		return row[COLUMN_ID]
+	})
+
+	sqlStr, sqlParams, errSql = goqu.Dialect(store.dbDriverName).
+		Delete(store.sessionTableName).
+		Prepared(true).
+		Where(store.tenantScope(goqu.C(COLUMN_ID).In(evictedIDs))...).
+		ToSQL()
+
+	if errSql != nil {
+		return []string{}, errSql
+	}
+
+	store.logSql("delete", sqlStr, sqlParams...)
+
+	_, err = database.Execute(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return []string{}, err
+	}
+
+	changes := lo.Map(evictedIDs, func(id string, _ int) SessionChange {
+		return SessionChange{Operation: CHANGE_OPERATION_DELETE, SessionID: id, UserID: userID}
+	})
+
+	if err := store.changesPublish(ctx, changes...); err != nil {
+		return []string{}, err
+	}
+
+	return evictedIDs, nil
+}
+
+// sessionLimitLock serializes the transactions attaching sessions to a
+// user, as locking the user's existing rows does not stop the inserts of
+// new ones. Postgres takes a transaction level advisory lock on the user,
+// SQLite takes the database write lock up front. MySQL and SQL Server
+// lock the user's rows and the gaps around them in sessionLimitEnforce.
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - userID - the user id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) sessionLimitLock(ctx database.QueryableContext, userID string) error {
+	sqlStr := ""
+	sqlParams := []any{}
+
+	switch store.dbDriverName {
+	case sb.DIALECT_POSTGRES:
+		sqlStr = `SELECT pg_advisory_xact_lock(hashtext($1))`
+		sqlParams = append(sqlParams, store.sessionTableName+":"+userID)
+	case sb.DIALECT_SQLITE:
+		// a write matching no rows, as database/sql cannot BEGIN IMMEDIATE
+		sqlStr = `UPDATE "` + store.sessionTableName + `" SET "` + COLUMN_ID + `" = "` + COLUMN_ID + `" WHERE 1 = 0`
+	default:
+		return nil
+	}
+
+	store.logSql("lock", sqlStr, sqlParams...)
+
+	_, err := database.Execute(ctx, sqlStr, sqlParams...)
+
+	return err
+}
@@ -0,0 +1,285 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+)
+
+// SessionPromote upgrades an anonymous (guest) session to an authenticated
+// one, when the guest logs in. In a single transaction it:
+//   - attaches the user id to the session
+//   - merges the value of the user's most recent session into it, according
+//     to the merge strategy
+//   - regenerates the session key, to prevent session fixation
+//
+// The session is updated in place, so its new key can be sent to the client.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	if err := sessionPromoteValidate(session, userID, mergeStrategy); err != nil {
+		return err
+	}
+
+	newKey := generateSessionKey(100)
+	newValue := session.GetValue()
+	updatedAt := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+	evictedIDs := []string{}
+
+	err := store.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		var err error
+		newValue, err = sessionPromoteValue(qctx, store, session, userID, mergeStrategy)
+
+		if err != nil {
+			return err
+		}
+
+		evictedIDs, err = store.sessionLimitEnforce(qctx, userID, session.GetID())
+
+		if err != nil {
+			return err
+		}
+
+		sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+			Update(store.sessionTableName).
+			Prepared(true).
+			Set(goqu.Record{
+				COLUMN_USER_ID:       userID,
+				COLUMN_SESSION_KEY:   newKey,
+				COLUMN_SESSION_VALUE: store.sqlValue(newValue),
+				COLUMN_UPDATED_AT:    updatedAt,
+			}).
+			Where(store.tenantScope(
+				goqu.C(COLUMN_ID).Eq(session.GetID()),
+				goqu.C(COLUMN_SESSION_KEY).Eq(session.GetKey()),
+			)...).
+			ToSQL()
+
+		if errSql != nil {
+			return errSql
+		}
+
+		store.logSql("update", sqlStr, sqlParams...)
+
+		result, err := database.Execute(qctx, sqlStr, sqlParams...)
+
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if affected < 1 {
+			return ErrSessionNotFound
+		}
+
+		return store.changesPublish(qctx, SessionChange{
+			Operation: CHANGE_OPERATION_UPDATE,
+			SessionID: session.GetID(),
+			UserID:    userID,
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.SetUserID(userID)
+	session.SetKey(newKey)
+	session.SetValue(newValue)
+	session.SetUpdatedAt(updatedAt)
+	session.MarkAsNotDirty()
+
+	store.emitRevokedEvents(ctx, userID, evictedIDs)
+
+	return nil
+}
+
+// sessionPromoteByUpdate promotes a guest session in a store without
+// transactions, relying on SessionUpdate to move the session to its
+// regenerated key
+//
+// Parameters:
+//   - ctx - the context
+//   - st - the store
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func sessionPromoteByUpdate(ctx context.Context, st StoreInterface, session SessionInterface, userID string, mergeStrategy string) error {
+	if err := sessionPromoteValidate(session, userID, mergeStrategy); err != nil {
+		return err
+	}
+
+	newValue, err := sessionPromoteValue(ctx, st, session, userID, mergeStrategy)
+
+	if err != nil {
+		return err
+	}
+
+	oldUserID, oldKey, oldValue := session.GetUserID(), session.GetKey(), session.GetValue()
+
+	session.SetUserID(userID)
+	session.SetKey(generateSessionKey(100))
+	session.SetValue(newValue)
+
+	if err := st.SessionUpdate(ctx, session); err != nil {
+		session.SetUserID(oldUserID)
+		session.SetKey(oldKey)
+		session.SetValue(oldValue)
+		return err
+	}
+
+	return nil
+}
+
+// sessionPromoteValidate validates the arguments of a session promotion
+func sessionPromoteValidate(session SessionInterface, userID string, mergeStrategy string) error {
+	if session == nil {
+		return errors.New("sessionstore > session promote. session cannot be nil")
+	}
+
+	if userID == "" {
+		return errors.New("sessionstore > session promote. user id cannot be empty")
+	}
+
+	if session.GetUserID() != "" && session.GetUserID() != userID {
+		return errors.New("sessionstore > session promote. session belongs to another user")
+	}
+
+	if mergeStrategy != MERGE_STRATEGY_KEEP_GUEST &&
+		mergeStrategy != MERGE_STRATEGY_KEEP_USER &&
+		mergeStrategy != MERGE_STRATEGY_DEEP_MERGE {
+		return errors.New("sessionstore > session promote. merge strategy " + mergeStrategy + " is not supported")
+	}
+
+	return nil
+}
+
+// sessionPromoteValue returns the value of the promoted session, merging
+// the guest value with the value of the user's most recent other session
+//
+// Parameters:
+//   - ctx - the context
+//   - st - the store
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - string - the merged value
+//   - error - nil if successful, otherwise an error
+func sessionPromoteValue(ctx context.Context, st StoreInterface, session SessionInterface, userID string, mergeStrategy string) (string, error) {
+	previous, err := st.SessionList(ctx, SessionQuery().
+		SetUserID(userID).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetOrderBy(COLUMN_UPDATED_AT).
+		SetSortOrder(sb.DESC).
+		SetLimit(2))
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, previousSession := range previous {
+		if previousSession.GetID() == session.GetID() {
+			continue
+		}
+
+		return sessionValueMerge(session.GetValue(), previousSession.GetValue(), mergeStrategy)
+	}
+
+	return session.GetValue(), nil
+}
+
+// sessionValueMerge merges the value of a guest session with the value of
+// the user's previous session, according to the merge strategy
+//
+// Parameters:
+//   - guestValue - the value of the guest session
+//   - userValue - the value of the user's previous session
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - string - the merged value
+//   - error - nil if successful, otherwise an error
+func sessionValueMerge(guestValue string, userValue string, mergeStrategy string) (string, error) {
+	switch mergeStrategy {
+	case MERGE_STRATEGY_KEEP_GUEST:
+		if guestValue == "" {
+			return userValue, nil
+		}
+		return guestValue, nil
+	case MERGE_STRATEGY_KEEP_USER:
+		if userValue == "" {
+			return guestValue, nil
+		}
+		return userValue, nil
+	}
+
+	var guestMap map[string]any
+	var userMap map[string]any
+
+	errGuest := json.Unmarshal([]byte(guestValue), &guestMap)
+	errUser := json.Unmarshal([]byte(userValue), &userMap)
+
+	if errGuest != nil || errUser != nil || guestMap == nil || userMap == nil {
+		// not both JSON objects, nothing to deep merge
+		return sessionValueMerge(guestValue, userValue, MERGE_STRATEGY_KEEP_GUEST)
+	}
+
+	merged, err := json.Marshal(mapDeepMerge(userMap, guestMap))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(merged), nil
+}
+
+// mapDeepMerge merges src into dst recursively. Nested maps are merged,
+// any other values in src replace the ones in dst.
+func mapDeepMerge(dst map[string]any, src map[string]any) map[string]any {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]any)
+		dstMap, dstIsMap := dst[key].(map[string]any)
+
+		if srcIsMap && dstIsMap {
+			dst[key] = mapDeepMerge(dstMap, srcMap)
+			continue
+		}
+
+		dst[key] = srcValue
+	}
+
+	return dst
+}
+
+// storePromote promotes a guest session with SessionPromote if the store
+// implements PromoteStoreInterface, otherwise with an update, for stores
+// whose SessionUpdate moves a session to its changed key
+func storePromote(ctx context.Context, st StoreInterface, session SessionInterface, userID string, mergeStrategy string) error {
+	if promoter, ok := st.(PromoteStoreInterface); ok {
+		return promoter.SessionPromote(ctx, session, userID, mergeStrategy)
+	}
+
+	return sessionPromoteByUpdate(ctx, st, session, userID, mergeStrategy)
+}
@@ -0,0 +1,178 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/spf13/cast"
+)
+
+// SessionStats returns statistics of the sessions for dashboards, i.e.
+// the active sessions and users, the sessions created per hour or day,
+// and the top user agents. They are aggregated in SQL, with grouped
+// queries, without reading the sessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	stats := SessionStats{}
+
+	sessionQuery, err := statsQueryValidate(query)
+
+	if err != nil {
+		return stats, err
+	}
+
+	if store.db == nil {
+		return stats, errors.New("session store: database is nil")
+	}
+
+	base, _, err := store.sessionSelectQuery(sessionQuery)
+
+	if err != nil {
+		return stats, err
+	}
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	active := base.Where(
+		goqu.C(COLUMN_EXPIRES_AT).Gt(now),
+		goqu.C(COLUMN_SOFT_DELETED_AT).Gt(now),
+	)
+
+	rows, err := store.statsSelect(ctx, active.Select(
+		goqu.COUNT(goqu.Star()).As("active_sessions"),
+		goqu.L("COUNT(DISTINCT CASE WHEN ? <> '' THEN ? END)", goqu.C(COLUMN_USER_ID), goqu.C(COLUMN_USER_ID)).As("active_users"),
+		goqu.L("SUM(CASE WHEN ? <> '' THEN 1 ELSE 0 END)", goqu.C(COLUMN_USER_ID)).As("authenticated_sessions"),
+	))
+
+	if err != nil {
+		return SessionStats{}, err
+	}
+
+	if len(rows) > 0 {
+		stats.ActiveSessions = cast.ToInt64(rows[0]["active_sessions"])
+		stats.ActiveUsers = cast.ToInt64(rows[0]["active_users"])
+		stats.AuthenticatedSessions = cast.ToInt64(rows[0]["authenticated_sessions"]) // NULL without sessions
+		stats.AnonymousSessions = stats.ActiveSessions - stats.AuthenticatedSessions
+	}
+
+	if query.CreatedPer != "" {
+		period, err := store.sqlStatsPeriod(query.CreatedPer)
+
+		if err != nil {
+			return SessionStats{}, err
+		}
+
+		if stats.CreatedPerPeriod, err = store.statsCounts(ctx, base, period, false, 0); err != nil {
+			return SessionStats{}, err
+		}
+	}
+
+	if query.TopLimit > 0 {
+		if stats.TopUserAgents, err = store.statsCounts(ctx, active, goqu.C(COLUMN_USER_AGENT), true, query.TopLimit); err != nil {
+			return SessionStats{}, err
+		}
+
+		if stats.TopIPAddresses, err = store.statsCounts(ctx, active, goqu.C(COLUMN_IP_ADDRESS), true, query.TopLimit); err != nil {
+			return SessionStats{}, err
+		}
+	}
+
+	return stats, nil
+}
+
+// statsCounts counts the sessions of a query per value of an expression,
+// in ascending order of value, or in descending order of count if top
+func (store *store) statsCounts(ctx context.Context, q *goqu.SelectDataset, value goqu.Expression, top bool, limit int) ([]SessionStatsCount, error) {
+	q = q.Select(goqu.L("?", value).As("value"), goqu.COUNT(goqu.Star()).As("count")).
+		GroupBy(value)
+
+	if top {
+		q = q.Order(goqu.I("count").Desc(), goqu.L("?", value).Asc())
+	} else {
+		q = q.Order(goqu.L("?", value).Asc())
+	}
+
+	if limit > 0 {
+		q = q.Limit(uint(limit))
+	}
+
+	rows, err := store.statsSelect(ctx, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := []SessionStatsCount{}
+
+	for _, row := range rows {
+		counts = append(counts, SessionStatsCount{
+			Value: row["value"],
+			Count: cast.ToInt64(row["count"]),
+		})
+	}
+
+	return counts, nil
+}
+
+// statsSelect runs a statistics query
+func (store *store) statsSelect(ctx context.Context, q *goqu.SelectDataset) ([]map[string]string, error) {
+	sqlStr, sqlParams, errSql := q.Prepared(true).ToSQL()
+
+	if errSql != nil {
+		return nil, errSql
+	}
+
+	store.logSql("stats", sqlStr, sqlParams...)
+
+	return database.SelectToMapString(store.toQueryableContext(ctx), sqlStr, sqlParams...)
+}
+
+// sqlStatsPeriod returns the SQL expression truncating the creation time
+// to the period, formatted as the in-memory stores do, see statsPeriod.
+// On Postgres the column is TIMESTAMPTZ (see the postgres_timestamptz
+// migration), formatted in UTC whatever the time zone of the connection.
+func (store *store) sqlStatsPeriod(per string) (goqu.Expression, error) {
+	createdAt := goqu.C(COLUMN_CREATED_AT)
+
+	hour := per == STATS_PERIOD_HOUR
+
+	switch store.dbDriverName {
+	case sb.DIALECT_SQLITE:
+		if hour {
+			return goqu.L("strftime('%Y-%m-%d %H:00:00', ?)", createdAt), nil
+		}
+
+		return goqu.L("strftime('%Y-%m-%d', ?)", createdAt), nil
+	case sb.DIALECT_POSTGRES:
+		if hour {
+			return goqu.L("to_char(? AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00:00')", createdAt), nil
+		}
+
+		return goqu.L("to_char(? AT TIME ZONE 'UTC', 'YYYY-MM-DD')", createdAt), nil
+	case sb.DIALECT_MYSQL:
+		if hour {
+			return goqu.L("DATE_FORMAT(?, '%Y-%m-%d %H:00:00')", createdAt), nil
+		}
+
+		return goqu.L("DATE_FORMAT(?, '%Y-%m-%d')", createdAt), nil
+	case sb.DIALECT_MSSQL:
+		if hour {
+			return goqu.L("CONCAT(CONVERT(varchar(13), ?, 120), ':00:00')", createdAt), nil
+		}
+
+		return goqu.L("CONVERT(varchar(10), ?, 120)", createdAt), nil
+	default:
+		return nil, errors.New("session store: statistics per period are not supported for " + store.dbDriverName)
+	}
+}
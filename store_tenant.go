@@ -0,0 +1,83 @@
+package sessionstore
+
+import (
+	"errors"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/samber/lo"
+)
+
+// TenantStoreInterface is implemented by stores which can be scoped to a tenant
+type TenantStoreInterface interface {
+	ForTenant(tenantID string) StoreInterface
+}
+
+var _ TenantStoreInterface = (*store)(nil) // verify it extends the tenant store interface
+
+// ForTenant returns a view of the store scoped to a tenant. Every
+// statement of the view is restricted to the sessions of the tenant,
+// including the lookups by key and id, and the expiry sweep. The
+// sessions created through the view are assigned to the tenant.
+//
+// The view shares the database and the configuration of the store. A
+// view of a view is scoped to both tenants, so it matches nothing if
+// they differ.
+//
+// Parameters:
+//   - tenantID - the tenant id, empty for the sessions without a tenant
+//
+// Returns:
+//   - StoreInterface - the scoped view
+func (store *store) ForTenant(tenantID string) StoreInterface {
+	view := *store
+	view.tenantIDs = lo.Uniq(append(append([]string{}, store.tenantIDs...), tenantID))
+	return &view
+}
+
+// tenantScope appends the tenant conditions of the view, if any, to the
+// conditions of a statement
+//
+// Parameters:
+//   - wheres - the conditions of the statement
+//
+// Returns:
+//   - []goqu.Expression - the conditions, scoped to the tenant
+func (store *store) tenantScope(wheres ...goqu.Expression) []goqu.Expression {
+	scoped := append([]goqu.Expression{}, wheres...)
+
+	for _, tenantID := range store.tenantIDs {
+		scoped = append(scoped, goqu.C(COLUMN_TENANT_ID).Eq(tenantID))
+	}
+
+	return scoped
+}
+
+// tenantAssign assigns a session created through a view to the tenant
+// of the view, a session of another tenant is rejected
+//
+// Parameters:
+//   - session - the session
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) tenantAssign(session SessionInterface) error {
+	if len(store.tenantIDs) == 0 {
+		return nil
+	}
+
+	if len(store.tenantIDs) > 1 {
+		return errors.New("session store: the view is scoped to more than one tenant")
+	}
+
+	tenantID := store.tenantIDs[0]
+
+	if session.GetTenantID() != "" && session.GetTenantID() != tenantID {
+		return errors.New("session store: the session belongs to another tenant")
+	}
+
+	if _, ok := session.Data()[COLUMN_TENANT_ID]; !ok || session.GetTenantID() != tenantID {
+		session.SetTenantID(tenantID)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package sessionstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStore_ForTenant(t *testing.T) {
+	store := initMigrationStore(t)
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tenantA := store.ForTenant("a")
+	tenantB := store.ForTenant("b")
+
+	session := NewSession().SetUserID("1").SetValue("a's value")
+
+	if err := tenantA.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if session.GetTenantID() != "a" {
+		t.Fatal("session MUST be assigned to the tenant of the view, got:", session.GetTenantID())
+	}
+
+	found, err := tenantA.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetTenantID() != "a" {
+		t.Fatal("session MUST be found in its tenant, found:", found)
+	}
+
+	foundByB, err := tenantB.SessionFindByKey(context.Background(), session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if foundByB != nil {
+		t.Fatal("session MUST NOT be found by key in another tenant")
+	}
+
+	foundByB, err = tenantB.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if foundByB != nil {
+		t.Fatal("session MUST NOT be found by id in another tenant")
+	}
+
+	// writes through another tenant's view leave the session untouched
+	found.SetValue("b's value")
+
+	if err := tenantB.SessionUpdate(context.Background(), found); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := tenantB.SessionDeleteByID(context.Background(), session.GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	deleted, err := tenantB.(UserStoreInterface).SessionDeleteByUserID(context.Background(), "1", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 0 {
+		t.Fatal("sessions of another tenant MUST NOT be deleted, deleted:", deleted)
+	}
+
+	found, err = tenantA.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "a's value" {
+		t.Fatal("session MUST be untouched by another tenant, found:", found)
+	}
+
+	if err := tenantB.SessionCreate(context.Background(), NewSession().SetTenantID("a")); err == nil {
+		t.Fatal("session of another tenant MUST be rejected")
+	}
+
+	found.SetTenantID("b")
+
+	if err := tenantA.SessionUpdate(context.Background(), found); err == nil {
+		t.Fatal("session MUST NOT be moved to another tenant")
+	}
+
+	counts := map[string]int64{}
+
+	for name, view := range map[string]StoreInterface{"a": tenantA, "b": tenantB, "a+b": tenantA.(TenantStoreInterface).ForTenant("b")} {
+		count, err := view.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		counts[name] = count
+	}
+
+	if counts["a"] != 1 || counts["b"] != 0 || counts["a+b"] != 0 {
+		t.Fatal("unexpected counts per view:", counts)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery().SetTenantID("a"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("store MUST filter by tenant, got:", count)
+	}
+}
@@ -5,12 +5,20 @@ import (
 	"database/sql"
 	"errors"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/doug-martin/goqu/v9"
 	"github.com/dracory/sb"
 	"github.com/dromara/carbon/v2"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/samber/lo"
 )
 
 func initDB(filepath string) (*sql.DB, error) {
@@ -82,6 +90,153 @@ func TestStore_Automigrate(t *testing.T) {
 	}
 }
 
+func TestStore_Automigrate_AddsMissingIndexes(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	db.SetMaxOpenConns(1) // one in-memory database
+
+	// a table created by an earlier version, without indexes
+	_, err = db.Exec(`CREATE TABLE "session"("id" TEXT(40) PRIMARY KEY NOT NULL, "session_key" TEXT(255) NOT NULL, "user_id" TEXT(40) NOT NULL, "ip_address" TEXT(50) NOT NULL, "user_agent" TEXT(1024) NOT NULL, "session_value" TEXT NOT NULL, "expires_at" DATETIME NOT NULL, "created_at" DATETIME NOT NULL, "updated_at" DATETIME NOT NULL, "soft_deleted_at" DATETIME NOT NULL)`)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:               db,
+		SessionTableName: "session",
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.AutoMigrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// a second run finds the indexes and does not create them again
+	if err := store.AutoMigrate(context.Background()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	names, err := store.indexNames(context.Background())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, expected := range []string{"session_session_key_uindex", "session_expires_at_index", "session_user_id_index"} {
+		if !slices.Contains(names, expected) {
+			t.Fatal("index MUST be created:", expected, names)
+		}
+	}
+
+	session := NewSession()
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionCreate(context.Background(), NewSession().SetKey(session.GetKey())); err == nil {
+		t.Fatal("duplicate session key MUST be rejected by the unique index")
+	}
+}
+
+func TestStore_SQLCreateTable_Postgres(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:               db,
+		DbDriverName:     sb.DIALECT_POSTGRES,
+		SessionTableName: "session",
+		ValueColumnJSONB: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sqlStr := store.SQLCreateTable()
+
+	if !strings.Contains(sqlStr, `"expires_at" TIMESTAMPTZ NOT NULL`) {
+		t.Fatal("datetimes MUST be TIMESTAMPTZ on Postgres:", sqlStr)
+	}
+
+	alterSql := store.sqlAlterDatetimeColumn(COLUMN_EXPIRES_AT, "TIMESTAMPTZ")
+
+	if alterSql != `ALTER TABLE "session" ALTER COLUMN "expires_at" TYPE TIMESTAMPTZ USING "expires_at" AT TIME ZONE 'UTC';` {
+		t.Fatal("TIMESTAMP columns MUST be converted reading their values as UTC:", alterSql)
+	}
+
+	if !strings.Contains(sqlStr, `"session_value" JSONB,`) {
+		t.Fatal("value MUST be a nullable JSONB column:", sqlStr)
+	}
+
+	if record := store.sqlRecord(map[string]string{COLUMN_SESSION_VALUE: ""}); record[COLUMN_SESSION_VALUE] != nil {
+		t.Fatal("empty value MUST be written as NULL, got:", record[COLUMN_SESSION_VALUE])
+	}
+
+	sqlite, err := NewStore(NewStoreOptions{
+		DB:               db,
+		SessionTableName: "session",
+		ValueColumnJSONB: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if strings.Contains(sqlite.SQLCreateTable(), "JSONB") {
+		t.Fatal("JSONB MUST be ignored on the other databases")
+	}
+}
+
+func TestStore_SQLCreateIndexes_Dialects(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	expected := map[string]string{
+		sb.DIALECT_SQLITE:   `CREATE UNIQUE INDEX "session_session_key_uindex" ON "session" ("session_key");`,
+		sb.DIALECT_POSTGRES: `CREATE UNIQUE INDEX "session_session_key_uindex" ON "session" ("session_key");`,
+		sb.DIALECT_MYSQL:    "CREATE UNIQUE INDEX `session_session_key_uindex` ON `session` (`session_key`);",
+		sb.DIALECT_MSSQL:    `CREATE UNIQUE INDEX [session_session_key_uindex] ON [session] ([session_key]);`,
+	}
+
+	for dialect, uniqueIndex := range expected {
+		store, err := NewStore(NewStoreOptions{
+			DB:               db,
+			DbDriverName:     dialect,
+			SessionTableName: "session",
+		})
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		sqls := store.SQLCreateIndexes()
+
+		if !lo.Contains(sqls, uniqueIndex) {
+			t.Fatal("Expected the unique index on", dialect, uniqueIndex, "found:", sqls)
+		}
+
+		if strings.Contains(strings.Join(sqls[1:], "\n"), "UNIQUE") {
+			t.Fatal("Only the session key index MUST be unique on", dialect, sqls)
+		}
+	}
+}
+
 func TestStore_EnableDebug(t *testing.T) {
 	store, err := initStore(":memory:")
 
@@ -677,3 +832,2053 @@ func TestStore_SessionUpdate(t *testing.T) {
 		t.Fatal("Value MUST be 'one two three', found: ", sessionFound.GetValue())
 	}
 }
+
+func TestStore_SessionCreate_MaxSessionsPerUserReject(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+		MaxSessionsPerUser: 2,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	for i := 0; i < 2; i++ {
+		err = store.SessionCreate(context.Background(), NewSession().SetUserID("1"))
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	err = store.SessionCreate(context.Background(), NewSession().SetUserID("1"))
+
+	if !errors.Is(err, ErrMaxSessionsPerUserReached) {
+		t.Fatal("expected ErrMaxSessionsPerUserReached, found:", err)
+	}
+
+	err = store.SessionCreate(context.Background(), NewSession().SetUserID("2"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	anonymous := NewSession()
+
+	err = store.SessionCreate(context.Background(), anonymous)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	anonymous.SetUserID("1")
+
+	err = store.SessionUpdate(context.Background(), anonymous)
+
+	if !errors.Is(err, ErrMaxSessionsPerUserReached) {
+		t.Fatal("expected ErrMaxSessionsPerUserReached, found:", err)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatal("unexpected session count:", count)
+	}
+}
+
+func TestStore_SessionCreate_MaxSessionsPerUserConcurrent(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "session.db")+"?_busy_timeout=10000")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	defer db.Close()
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+		MaxSessionsPerUser: 2,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	errs := make([]error, 10)
+	wg := sync.WaitGroup{}
+
+	for i := range errs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs[i] = store.SessionCreate(context.Background(), NewSession().SetUserID("1"))
+		}()
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrMaxSessionsPerUserReached) {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatal("concurrent creates MUST NOT exceed the limit, found:", count)
+	}
+}
+
+func TestStore_SessionCreate_MaxSessionsPerUserEvictOldest(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                    db,
+		SessionTableName:      "session",
+		AutomigrateEnabled:    true,
+		MaxSessionsPerUser:    2,
+		SessionEvictionPolicy: EVICTION_POLICY_EVICT_OLDEST,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	oldest := NewSession().
+		SetUserID("1").
+		SetCreatedAt(carbon.Now(carbon.UTC).SubMinutes(10).ToDateTimeString(carbon.UTC))
+
+	middle := NewSession().
+		SetUserID("1").
+		SetCreatedAt(carbon.Now(carbon.UTC).SubMinutes(5).ToDateTimeString(carbon.UTC))
+
+	newest := NewSession().
+		SetUserID("1")
+
+	for _, session := range []SessionInterface{oldest, middle, newest} {
+		err = store.SessionCreate(context.Background(), session)
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 2 {
+		t.Fatal("unexpected session list length:", len(list))
+	}
+
+	for _, session := range list {
+		if session.GetID() == oldest.GetID() {
+			t.Fatal("oldest session MUST be evicted")
+		}
+	}
+}
+
+func TestStore_SessionDeleteByUserID(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	events := []SessionEvent{}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+		EventHandler: func(ctx context.Context, event SessionEvent) {
+			events = append(events, event)
+		},
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	current := NewSession().SetUserID("1")
+
+	for _, session := range []SessionInterface{current, NewSession().SetUserID("1"), NewSession().SetUserID("1"), NewSession().SetUserID("2")} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	deleted, err := store.SessionDeleteByUserID(context.Background(), "1", current.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 2 {
+		t.Fatal("unexpected deleted count:", deleted)
+	}
+
+	list, err := store.SessionList(context.Background(), SessionQuery().SetUserID("1").SetSoftDeletedIncluded(true))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetID() != current.GetID() {
+		t.Fatal("only the current session MUST remain, found:", len(list))
+	}
+
+	if len(events) != 1 || events[0].Type != SESSION_EVENT_REVOKED || events[0].Count != 2 || events[0].UserID != "1" {
+		t.Fatal("unexpected events:", events)
+	}
+}
+
+func TestStore_SessionSoftDeleteByUserID(t *testing.T) {
+	storeInterface, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store := storeInterface.(*store)
+
+	for _, session := range []SessionInterface{NewSession().SetUserID("1"), NewSession().SetUserID("1"), NewSession().SetUserID("2")} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	softDeleted, err := store.SessionSoftDeleteByUserID(context.Background(), "1", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if softDeleted != 2 {
+		t.Fatal("unexpected soft deleted count:", softDeleted)
+	}
+
+	count, err := store.SessionCount(context.Background(), SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 0 {
+		t.Fatal("unexpected active session count:", count)
+	}
+
+	count, err = store.SessionCount(context.Background(), SessionQuery().SetUserID("2"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("unexpected active session count for other user:", count)
+	}
+}
+
+func TestStore_UserSessions(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                      db,
+		SessionTableName:        "session",
+		AutomigrateEnabled:      true,
+		UserSessionHandleSecret: "secret",
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	current := NewSession().
+		SetUserID("1").
+		SetIPAddress("10.0.0.1").
+		SetUserAgent("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	other := NewSession().
+		SetUserID("1").
+		SetIPAddress("10.0.0.2").
+		SetUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+	for _, session := range []SessionInterface{current, other, NewSession().SetUserID("2")} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	userSessions, err := store.UserSessions(context.Background(), "1", current.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(userSessions) != 2 {
+		t.Fatal("unexpected user sessions length:", len(userSessions))
+	}
+
+	var otherHandle string
+
+	for _, userSession := range userSessions {
+		if strings.Contains(userSession.Handle, current.GetID()) || strings.Contains(userSession.Handle, current.GetKey()) {
+			t.Fatal("handle MUST NOT expose the session id or key")
+		}
+
+		if userSession.IPAddress == current.GetIPAddress() {
+			if !userSession.IsCurrent || userSession.OS != "iOS" || userSession.DeviceType != DEVICE_TYPE_MOBILE {
+				t.Fatal("unexpected current user session:", userSession)
+			}
+		} else {
+			if userSession.IsCurrent || userSession.Browser != "Chrome" {
+				t.Fatal("unexpected other user session:", userSession)
+			}
+			otherHandle = userSession.Handle
+		}
+	}
+
+	err = store.UserSessionRevoke(context.Background(), "2", otherHandle)
+
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("handle MUST NOT revoke sessions of another user, found:", err)
+	}
+
+	err = store.UserSessionRevoke(context.Background(), "1", otherHandle)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	sessionFound, err := store.SessionFindByID(context.Background(), other.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if sessionFound != nil {
+		t.Fatal("revoked session MUST be deleted")
+	}
+}
+
+func TestStore_UserSessionHandleSecret(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	newStore := func(secret string) *store {
+		store, err := NewStore(NewStoreOptions{
+			DB:                      db,
+			SessionTableName:        "session",
+			AutomigrateEnabled:      true,
+			UserSessionHandleSecret: secret,
+		})
+
+		if err != nil {
+			t.Fatal("Store could not be created: ", err.Error())
+		}
+
+		return store
+	}
+
+	storeA, storeB, storeOther := newStore("secret"), newStore("secret"), newStore("other secret")
+
+	if _, err := newStore("").UserSessions(context.Background(), "1", ""); !errors.Is(err, ErrUserSessionHandleSecretRequired) {
+		t.Fatal("user sessions MUST require a secret, found:", err)
+	}
+
+	if err := newStore("").UserSessionRevoke(context.Background(), "1", "handle"); !errors.Is(err, ErrUserSessionHandleSecretRequired) {
+		t.Fatal("user session revoke MUST require a secret, found:", err)
+	}
+
+	session := NewSession().SetUserID("1")
+
+	if err := storeA.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if userSessionHandle(nil, "1", session.GetID()) == userSessionHandle([]byte("secret"), "1", session.GetID()) {
+		t.Fatal("handle MUST be keyed with the secret")
+	}
+
+	userSessions, err := storeA.UserSessions(context.Background(), "1", "")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(userSessions) != 1 {
+		t.Fatal("unexpected user sessions length:", len(userSessions))
+	}
+
+	err = storeOther.UserSessionRevoke(context.Background(), "1", userSessions[0].Handle)
+
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("handle MUST NOT revoke with another secret, found:", err)
+	}
+
+	err = storeB.UserSessionRevoke(context.Background(), "1", userSessions[0].Handle)
+
+	if err != nil {
+		t.Fatal("handle MUST revoke with the same secret, found:", err)
+	}
+}
+
+func TestStore_FindByKey_BindingPolicy(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	userAgentUpgraded := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
+
+	session := NewSession().
+		SetIPAddress("192.168.1.10").
+		SetUserAgent(userAgent)
+
+	err = store.SessionCreate(context.Background(), session)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	options := NewSessionOptions()
+	options.SetIPAddress("192.168.1.99")
+	options.SetUserAgent(userAgent)
+	options.SetBindingPolicy(BINDING_POLICY_NETWORK_PREFIX)
+
+	found, err := store.FindByKey(context.Background(), session.GetKey(), options)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("session in the same /24 network MUST be found")
+	}
+
+	options.SetIPAddress("192.168.2.10")
+
+	found, err = store.FindByKey(context.Background(), session.GetKey(), options)
+
+	var mismatch *ErrBindingMismatch
+
+	if !errors.As(err, &mismatch) {
+		t.Fatal("expected ErrBindingMismatch, found:", err)
+	}
+
+	if found != nil {
+		t.Fatal("session MUST be nil on mismatch")
+	}
+
+	if mismatch.Field != COLUMN_IP_ADDRESS || mismatch.Expected != "192.168.1.10" || mismatch.Actual != "192.168.2.10" || mismatch.Revoked {
+		t.Fatal("unexpected mismatch details:", mismatch)
+	}
+
+	options = NewSessionOptions()
+	options.SetIPAddress("10.0.0.1")
+	options.SetUserAgent(userAgentUpgraded)
+	options.SetBindingPolicy(BINDING_POLICY_USER_AGENT_FAMILY)
+
+	found, err = store.FindByKey(context.Background(), session.GetKey(), options)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("session with the same user agent family MUST be found")
+	}
+
+	options.SetBindingPolicy(BINDING_POLICY_EXACT)
+	options.SetRevokeOnBindingMismatch(true)
+
+	_, err = store.FindByKey(context.Background(), session.GetKey(), options)
+
+	if !errors.As(err, &mismatch) || !mismatch.Revoked {
+		t.Fatal("expected revoked ErrBindingMismatch, found:", err)
+	}
+
+	found, err = store.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("session MUST be revoked")
+	}
+}
+
+func TestStore_Delete_BindingPolicy(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	session := NewSession().
+		SetIPAddress("192.168.1.10").
+		SetUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+	if err := store.SessionCreate(context.Background(), session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	options := NewSessionOptions()
+	options.SetIPAddress("192.168.1.99")
+	options.SetUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	options.SetBindingPolicy(BINDING_POLICY_NETWORK_PREFIX)
+
+	if err := store.Delete(context.Background(), session.GetKey(), options); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByID(context.Background(), session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("session accepted by the binding policy MUST be deleted")
+	}
+}
+
+func TestIPNetworkPrefixMatch(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"192.168.1.10", "192.168.1.200", true},
+		{"192.168.1.10:5555", "192.168.1.11:6666", true},
+		{"192.168.1.10", "192.168.2.10", false},
+		{"2001:db8:1:2::1", "2001:db8:1:2:ffff::1", true},
+		{"[2001:db8:1:2::1]:443", "2001:db8:1:2::5", true},
+		{"2001:db8:1:2::1", "2001:db8:1:3::1", false},
+		{"192.168.1.10", "2001:db8:1:2::1", false},
+		{"unknown", "unknown", true},
+	}
+
+	for _, test := range tests {
+		if ipNetworkPrefixMatch(test.a, test.b) != test.expected {
+			t.Fatal("unexpected result for:", test.a, test.b)
+		}
+	}
+}
+
+func TestStore_SessionPromote(t *testing.T) {
+	storeInterface, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store := storeInterface.(*store)
+
+	previous := NewSession().
+		SetUserID("1").
+		SetValue(`{"cart":{"apple":1},"theme":"dark"}`)
+
+	guest := NewSession().
+		SetValue(`{"cart":{"pear":2},"theme":"light"}`)
+
+	for _, session := range []SessionInterface{previous, guest} {
+		if err := store.SessionCreate(context.Background(), session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	guestKey := guest.GetKey()
+
+	err = store.SessionPromote(context.Background(), guest, "1", MERGE_STRATEGY_DEEP_MERGE)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if guest.GetKey() == guestKey {
+		t.Fatal("session key MUST be regenerated")
+	}
+
+	found, err := store.SessionFindByKey(context.Background(), guestKey)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("old session key MUST NOT be valid anymore")
+	}
+
+	found, err = store.SessionFindByKey(context.Background(), guest.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("Session MUST NOT be nil")
+	}
+
+	if found.GetUserID() != "1" {
+		t.Fatal("unexpected user id:", found.GetUserID())
+	}
+
+	if found.GetValue() != `{"cart":{"apple":1,"pear":2},"theme":"light"}` {
+		t.Fatal("unexpected merged value:", found.GetValue())
+	}
+}
+
+func TestSessionValueMerge(t *testing.T) {
+	tests := []struct {
+		guest, user, strategy, expected string
+	}{
+		{`{"a":1}`, `{"b":2}`, MERGE_STRATEGY_KEEP_GUEST, `{"a":1}`},
+		{``, `{"b":2}`, MERGE_STRATEGY_KEEP_GUEST, `{"b":2}`},
+		{`{"a":1}`, `{"b":2}`, MERGE_STRATEGY_KEEP_USER, `{"b":2}`},
+		{`{"a":1}`, ``, MERGE_STRATEGY_KEEP_USER, `{"a":1}`},
+		{`{"a":{"x":1},"c":3}`, `{"a":{"y":2},"c":4}`, MERGE_STRATEGY_DEEP_MERGE, `{"a":{"x":1,"y":2},"c":3}`},
+		{`plain`, `{"b":2}`, MERGE_STRATEGY_DEEP_MERGE, `plain`},
+	}
+
+	for _, test := range tests {
+		merged, err := sessionValueMerge(test.guest, test.user, test.strategy)
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if merged != test.expected {
+			t.Fatal("unexpected merge result for:", test.strategy, "expected:", test.expected, "found:", merged)
+		}
+	}
+}
+
+func TestStore_SessionChanges(t *testing.T) {
+	db, err := initDB(filepath.Join(t.TempDir(), "sessions.db"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	defer db.Close()
+
+	newStore := func() *store {
+		store, err := NewStore(NewStoreOptions{
+			DB:                         db,
+			SessionTableName:           "session",
+			AutomigrateEnabled:         true,
+			ChangeNotificationsEnabled: true,
+		})
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		return store
+	}
+
+	storeA := newStore()
+	storeB := newStore()
+	ctx := context.Background()
+
+	cachedB, err := NewCachedStore(storeB, CacheOptions{})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	session := NewSession().SetUserID("1")
+
+	if err := storeA.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, err := cachedB.SessionFindByKey(ctx, session.GetKey()); err != nil || found == nil {
+		t.Fatal("Expected the session to be found, error:", err)
+	}
+
+	if err := storeA.SessionUpdate(ctx, session.SetValue("two")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := storeA.SessionSoftDelete(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := storeA.SessionDeleteByUserID(ctx, "1", ""); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	changes := []SessionChange{}
+	seen := map[string]struct{}{}
+
+	handler := func(ctx context.Context, change SessionChange) {
+		changes = append(changes, change)
+		cachedB.SessionChangeHandle(ctx, change)
+	}
+
+	if err := storeB.changesPoll(ctx, seen, handler); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	operations := []string{}
+	for _, change := range changes {
+		operations = append(operations, change.Operation)
+	}
+
+	expected := []string{
+		CHANGE_OPERATION_CREATE,
+		CHANGE_OPERATION_UPDATE,
+		CHANGE_OPERATION_SOFT_DELETE,
+		CHANGE_OPERATION_DELETE,
+	}
+
+	if strings.Join(operations, ",") != strings.Join(expected, ",") {
+		t.Fatal("Expected operations", expected, "found:", operations)
+	}
+
+	if changes[0].SessionID != session.GetID() || changes[3].SessionID != "" || changes[3].UserID != "1" {
+		t.Fatal("unexpected changes:", changes)
+	}
+
+	if found, _ := cachedB.SessionFindByKey(ctx, session.GetKey()); found != nil {
+		t.Fatal("Session deleted by another instance MUST NOT be served from the cache")
+	}
+
+	changes = []SessionChange{}
+
+	if err := storeB.changesPoll(ctx, seen, handler); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(changes) != 0 {
+		t.Fatal("Changes MUST NOT be delivered twice, found:", changes)
+	}
+
+	// Subscribing replays the recent changes, after a reset
+	ctxSubscribe, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	changes = []SessionChange{}
+
+	err = storeB.SessionChangesSubscribe(ctxSubscribe, SessionChangesSubscribeOptions{
+		Handler:      handler,
+		PollInterval: 50 * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(changes) != 5 || changes[0].Operation != CHANGE_OPERATION_RESET {
+		t.Fatal("Expected a reset followed by 4 changes, found:", changes)
+	}
+}
+
+func TestStore_SessionChangesDisabled(t *testing.T) {
+	st, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = st.(SessionChangeSubscriberInterface).SessionChangesSubscribe(context.Background(), SessionChangesSubscribeOptions{
+		Handler: func(ctx context.Context, change SessionChange) {},
+	})
+
+	if err == nil {
+		t.Fatal("Subscribing MUST fail when change notifications are disabled")
+	}
+}
+
+func TestStore_SessionExtend_WriteBehind(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	st, err := NewStore(NewStoreOptions{
+		DB:                  db,
+		SessionTableName:    "session",
+		AutomigrateEnabled:  true,
+		WriteBehindInterval: time.Minute,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	session := NewSession().SetExpiresAt(carbon.Now(carbon.UTC).AddHours(1).ToDateTimeString(carbon.UTC))
+	expiringSession := NewSession().SetExpiresAt(carbon.Now(carbon.UTC).AddSeconds(30).ToDateTimeString(carbon.UTC))
+
+	for _, s := range []SessionInterface{session, expiringSession} {
+		if err := st.SessionCreate(ctx, s); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	storedExpiresAt := func(id string) string {
+		found, err := st.SessionFindByID(ctx, id)
+
+		if err != nil || found == nil {
+			t.Fatal("Expected the session to be found, error:", err)
+		}
+
+		return found.GetExpiresAtCarbon().ToDateTimeString(carbon.UTC)
+	}
+
+	originalExpiresAt := session.GetExpiresAt()
+
+	// Extensions are coalesced in memory
+	for i := 0; i < 3; i++ {
+		if err := st.SessionExtend(ctx, session, 7200); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if st.writeBehind.len() != 1 {
+		t.Fatal("Expected 1 pending extension, found:", st.writeBehind.len())
+	}
+
+	if storedExpiresAt(session.GetID()) != originalExpiresAt {
+		t.Fatal("Extension MUST NOT be written before the flush")
+	}
+
+	// Sessions about to expire are extended synchronously
+	if err := st.SessionExtend(ctx, expiringSession, 7200); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedExpiresAt(expiringSession.GetID()) != expiringSession.GetExpiresAt() {
+		t.Fatal("Extension of a session about to expire MUST be written synchronously")
+	}
+
+	if err := st.SessionFlush(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedExpiresAt(session.GetID()) != session.GetExpiresAt() {
+		t.Fatal("Expected the extension to be flushed, found:", storedExpiresAt(session.GetID()))
+	}
+
+	if st.writeBehind.len() != 0 {
+		t.Fatal("Expected no pending extensions, found:", st.writeBehind.len())
+	}
+
+	// Value changes are written synchronously, with the extension
+	session.SetValue("changed")
+
+	if err := st.SessionExtend(ctx, session, 10800); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if st.writeBehind.len() != 0 || storedExpiresAt(session.GetID()) != session.GetExpiresAt() {
+		t.Fatal("Extension with a value change MUST be written synchronously")
+	}
+}
+
+// assertSessionListFilters checks the filters of the session query on a
+// store, so the SQL and the in-memory filtering can be compared
+func assertSessionListFilters(t *testing.T, store StoreInterface) {
+	ctx := context.Background()
+
+	guest := NewSession().
+		SetIPAddress("10.1.17.4:5555").
+		SetUserAgent("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0)").
+		SetUpdatedAt("2026-01-01 00:00:00")
+
+	user := NewSession().
+		SetUserID("1").
+		SetIPAddress("10.1.40.1").
+		SetUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64)").
+		SetUpdatedAt("2026-02-01 00:00:00")
+
+	expired := NewSession().
+		SetUserID("2").
+		SetIPAddress("2001:db8::1").
+		SetUserAgent("curl/8.0 100%_sure").
+		SetUpdatedAt("2026-03-01 00:00:00").
+		SetExpiresAt("2020-01-01 00:00:00")
+
+	deleted := NewSession().
+		SetUserID("3").
+		SetIPAddress("192.168.0.1").
+		SetUpdatedAt("2026-04-01 00:00:00")
+
+	for _, session := range []SessionInterface{guest, user, expired, deleted} {
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.SessionSoftDelete(ctx, deleted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    SessionQueryInterface
+		expected []SessionInterface
+	}{
+		{"key in", SessionQuery().SetKeyIn([]string{guest.GetKey(), user.GetKey(), user.GetKey()}), []SessionInterface{guest, user}},
+		{"user id in", SessionQuery().SetUserIDIn([]string{"1", "2"}), []SessionInterface{user, expired}},
+		{"user id not empty", SessionQuery().SetUserIDNotEmpty(true), []SessionInterface{user, expired}},
+		{"ip prefix", SessionQuery().SetUserIpAddressPrefix("2001:DB8:"), []SessionInterface{expired}},
+		{"ip cidr", SessionQuery().SetUserIpAddressCIDR("10.1.16.0/20"), []SessionInterface{guest}},
+		{"ip cidr host", SessionQuery().SetUserIpAddressCIDR("10.1.17.4/32"), []SessionInterface{guest}},
+		{"user agent contains", SessionQuery().SetUserAgentContains("iphone"), []SessionInterface{guest}},
+		{"user agent contains wildcards", SessionQuery().SetUserAgentContains("100%_"), []SessionInterface{expired}},
+		{"user agent contains literally", SessionQuery().SetUserAgentContains("0%_s_"), []SessionInterface{}},
+		{"updated at range", SessionQuery().SetUpdatedAtGte("2026-01-15 00:00:00").SetUpdatedAtLte("2026-03-15 00:00:00"), []SessionInterface{user, expired}},
+		{"soft deleted only", SessionQuery().SetSoftDeletedOnly(true), []SessionInterface{deleted}},
+		{"expired only", SessionQuery().SetExpiredOnly(true), []SessionInterface{expired}},
+	}
+
+	for _, test := range tests {
+		list, err := store.SessionList(ctx, test.query.SetOrderBy(COLUMN_UPDATED_AT).SetSortOrder("asc"))
+
+		if err != nil {
+			t.Fatal(test.name, "unexpected error:", err)
+		}
+
+		ids := lo.Map(list, func(session SessionInterface, _ int) string { return session.GetID() })
+		expected := lo.Map(test.expected, func(session SessionInterface, _ int) string { return session.GetID() })
+
+		if !slices.Equal(ids, expected) {
+			t.Fatal(test.name, "expected:", expected, "got:", ids)
+		}
+	}
+}
+
+func TestStore_SessionList_Filters(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionListFilters(t, store)
+}
+
+func TestSessionQuery_Validate(t *testing.T) {
+	invalid := []SessionQueryInterface{
+		SessionQuery().SetKeyIn([]string{}),
+		SessionQuery().SetUserIDIn([]string{}),
+		SessionQuery().SetUpdatedAtGte(""),
+		SessionQuery().SetUserIpAddressPrefix(""),
+		SessionQuery().SetUserIpAddressCIDR("10.1.16.0"),
+		SessionQuery().SetUserIpAddressCIDR("2001:db8::/32"),
+		SessionQuery().SetUserAgentContains(""),
+		SessionQuery().SetSoftDeletedOnly(true).SetSoftDeletedIncluded(false),
+	}
+
+	for _, query := range invalid {
+		if query.Validate() == nil {
+			t.Fatal("query MUST be invalid:", query)
+		}
+	}
+}
+
+func TestIPv4CIDRPatterns(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		expected []string
+	}{
+		{"10.0.0.0/8", []string{"10."}},
+		{"10.1.16.0/22", []string{"10.1.16.", "10.1.17.", "10.1.18.", "10.1.19."}},
+		{"10.1.2.3/32", []string{"10.1.2.3"}},
+		{"10.1.2.3/31", []string{"10.1.2.2", "10.1.2.3"}},
+	}
+
+	for _, test := range tests {
+		patterns, err := ipv4CIDRPatterns(test.cidr)
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if !slices.Equal(patterns, test.expected) {
+			t.Fatal("unexpected patterns for:", test.cidr, patterns)
+		}
+	}
+
+	patterns, _ := ipv4CIDRPatterns("0.0.0.0/0")
+
+	if len(patterns) != 256 {
+		t.Fatal("unexpected patterns for 0.0.0.0/0:", len(patterns))
+	}
+}
+
+// assertSessionListPages checks the cursor pagination and the iteration
+// of a store, with sessions created in the same second
+func assertSessionListPages(t *testing.T, st StoreInterface) {
+	ctx := context.Background()
+
+	store, ok := st.(interface {
+		StoreInterface
+		PagingStoreInterface
+	})
+
+	if !ok {
+		t.Fatal("store MUST implement PagingStoreInterface")
+	}
+
+	for i := 0; i < 25; i++ {
+		session := NewSession().
+			SetUserID("1").
+			SetCreatedAt("2026-01-01 00:00:0" + strconv.Itoa(i%3))
+
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	ids := []string{}
+	query := SessionQuery().SetUserID("1").SetLimit(10)
+
+	for page := 0; ; page++ {
+		sessions, next, err := store.SessionListPage(ctx, query)
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		for _, session := range sessions {
+			ids = append(ids, session.GetID())
+		}
+
+		if page == 0 {
+			// created while paging, before the first page in the order
+			if err := store.SessionCreate(ctx, NewSession().SetUserID("1").SetCreatedAt("2026-01-01 00:00:09")); err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+		}
+
+		if next == "" {
+			if len(sessions) != 5 {
+				t.Fatal("last page MUST hold the remaining sessions, got:", len(sessions))
+			}
+
+			break
+		}
+
+		query.SetCursor(next)
+	}
+
+	if len(ids) != 25 || len(lo.Uniq(ids)) != 25 {
+		t.Fatal("pages MUST hold each session once, got:", len(ids), len(lo.Uniq(ids)))
+	}
+
+	iterated := []string{}
+
+	err := store.SessionIterate(ctx, SessionQuery().SetUserID("1").SetLimit(4).SetSortOrder("asc"), func(session SessionInterface) error {
+		iterated = append(iterated, session.GetID())
+
+		if len(iterated) == 20 {
+			return ErrStopIteration
+		}
+
+		return store.SessionUpdate(ctx, session.SetValue("exported"))
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(iterated) != 20 || len(lo.Uniq(iterated)) != 20 {
+		t.Fatal("iteration MUST stop on ErrStopIteration, got:", len(iterated))
+	}
+
+	count, err := store.SessionCount(ctx, SessionQuery().SetUserID("1"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 26 {
+		t.Fatal("unexpected count:", count)
+	}
+
+	if _, _, err := store.SessionListPage(ctx, SessionQuery().SetCursor("not a cursor")); err == nil {
+		t.Fatal("invalid cursor MUST be rejected")
+	}
+}
+
+// assertSessionIndexPages checks the cursor pagination of a store over
+// queries without a key, id or user lookup, in both orders and within
+// created_at bounds, against the order of SessionList
+func assertSessionIndexPages(t *testing.T, st StoreInterface) {
+	ctx := context.Background()
+
+	store, ok := st.(interface {
+		StoreInterface
+		PagingStoreInterface
+	})
+
+	if !ok {
+		t.Fatal("store MUST implement PagingStoreInterface")
+	}
+
+	for i := 0; i < 30; i++ {
+		session := NewSession().
+			SetUserID(strconv.Itoa(i)).
+			SetUserAgent(lo.Ternary(i%2 == 0, "Firefox", "Chrome")).
+			SetCreatedAt("2026-01-01 00:00:0" + strconv.Itoa(i%5))
+
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	for _, order := range []string{sb.DESC, sb.ASC} {
+		queries := []SessionQueryInterface{
+			SessionQuery(),
+			SessionQuery().SetUserAgentContains("Firefox"),
+			SessionQuery().SetCreatedAtGte("2026-01-01 00:00:01").SetCreatedAtLte("2026-01-01 00:00:03"),
+		}
+
+		for _, query := range queries {
+			list, err := store.SessionList(ctx, sessionQueryCopy(query).SetOrderBy(COLUMN_CREATED_AT).SetSortOrder(order))
+
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			expected := lo.Map(list, func(session SessionInterface, _ int) string { return session.GetID() })
+
+			ids := []string{}
+			query.SetSortOrder(order).SetLimit(4)
+
+			for {
+				sessions, next, err := store.SessionListPage(ctx, query)
+
+				if err != nil {
+					t.Fatal("unexpected error:", err)
+				}
+
+				if len(sessions) > 4 {
+					t.Fatal("page MUST hold at most the limit, got:", len(sessions))
+				}
+
+				for _, session := range sessions {
+					ids = append(ids, session.GetID())
+				}
+
+				if next == "" {
+					break
+				}
+
+				query.SetCursor(next)
+			}
+
+			if !slices.Equal(ids, expected) {
+				t.Fatal("pages MUST hold the sessions of the list, in order", order, ids, expected)
+			}
+		}
+	}
+
+	// the session of the cursor deleted before the next page
+	sessions, next, err := store.SessionListPage(ctx, SessionQuery().SetLimit(10))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionDelete(ctx, sessions[9]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	rest, _, err := store.SessionListPage(ctx, SessionQuery().SetLimit(100).SetCursor(next))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(rest) != 20 {
+		t.Fatal("next page MUST hold the remaining sessions, got:", len(rest))
+	}
+
+	// the pages follow the keyset order, not the sorts of SetOrderByColumns
+	iterated := 0
+
+	err = store.SessionIterate(ctx, SessionQuery().SetLimit(4).SetOrderByColumns([]SortColumn{
+		{Column: COLUMN_EXPIRES_AT, Order: sb.ASC},
+	}), func(session SessionInterface) error {
+		iterated++
+		return nil
+	})
+
+	var errSort *ErrInvalidSort
+
+	if !errors.As(err, &errSort) || errSort.Column != COLUMN_EXPIRES_AT {
+		t.Fatal("iterating with order_by_columns MUST return ErrInvalidSort, got:", err)
+	}
+
+	if iterated != 0 {
+		t.Fatal("no session MUST be iterated with order_by_columns, got:", iterated)
+	}
+}
+
+func TestStore_SessionListPage(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionListPages(t, store)
+}
+
+func TestStore_SessionListPage_Index(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionIndexPages(t, store)
+}
+
+// assertSessionListSorts checks the multi-column sorts of a store, and
+// the rejection of unknown sort columns
+func assertSessionListSorts(t *testing.T, store StoreInterface) {
+	ctx := context.Background()
+
+	sessions := []SessionInterface{
+		NewSession().SetUserID("2").SetUpdatedAt("2026-01-01 00:00:00"),
+		NewSession().SetUserID("1").SetUpdatedAt("2026-01-01 00:00:00"),
+		NewSession().SetUserID("1").SetUpdatedAt("2026-02-01 00:00:00"),
+		NewSession().SetUserID("2").SetUpdatedAt("2026-02-01 00:00:00"),
+	}
+
+	for _, session := range sessions {
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().SetOrderByColumns([]SortColumn{
+		{Column: COLUMN_USER_ID, Order: sb.ASC},
+		{Column: COLUMN_UPDATED_AT, Order: "DESC"},
+	}))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ids := lo.Map(list, func(session SessionInterface, _ int) string { return session.GetID() })
+	expected := []string{sessions[2].GetID(), sessions[1].GetID(), sessions[3].GetID(), sessions[0].GetID()}
+
+	if !slices.Equal(ids, expected) {
+		t.Fatal("sessions MUST be sorted on both columns, expected:", expected, "got:", ids)
+	}
+
+	for _, query := range []SessionQueryInterface{
+		SessionQuery().SetOrderBy("created_at; DROP TABLE session"),
+		SessionQuery().SetOrderBy(COLUMN_CREATED_AT).SetSortOrder("sideways"),
+		SessionQuery().SetOrderByColumns([]SortColumn{{Column: COLUMN_USER_ID, Order: "ASC NULLS FIRST"}}),
+	} {
+		_, err := store.SessionList(ctx, query)
+
+		var errInvalidSort *ErrInvalidSort
+
+		if !errors.As(err, &errInvalidSort) {
+			t.Fatal("invalid sort MUST return ErrInvalidSort, got:", err)
+		}
+	}
+}
+
+func TestStore_SessionList_Sorts(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionListSorts(t, store)
+
+	_, err = store.SessionList(context.Background(), SessionQuery().SetOrderBy("auth_method"))
+
+	var errInvalidSort *ErrInvalidSort
+
+	if !errors.As(err, &errInvalidSort) || errInvalidSort.Column != "auth_method" {
+		t.Fatal("unknown column MUST return ErrInvalidSort, got:", err)
+	}
+}
+
+// assertSessionStats checks the statistics of a store, aggregated in SQL
+// or in memory, which must agree
+func assertSessionStats(t *testing.T, st StoreInterface) {
+	ctx := context.Background()
+
+	store, ok := st.(interface {
+		StoreInterface
+		StatsStoreInterface
+	})
+
+	if !ok {
+		t.Fatal("store MUST implement StatsStoreInterface")
+	}
+
+	sessions := []SessionInterface{
+		NewSession().SetUserID("1").SetUserAgent("firefox").SetIPAddress("10.0.0.1").SetCreatedAt("2026-10-18 09:15:00"),
+		NewSession().SetUserID("1").SetUserAgent("chrome").SetIPAddress("10.0.0.1").SetCreatedAt("2026-10-18 09:45:00"),
+		NewSession().SetUserID("2").SetUserAgent("firefox").SetIPAddress("10.0.0.2").SetCreatedAt("2026-10-18 10:05:00"),
+		NewSession().SetUserAgent("firefox").SetIPAddress("10.0.0.3").SetCreatedAt("2026-10-19 08:00:00"),
+		NewSession().SetUserID("3").SetUserAgent("curl").SetCreatedAt("2026-10-19 08:30:00").SetExpiresAt("2020-01-01 00:00:00"),
+	}
+
+	for _, session := range sessions {
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	stats, err := store.SessionStats(ctx, StatsQuery{CreatedPer: STATS_PERIOD_HOUR, TopLimit: 1})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if stats.ActiveSessions != 4 || stats.ActiveUsers != 2 || stats.AuthenticatedSessions != 3 || stats.AnonymousSessions != 1 {
+		t.Fatal("active sessions MUST be counted, got:", stats)
+	}
+
+	expectedPerHour := []SessionStatsCount{
+		{Value: "2026-10-18 09:00:00", Count: 2},
+		{Value: "2026-10-18 10:00:00", Count: 1},
+		{Value: "2026-10-19 08:00:00", Count: 2},
+	}
+
+	if !slices.Equal(stats.CreatedPerPeriod, expectedPerHour) {
+		t.Fatal("sessions MUST be counted per hour, expected:", expectedPerHour, "got:", stats.CreatedPerPeriod)
+	}
+
+	if !slices.Equal(stats.TopUserAgents, []SessionStatsCount{{Value: "firefox", Count: 3}}) {
+		t.Fatal("top user agents MUST be counted, got:", stats.TopUserAgents)
+	}
+
+	if !slices.Equal(stats.TopIPAddresses, []SessionStatsCount{{Value: "10.0.0.1", Count: 2}}) {
+		t.Fatal("top IP addresses MUST be counted, got:", stats.TopIPAddresses)
+	}
+
+	stats, err = store.SessionStats(ctx, StatsQuery{
+		Query:      SessionQuery().SetUserID("1"),
+		CreatedPer: STATS_PERIOD_DAY,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if stats.ActiveSessions != 2 || !slices.Equal(stats.CreatedPerPeriod, []SessionStatsCount{{Value: "2026-10-18", Count: 2}}) {
+		t.Fatal("statistics MUST be filtered by the session query, got:", stats)
+	}
+
+	if stats.TopUserAgents != nil {
+		t.Fatal("top user agents MUST be skipped without TopLimit, got:", stats.TopUserAgents)
+	}
+
+	for _, query := range []StatsQuery{
+		{CreatedPer: "week"},
+		{TopLimit: -1},
+		{Query: SessionQuery().SetLimit(10)},
+	} {
+		if _, err := store.SessionStats(ctx, query); err == nil {
+			t.Fatal("invalid statistics query MUST fail:", query)
+		}
+	}
+}
+
+func TestStore_SQLStatsPeriod_Postgres(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	defer db.Close()
+
+	store, err := NewStore(NewStoreOptions{
+		DB:               db,
+		DbDriverName:     sb.DIALECT_POSTGRES,
+		SessionTableName: "session",
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if sqlStr := store.SQLCreateTable(); !strings.Contains(sqlStr, `"created_at" TIMESTAMPTZ NOT NULL`) {
+		t.Fatal("created_at MUST be TIMESTAMPTZ on Postgres, for AT TIME ZONE to convert it to UTC:", sqlStr)
+	}
+
+	for per, expected := range map[string]string{
+		STATS_PERIOD_HOUR: `to_char("created_at" AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00:00')`,
+		STATS_PERIOD_DAY:  `to_char("created_at" AT TIME ZONE 'UTC', 'YYYY-MM-DD')`,
+	} {
+		period, err := store.sqlStatsPeriod(per)
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		sqlStr, _, err := goqu.Dialect(sb.DIALECT_POSTGRES).From("session").Select(period).ToSQL()
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if !strings.Contains(sqlStr, expected) {
+			t.Fatal("period MUST be formatted in UTC on Postgres:", per, sqlStr)
+		}
+	}
+}
+
+func TestStore_SessionStats(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionStats(t, store)
+}
+
+// assertSessionPartial checks the sessions loaded with a subset of the
+// columns, and their updates
+func assertSessionPartial(t *testing.T, store StoreInterface) {
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1").SetValue(strings.Repeat("v", 1000))
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().SetColumns([]string{COLUMN_ID, COLUMN_SESSION_KEY, COLUMN_USER_ID, COLUMN_EXPIRES_AT}))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || !list[0].IsPartial() || list[0].IsLoaded(COLUMN_SESSION_VALUE) || !list[0].IsLoaded(COLUMN_USER_ID) {
+		t.Fatal("sessions listed with columns MUST be partial, got:", list)
+	}
+
+	if list[0].GetValue() != "" || list[0].GetUserID() != "1" {
+		t.Fatal("only the columns MUST be loaded, got:", list[0].Data())
+	}
+
+	partial := list[0]
+	expiresAt := carbon.Now(carbon.UTC).AddHours(5).ToDateTimeString(carbon.UTC)
+
+	if err := store.SessionUpdate(ctx, partial.SetExpiresAt(expiresAt)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByID(ctx, session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.IsPartial() || !strings.HasPrefix(found.GetExpiresAt(), expiresAt) || found.GetValue() != session.GetValue() {
+		t.Fatal("update of a partial session MUST only change its columns, got:", found.Data())
+	}
+
+	var errColumnNotLoaded *ErrColumnNotLoaded
+
+	err = store.SessionUpdate(ctx, partial.SetValue("lost"))
+
+	if !errors.As(err, &errColumnNotLoaded) || errColumnNotLoaded.Column != COLUMN_SESSION_VALUE {
+		t.Fatal("update of a column not loaded MUST return ErrColumnNotLoaded, got:", err)
+	}
+
+	list, err = store.SessionList(ctx, SessionQuery().SetColumns([]string{COLUMN_ID, COLUMN_USER_ID}))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.SessionUpdate(ctx, list[0].SetUserID("2"))
+
+	if !errors.As(err, &errColumnNotLoaded) || errColumnNotLoaded.Column != COLUMN_SESSION_KEY {
+		t.Fatal("update without the key loaded MUST return ErrColumnNotLoaded, got:", err)
+	}
+}
+
+func TestStore_SessionPartial(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionPartial(t, store)
+}
+
+// assertSessionBulk checks the bulk create, update and delete of a store
+func assertSessionBulk(t *testing.T, st StoreInterface) {
+	ctx := context.Background()
+
+	store, ok := st.(interface {
+		StoreInterface
+		BulkStoreInterface
+	})
+
+	if !ok {
+		t.Fatal("store MUST implement BulkStoreInterface")
+	}
+
+	sessions := []SessionInterface{}
+
+	for i := range 1200 {
+		sessions = append(sessions, NewSession().SetUserID(strconv.Itoa(i%3)).SetUserAgent("import"))
+	}
+
+	if err := store.SessionCreateMany(ctx, sessions); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	count, err := store.SessionCount(ctx, SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1200 {
+		t.Fatal("sessions MUST be created, expected 1200, got:", count)
+	}
+
+	updated, err := store.SessionUpdateMany(ctx, SessionQuery().SetUserID("1"), map[string]string{COLUMN_USER_AGENT: "migrated"})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated != 400 {
+		t.Fatal("sessions of the user MUST be updated, expected 400, got:", updated)
+	}
+
+	found, err := store.SessionFindByID(ctx, sessions[1].GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.GetUserAgent() != "migrated" || found.GetKey() != sessions[1].GetKey() {
+		t.Fatal("only the fields MUST be updated, got:", found.Data())
+	}
+
+	keys := lo.Map(sessions[:1000], func(session SessionInterface, _ int) string { return session.GetKey() })
+
+	deleted, err := store.SessionDeleteMany(ctx, SessionQuery().SetKeyIn(keys))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 1000 {
+		t.Fatal("sessions with the keys MUST be deleted, expected 1000, got:", deleted)
+	}
+
+	count, err = store.SessionCount(ctx, SessionQuery())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 200 {
+		t.Fatal("other sessions MUST be kept, expected 200, got:", count)
+	}
+
+	if _, err := store.SessionDeleteMany(ctx, SessionQuery().SetUserID("1").SetLimit(10)); err == nil {
+		t.Fatal("paginated bulk delete MUST fail")
+	}
+
+	if _, err := store.SessionUpdateMany(ctx, SessionQuery(), map[string]string{COLUMN_SESSION_KEY: "same"}); err == nil {
+		t.Fatal("bulk update of the key MUST fail")
+	}
+}
+
+func TestStore_SessionBulk(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionBulk(t, store)
+}
+
+func TestStore_SessionBulk_OversizedIDIn(t *testing.T) {
+	storeInterface, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store := storeInterface.(*store)
+	ctx := context.Background()
+
+	sessions := []SessionInterface{}
+
+	for range 10 {
+		sessions = append(sessions, NewSession().SetUserID("1"))
+	}
+
+	if err := store.SessionCreateMany(ctx, sessions); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// far more values than the 999 parameters of a SQLite statement
+	ids := lo.Times(40000, func(i int) string { return "missing_" + strconv.Itoa(i) })
+	ids = append(ids, lo.Map(sessions, func(session SessionInterface, _ int) string { return session.GetID() })...)
+
+	keys := lo.Times(1000, func(i int) string { return "missing_" + strconv.Itoa(i) })
+	keys = append(keys, lo.Map(sessions[:5], func(session SessionInterface, _ int) string { return session.GetKey() })...)
+
+	updated, err := store.SessionUpdateMany(ctx, SessionQuery().SetIDIn(ids).SetKeyIn(keys), map[string]string{COLUMN_USER_AGENT: "migrated"})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated != 5 {
+		t.Fatal("sessions matching both lists MUST be updated, expected 5, got:", updated)
+	}
+
+	deleted, err := store.SessionDeleteMany(ctx, SessionQuery().SetIDIn(ids))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if deleted != 10 {
+		t.Fatal("sessions with the ids MUST be deleted, expected 10, got:", deleted)
+	}
+}
+
+func TestStore_Set_Upsert(t *testing.T) {
+	storeInterface, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store := storeInterface.(*store)
+	ctx := context.Background()
+
+	// created by a concurrent Set, after this Set found no session
+	existing := NewSession().SetKey("upsert_key").SetValue("first")
+
+	if err := store.SessionCreate(ctx, existing); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.sessionUpsert(ctx, NewSession().SetKey("upsert_key").SetValue("second"), NewSessionOptions()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err := store.SessionList(ctx, SessionQuery().SetKey("upsert_key"))
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].GetID() != existing.GetID() || list[0].GetValue() != "second" {
+		t.Fatal("existing session MUST be updated, not duplicated, got:", len(list))
+	}
+
+	// expired and soft deleted sessions, not swept yet, are replaced
+	expired := NewSession().SetKey("expired_key").SetUserID("2").SetExpiresAt("2020-01-01 00:00:00")
+	softDeleted := NewSession().SetKey("soft_deleted_key").SetUserID("2").SetUserAgent("old agent")
+
+	for _, inactive := range []SessionInterface{expired, softDeleted} {
+		if err := store.SessionCreate(ctx, inactive); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.SessionSoftDelete(ctx, softDeleted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, inactive := range []SessionInterface{expired, softDeleted} {
+		if err := store.sessionUpsert(ctx, NewSession().SetKey(inactive.GetKey()).SetValue("revived").SetUserID("1"), NewSessionOptions()); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		list, err := store.SessionList(ctx, SessionQuery().SetKey(inactive.GetKey()))
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if len(list) != 1 || list[0].GetID() == inactive.GetID() || list[0].GetValue() != "revived" || list[0].GetUserID() != "1" || list[0].GetUserAgent() != "" {
+			t.Fatal("inactive session MUST be replaced by a new one, got:", list)
+		}
+
+		if found, _ := store.SessionFindByIDIncludingDeleted(ctx, inactive.GetID()); found != nil {
+			t.Fatal("inactive session MUST be deleted, found:", found.Data())
+		}
+	}
+
+	if err := store.Set(ctx, "expired_key", "set again", 3600, NewSessionOptions()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	options := NewSessionOptions()
+	options.SetUserID("1")
+
+	if err := store.Set(ctx, "new_key", "value", 3600, options); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	value, err := store.Get(ctx, "new_key", "", options)
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if value != "value" {
+		t.Fatal("new session MUST be created, got:", value)
+	}
+}
+
+func TestStore_Set_Upsert_BindingPolicy(t *testing.T) {
+	storeInterface, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	store := storeInterface.(*store)
+	ctx := context.Background()
+
+	// created by a concurrent Set, after this Set found no session
+	existing := NewSession().SetKey("bound_key").SetValue("first").SetIPAddress("10.0.0.1").SetUserAgent("agent")
+
+	if err := store.SessionCreate(ctx, existing); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	exact := NewSessionOptions()
+	exact.SetBindingPolicy(BINDING_POLICY_EXACT)
+	exact.SetIPAddress("10.0.0.2")
+	exact.SetUserAgent("agent")
+
+	err = store.sessionUpsert(ctx, NewSession().SetKey("bound_key").SetValue("second"), exact)
+
+	var mismatch *ErrBindingMismatch
+
+	if !errors.As(err, &mismatch) || mismatch.Field != COLUMN_IP_ADDRESS {
+		t.Fatal("expected ErrBindingMismatch on the IP address, found:", err)
+	}
+
+	networkPrefix := NewSessionOptions()
+	networkPrefix.SetBindingPolicy(BINDING_POLICY_NETWORK_PREFIX)
+	networkPrefix.SetIPAddress("10.0.0.2")
+	networkPrefix.SetUserAgent("agent")
+
+	if err := store.sessionUpsert(ctx, NewSession().SetKey("bound_key").SetValue("third"), networkPrefix); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByID(ctx, existing.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "third" {
+		t.Fatal("session matching the binding policy MUST be updated, found:", found)
+	}
+}
+
+func TestStore_SQLInsertIfKeyAbsent(t *testing.T) {
+	db, err := initDB(":memory:")
+
+	if err != nil {
+		t.Fatal("Database could not be created: ", err.Error())
+	}
+
+	for dialect, expected := range map[string]string{
+		sb.DIALECT_SQLITE:   "ON CONFLICT DO NOTHING",
+		sb.DIALECT_POSTGRES: "ON CONFLICT DO NOTHING",
+		sb.DIALECT_MYSQL:    "ON DUPLICATE KEY UPDATE `id` = `id`",
+		sb.DIALECT_MSSQL:    `WHEN NOT MATCHED THEN INSERT`,
+	} {
+		store, err := NewStore(NewStoreOptions{
+			DB:               db,
+			DbDriverName:     dialect,
+			SessionTableName: "session",
+		})
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		sqlStr, sqlParams, err := store.sqlInsertIfKeyAbsent(NewSession().SetKey("key"))
+
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if !strings.Contains(sqlStr, expected) || strings.Contains(sqlStr, "IGNORE") {
+			t.Fatal("insert MUST skip taken keys on", dialect, "got:", sqlStr)
+		}
+
+		if dialect == sb.DIALECT_MSSQL {
+			last := "@p" + strconv.Itoa(len(sqlParams))
+
+			if strings.Contains(sqlStr, "?") || !strings.Contains(sqlStr, "SELECT @p1 AS") || !strings.Contains(sqlStr, last+");") {
+				t.Fatal("placeholders MUST be numbered @p1 to", last, "on", dialect, "got:", sqlStr, sqlParams)
+			}
+
+			continue
+		}
+
+		if strings.Count(sqlStr, "?")+strings.Count(sqlStr, "$") != len(sqlParams) {
+			t.Fatal("placeholders MUST match the parameters on", dialect, "got:", sqlStr, sqlParams)
+		}
+	}
+}
+
+// assertSessionRestore checks the restore of soft deleted sessions of a store
+func assertSessionRestore(t *testing.T, st StoreInterface) {
+	ctx := context.Background()
+
+	store, ok := st.(interface {
+		StoreInterface
+		RestoreStoreInterface
+	})
+
+	if !ok {
+		t.Fatal("store MUST implement RestoreStoreInterface")
+	}
+
+	session := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionRestore(ctx, session.GetID(), SessionRestoreOptions{RestoredBy: "support"}); err == nil {
+		t.Fatal("a session not soft deleted MUST NOT be restored")
+	}
+
+	if err := store.SessionSoftDeleteByID(ctx, session.GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByID(ctx, session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("soft deleted session MUST NOT be found")
+	}
+
+	found, err = store.SessionFindByIDIncludingDeleted(ctx, session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || !found.IsSoftDeleted() {
+		t.Fatal("soft deleted session MUST be found including deleted")
+	}
+
+	if err := store.SessionRestore(ctx, session.GetID(), SessionRestoreOptions{}); err == nil {
+		t.Fatal("restored by MUST be required")
+	}
+
+	if err := store.SessionRestore(ctx, "missing", SessionRestoreOptions{RestoredBy: "support"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("expected ErrSessionNotFound, got:", err)
+	}
+
+	err = store.SessionRestore(ctx, session.GetID(), SessionRestoreOptions{
+		RestoredBy: "support",
+		Reason:     "ticket 42",
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.SessionFindByID(ctx, session.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("restored session MUST be found")
+	}
+
+	if found.GetRestoredBy() != "support" || found.GetRestoreReason() != "ticket 42" || found.GetRestoredAt() == "" {
+		t.Fatal("restore MUST be recorded, got:", found.GetRestoredBy(), found.GetRestoreReason(), found.GetRestoredAt())
+	}
+
+	// an expired session requires a new expiry
+	expired := NewSession().SetUserID("1").SetExpiresAt(carbon.Now(carbon.UTC).SubHour().ToDateTimeString(carbon.UTC))
+
+	if err := store.SessionCreate(ctx, expired); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionSoftDelete(ctx, expired); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionRestore(ctx, expired.GetID(), SessionRestoreOptions{RestoredBy: "support"}); err == nil {
+		t.Fatal("an expired session MUST NOT be restored without a new expiry")
+	}
+
+	expiresAt := carbon.Now(carbon.UTC).AddHour().ToDateTimeString(carbon.UTC)
+
+	if err := store.SessionRestore(ctx, expired.GetID(), SessionRestoreOptions{RestoredBy: "support", ExpiresAt: expiresAt}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.SessionFindByID(ctx, expired.GetID())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || datetimeNormalize(found.GetExpiresAt()) != expiresAt {
+		t.Fatal("restored session MUST expire at the new expiry")
+	}
+}
+
+func TestStore_SessionRestore(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("Store could not be created: ", err.Error())
+	}
+
+	assertSessionRestore(t, store)
+}
+
+func TestStore_SessionRestore_Concurrent(t *testing.T) {
+	// a file database, so that several connections restore at once
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "restore.db")+"?parseTime=true&_busy_timeout=5000&_journal_mode=WAL")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewStore(NewStoreOptions{
+		DB:                 db,
+		SessionTableName:   "session",
+		AutomigrateEnabled: true,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionSoftDeleteByID(ctx, session.GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	restored := int64(0)
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			if err := store.SessionRestore(ctx, session.GetID(), SessionRestoreOptions{RestoredBy: "support"}); err == nil {
+				atomic.AddInt64(&restored, 1)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if restored != 1 {
+		t.Fatal("concurrent restores MUST restore the session once, restored:", restored)
+	}
+}
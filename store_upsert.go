@@ -0,0 +1,335 @@
+package sessionstore
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// sessionUpsert creates a session, or if a session with its key exists
+// (i.e. created by a concurrent Set), sets the value and expiry of that
+// session instead, in a transaction. The insert relies on the unique
+// index on the session key, so two concurrent calls never create two
+// sessions with the same key.
+//
+// An expired or soft deleted session with the key, not swept yet, is
+// deleted and the session is created in its place. An active one is only
+// written if it matches the user id, IP address and user agent of the
+// options, as FindByKey requires, otherwise ErrSessionKeyExists is returned.
+// With a binding policy, the IP address and user agent are checked by the
+// policy instead, and a mismatch returns an ErrBindingMismatch.
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//   - options - the session options
+//
+// Returns:
+//   - error - ErrSessionKeyExists if the key is taken, ErrBindingMismatch if the binding policy rejects the session, nil if successful, otherwise an error
+func (st *store) sessionUpsert(ctx context.Context, session SessionInterface, options SessionOptionsInterface) error {
+	if err := st.sessionCreatePrepare(session); err != nil {
+		return err
+	}
+
+	insertSQL, insertParams, errSql := st.sqlInsertIfKeyAbsent(session)
+
+	if errSql != nil {
+		return errSql
+	}
+
+	st.logSql("upsert", insertSQL, insertParams...)
+
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	wheres := []goqu.Expression{
+		goqu.C(COLUMN_SESSION_KEY).Eq(session.GetKey()),
+		goqu.C(COLUMN_EXPIRES_AT).Gte(now),
+		goqu.C(COLUMN_SOFT_DELETED_AT).Gt(now),
+	}
+
+	if options.HasUserID() {
+		wheres = append(wheres, goqu.C(COLUMN_USER_ID).Eq(options.GetUserID()))
+	}
+
+	if options.HasIPAddress() && !options.HasBindingPolicy() {
+		wheres = append(wheres, goqu.C(COLUMN_IP_ADDRESS).Eq(options.GetIPAddress()))
+	}
+
+	if options.HasUserAgent() && !options.HasBindingPolicy() {
+		wheres = append(wheres, goqu.C(COLUMN_USER_AGENT).Eq(options.GetUserAgent()))
+	}
+
+	wheres = st.tenantScope(wheres...)
+
+	evictedIDs := []string{}
+
+	err := st.runInTransactionIf(ctx, true, func(qctx database.QueryableContext) error {
+		insert := func() (int64, error) {
+			result, err := database.Execute(qctx, insertSQL, insertParams...)
+
+			if err != nil {
+				return 0, err
+			}
+
+			return result.RowsAffected()
+		}
+
+		inserted, err := insert()
+
+		if err != nil {
+			return err
+		}
+
+		if inserted < 1 {
+			deleted, err := st.sessionUpsertInactiveDelete(qctx, session.GetKey())
+
+			if err != nil {
+				return err
+			}
+
+			if deleted {
+				if inserted, err = insert(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if inserted > 0 {
+			// after the insert, so a session is only evicted for a new one
+			if evictedIDs, err = st.sessionLimitEnforce(qctx, session.GetUserID(), session.GetID()); err != nil {
+				return err
+			}
+
+			return st.changesPublish(qctx, SessionChange{
+				Operation: CHANGE_OPERATION_CREATE,
+				SessionID: session.GetID(),
+				UserID:    session.GetUserID(),
+			})
+		}
+
+		return st.sessionUpsertExisting(qctx, session, wheres, options)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	st.emitRevokedEvents(ctx, session.GetUserID(), evictedIDs)
+
+	return nil
+}
+
+// sessionUpsertInactiveDelete deletes the expired or soft deleted session
+// with the key, which the insert of sessionUpsert found, so that the
+// session can be created in its place
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - sessionKey - the session key
+//
+// Returns:
+//   - bool - true if an inactive session was deleted
+//   - error - nil if successful, otherwise an error
+func (st *store) sessionUpsertInactiveDelete(ctx database.QueryableContext, sessionKey string) (bool, error) {
+	now := carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(st.dbDriverName).
+		From(st.sessionTableName).
+		Prepared(true).
+		Select(COLUMN_ID, COLUMN_USER_ID).
+		Where(st.tenantScope(
+			goqu.C(COLUMN_SESSION_KEY).Eq(sessionKey),
+			goqu.Or(
+				goqu.C(COLUMN_EXPIRES_AT).Lt(now),
+				goqu.C(COLUMN_SOFT_DELETED_AT).Lte(now),
+			),
+		)...).
+		ToSQL()
+
+	if errSql != nil {
+		return false, errSql
+	}
+
+	st.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(rows) < 1 {
+		return false, nil
+	}
+
+	sqlStr, sqlParams, errSql = goqu.Dialect(st.dbDriverName).
+		Delete(st.sessionTableName).
+		Prepared(true).
+		Where(goqu.C(COLUMN_ID).Eq(rows[0][COLUMN_ID])).
+		ToSQL()
+
+	if errSql != nil {
+		return false, errSql
+	}
+
+	st.logSql("delete", sqlStr, sqlParams...)
+
+	if _, err := database.Execute(ctx, sqlStr, sqlParams...); err != nil {
+		return false, err
+	}
+
+	if st.writeBehind != nil {
+		st.writeBehind.remove(rows[0][COLUMN_ID])
+	}
+
+	return true, st.changesPublish(ctx, SessionChange{
+		Operation: CHANGE_OPERATION_DELETE,
+		SessionID: rows[0][COLUMN_ID],
+		UserID:    rows[0][COLUMN_USER_ID],
+	})
+}
+
+// sessionUpsertExisting sets the value and expiry of the session with
+// the key, which the insert of sessionUpsert found
+//
+// Parameters:
+//   - ctx - the queryable context (transaction)
+//   - session - the session to create
+//   - wheres - the conditions the existing session must meet
+//   - options - the session options, whose binding policy the existing session must meet
+//
+// Returns:
+//   - error - ErrSessionKeyExists if no session meets them, ErrBindingMismatch if the binding policy rejects it, nil if successful, otherwise an error
+func (st *store) sessionUpsertExisting(ctx database.QueryableContext, session SessionInterface, wheres []goqu.Expression, options SessionOptionsInterface) error {
+	// selected rather than counted from the update, as MySQL does not
+	// count the rows left unchanged
+	sqlStr, sqlParams, errSql := goqu.Dialect(st.dbDriverName).
+		From(st.sessionTableName).
+		Prepared(true).
+		Select(COLUMN_ID, COLUMN_USER_ID, COLUMN_IP_ADDRESS, COLUMN_USER_AGENT).
+		Where(wheres...).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	st.logSql("select", sqlStr, sqlParams...)
+
+	rows, err := database.SelectToMapString(ctx, sqlStr, sqlParams...)
+
+	if err != nil {
+		return err
+	}
+
+	if len(rows) < 1 {
+		return ErrSessionKeyExists
+	}
+
+	if options.HasBindingPolicy() {
+		if mismatch := sessionBindingCheck(NewSessionFromExistingData(rows[0]), options); mismatch != nil {
+			return mismatch
+		}
+	}
+
+	sqlStr, sqlParams, errSql = goqu.Dialect(st.dbDriverName).
+		Update(st.sessionTableName).
+		Prepared(true).
+		Set(st.sqlRecord(map[string]string{
+			COLUMN_SESSION_VALUE: session.GetValue(),
+			COLUMN_EXPIRES_AT:    session.GetExpiresAt(),
+			COLUMN_UPDATED_AT:    session.GetUpdatedAt(),
+		})).
+		Where(goqu.C(COLUMN_ID).Eq(rows[0][COLUMN_ID])).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	st.logSql("update", sqlStr, sqlParams...)
+
+	if _, err := database.Execute(ctx, sqlStr, sqlParams...); err != nil {
+		return err
+	}
+
+	if st.writeBehind != nil {
+		st.writeBehind.remove(rows[0][COLUMN_ID]) // superseded by this update
+	}
+
+	session.SetID(rows[0][COLUMN_ID]).SetUserID(rows[0][COLUMN_USER_ID])
+
+	return st.changesPublish(ctx, SessionChange{
+		Operation: CHANGE_OPERATION_UPDATE,
+		SessionID: rows[0][COLUMN_ID],
+		UserID:    rows[0][COLUMN_USER_ID],
+	})
+}
+
+// sqlInsertIfKeyAbsent returns the SQL inserting a session unless a
+// session with its key exists, which affects no rows then. It uses ON
+// CONFLICT on Postgres and SQLite, ON DUPLICATE KEY on MySQL and MERGE
+// on SQL Server.
+//
+// Parameters:
+//   - session - the session to insert
+//
+// Returns:
+//   - string - the SQL string
+//   - []any - the SQL parameters
+//   - error - nil if successful, otherwise an error
+func (st *store) sqlInsertIfKeyAbsent(session SessionInterface) (string, []any, error) {
+	record := st.sqlRecord(session.Data())
+
+	switch st.dbDriverName {
+	case sb.DIALECT_MYSQL:
+		// not with goqu's conflict support, which adds IGNORE, ignoring other errors too
+		sqlStr, sqlParams, errSql := goqu.Dialect(st.dbDriverName).
+			Insert(st.sessionTableName).
+			Prepared(true).
+			Rows(record).
+			ToSQL()
+
+		if errSql != nil {
+			return "", nil, errSql
+		}
+
+		return sqlStr + " ON DUPLICATE KEY UPDATE `" + COLUMN_ID + "` = `" + COLUMN_ID + "`", sqlParams, nil
+	case sb.DIALECT_MSSQL:
+		columns := lo.Keys(record)
+		slices.Sort(columns)
+
+		sqlParams := []any{session.GetKey()}
+
+		for _, column := range columns {
+			sqlParams = append(sqlParams, record[column])
+		}
+
+		// SQL Server placeholders are numbered, @p1 being the session key
+		quoted := lo.Map(columns, func(column string, _ int) string { return `"` + column + `"` })
+		placeholders := lo.Map(columns, func(_ string, i int) string { return "@p" + strconv.Itoa(i+2) })
+
+		sqlStr := `MERGE INTO "` + st.sessionTableName + `" WITH (HOLDLOCK) AS "target"` +
+			` USING (SELECT @p1 AS "` + COLUMN_SESSION_KEY + `") AS "source"` +
+			` ON "target"."` + COLUMN_SESSION_KEY + `" = "source"."` + COLUMN_SESSION_KEY + `"` +
+			` WHEN NOT MATCHED THEN INSERT (` + strings.Join(quoted, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `);`
+
+		return sqlStr, sqlParams, nil
+	default:
+		return goqu.Dialect(st.dbDriverName).
+			Insert(st.sessionTableName).
+			Prepared(true).
+			Rows(record).
+			OnConflict(goqu.DoNothing()).
+			ToSQL()
+	}
+}
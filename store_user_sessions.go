@@ -0,0 +1,42 @@
+package sessionstore
+
+import (
+	"context"
+)
+
+// UserSessions returns the active sessions of a user, most recently
+// seen first, i.e. for a "Where you're logged in" page.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *store) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions.
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *store) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	sessionID, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+
+	if err != nil {
+		return err
+	}
+
+	store.emitRevokedEvents(ctx, userID, []string{sessionID})
+
+	return nil
+}
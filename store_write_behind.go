@@ -0,0 +1,166 @@
+package sessionstore
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/dracory/database"
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+)
+
+// writeBehindBatchSize is the maximum number of sessions per batched UPDATE
+const writeBehindBatchSize = 500
+
+// SessionFlush writes the buffered expiry extensions to the database,
+// in batched updates. Call it on shutdown, when write-behind is enabled.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionFlush(ctx context.Context) error {
+	if store.writeBehind == nil {
+		return nil
+	}
+
+	pending := store.writeBehind.take()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sessionIDs := lo.Keys(pending)
+
+	for i, chunk := range lo.Chunk(sessionIDs, writeBehindBatchSize) {
+		if err := store.writeBehindFlushBatch(ctx, chunk, pending); err != nil {
+			// keep the extensions not written yet for the next flush
+			store.writeBehind.restore(lo.PickByKeys(pending, sessionIDs[i*writeBehindBatchSize:]))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SessionFlushGoroutine flushes the buffered expiry extensions every
+// WriteBehindInterval, and a last time when the context is done.
+//
+// Parameters:
+//   - ctx - the context, cancel it on shutdown
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) SessionFlushGoroutine(ctx context.Context) error {
+	if store.writeBehind == nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(store.writeBehindInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return store.SessionFlush(context.Background())
+		case <-ticker.C:
+			if err := store.SessionFlush(ctx); err != nil {
+				log.Println("Session Store. SessionFlushGoroutine. Error: ", err)
+			}
+		}
+	}
+}
+
+// sessionExtendBuffered buffers the extension of a session instead of
+// writing it, if possible. Sessions with other changes are written
+// synchronously, as are sessions about to expire, so that they are
+// neither expired nor deleted before the flush.
+//
+// Parameters:
+//   - session - the session, with its new expiry set
+//   - previousExpiresAt - the expiry of the session before the extension
+//
+// Returns:
+//   - bool - true if the extension has been buffered
+func (store *store) sessionExtendBuffered(session SessionInterface, previousExpiresAt string) bool {
+	if store.writeBehind == nil {
+		return false
+	}
+
+	for column := range session.DataChanged() {
+		if column != COLUMN_EXPIRES_AT && column != COLUMN_UPDATED_AT {
+			return false
+		}
+	}
+
+	safeUntil := time.Now().UTC().Add(2 * store.writeBehindInterval).Format(time.DateTime)
+
+	if previousExpiresAt < safeUntil {
+		return false
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	store.writeBehind.add(session.GetID(), writeBehindEntry{
+		expiresAt: session.GetExpiresAt(),
+		updatedAt: session.GetUpdatedAt(),
+	})
+
+	session.MarkAsNotDirty()
+
+	return true
+}
+
+// writeBehindFlushBatch writes the extensions of the given sessions in a
+// single UPDATE. An extension is skipped if the session has been updated
+// synchronously after it was buffered.
+//
+// Extensions are not published as changes, caches never keep a session
+// past the earlier expiry anyway.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionIDs - the ids of the sessions
+//   - pending - the pending extensions
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *store) writeBehindFlushBatch(ctx context.Context, sessionIDs []string, pending map[string]writeBehindEntry) error {
+	expiresAtCase := goqu.Case()
+	updatedAtCase := goqu.Case()
+
+	for _, sessionID := range sessionIDs {
+		entry := pending[sessionID]
+
+		condition := goqu.And(
+			goqu.C(COLUMN_ID).Eq(sessionID),
+			goqu.C(COLUMN_UPDATED_AT).Lte(entry.updatedAt),
+		)
+
+		expiresAtCase = expiresAtCase.When(condition, entry.expiresAt)
+		updatedAtCase = updatedAtCase.When(condition, entry.updatedAt)
+	}
+
+	sqlStr, sqlParams, errSql := goqu.Dialect(store.dbDriverName).
+		Update(store.sessionTableName).
+		Prepared(true).
+		Set(goqu.Record{
+			COLUMN_EXPIRES_AT: expiresAtCase.Else(goqu.C(COLUMN_EXPIRES_AT)),
+			COLUMN_UPDATED_AT: updatedAtCase.Else(goqu.C(COLUMN_UPDATED_AT)),
+		}).
+		Where(goqu.C(COLUMN_ID).In(sessionIDs)).
+		ToSQL()
+
+	if errSql != nil {
+		return errSql
+	}
+
+	store.logSql("update", sqlStr, sqlParams...)
+
+	_, err := database.Execute(store.toQueryableContext(ctx), sqlStr, sqlParams...)
+
+	return err
+}
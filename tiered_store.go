@@ -0,0 +1,922 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/dromara/carbon/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// == INTERFACE ===============================================================
+
+var _ StoreInterface = (*tieredStore)(nil)             // verify it extends the store interface
+var _ FlusherInterface = (*tieredStore)(nil)           // verify it extends the flusher interface
+var _ BulkStoreInterface = (*tieredStore)(nil)         // verify it extends the bulk store interface
+var _ PagingStoreInterface = (*tieredStore)(nil)       // verify it extends the paging store interface
+var _ RestoreStoreInterface = (*tieredStore)(nil)      // verify it extends the restore store interface
+var _ UserStoreInterface = (*tieredStore)(nil)         // verify it extends the user store interface
+var _ PromoteStoreInterface = (*tieredStore)(nil)      // verify it extends the promote store interface
+var _ StatsStoreInterface = (*tieredStore)(nil)        // verify it extends the stats store interface
+var _ UserSessionsStoreInterface = (*tieredStore)(nil) // verify it extends the user sessions store interface
+
+// == TYPE ====================================================================
+
+// tieredStore combines a fast (hot) store, i.e. Redis, with a durable
+// store, i.e. SQL. Lookups by key and id are served by the hot tier, which
+// is warmed lazily from the durable tier on a miss. Queries (list, count,
+// user sessions) are always served by the durable tier.
+//
+// Creates, updates and extensions are written to both tiers, in async mode
+// to the durable tier in the background. Deletes, soft deletes, revocations
+// and promotions are always written to both tiers synchronously, after the
+// queued writes, so that a revoked session is never served by either tier.
+type tieredStore struct {
+	hot             StoreInterface
+	durable         StoreInterface
+	writeMode       string
+	consistencyMode string
+	logger          *slog.Logger
+
+	queue       chan tieredWrite
+	queueMu     sync.RWMutex  // guards the sends on the queue against its closing
+	queueClosed bool          // set by Close
+	writerDone  chan struct{} // closed when the async writer exits
+
+	userSessionHandleSecret []byte // keys the user session handles
+}
+
+// tieredWrite is a durable write queued in async mode, or a barrier,
+// closed by the writer once the writes queued before it are done
+type tieredWrite struct {
+	sessionID string
+	write     func(ctx context.Context) error
+	barrier   chan struct{}
+}
+
+// NewTieredStoreOptions define the options for creating a new tiered session store
+type NewTieredStoreOptions struct {
+	// Hot is the fast store, i.e. a Redis store
+	Hot StoreInterface
+
+	// Durable is the store of record, i.e. a SQL store
+	Durable StoreInterface
+
+	// WriteMode is TIER_WRITE_MODE_SYNC (default) or TIER_WRITE_MODE_ASYNC.
+	// In async mode errors of the durable tier are logged, not returned
+	WriteMode string
+
+	// ConsistencyMode decides which tier wins when an async durable write fails,
+	// TIER_CONSISTENCY_DURABLE_WINS (default) drops the session from the hot
+	// tier, TIER_CONSISTENCY_HOT_WINS keeps serving it from the hot tier
+	ConsistencyMode string
+
+	// AsyncQueueSize is the number of durable writes queued in async mode,
+	// default 1000. When the queue is full, the writes wait for room in it, so
+	// that they stay in order
+	AsyncQueueSize int
+
+	Logger *slog.Logger
+
+	// UserSessionHandleSecret keys the HMAC of the handles returned by
+	// UserSessions, required by UserSessions and UserSessionRevoke, which
+	// return ErrUserSessionHandleSecretRequired without it. All the
+	// instances sharing the sessions must set the same secret, kept across
+	// restarts, or the handles stop matching
+	UserSessionHandleSecret string
+}
+
+// == CONSTRUCTOR =============================================================
+
+// NewTieredStore creates a new tiered session store
+func NewTieredStore(opts NewTieredStoreOptions) (*tieredStore, error) {
+	store := &tieredStore{
+		hot:             opts.Hot,
+		durable:         opts.Durable,
+		writeMode:       opts.WriteMode,
+		consistencyMode: opts.ConsistencyMode,
+		logger:          opts.Logger,
+
+		userSessionHandleSecret: []byte(opts.UserSessionHandleSecret),
+	}
+
+	if store.hot == nil {
+		return nil, errors.New("tiered session store: Hot is required")
+	}
+
+	if store.durable == nil {
+		return nil, errors.New("tiered session store: Durable is required")
+	}
+
+	if store.writeMode == "" {
+		store.writeMode = TIER_WRITE_MODE_SYNC
+	}
+
+	if !lo.Contains([]string{TIER_WRITE_MODE_SYNC, TIER_WRITE_MODE_ASYNC}, store.writeMode) {
+		return nil, errors.New("tiered session store: WriteMode " + store.writeMode + " is not supported")
+	}
+
+	if store.consistencyMode == "" {
+		store.consistencyMode = TIER_CONSISTENCY_DURABLE_WINS
+	}
+
+	if !lo.Contains([]string{TIER_CONSISTENCY_DURABLE_WINS, TIER_CONSISTENCY_HOT_WINS}, store.consistencyMode) {
+		return nil, errors.New("tiered session store: ConsistencyMode " + store.consistencyMode + " is not supported")
+	}
+
+	if opts.AsyncQueueSize <= 0 {
+		opts.AsyncQueueSize = 1000
+	}
+
+	if store.logger == nil {
+		store.logger = slog.Default()
+	}
+
+	if store.writeMode == TIER_WRITE_MODE_ASYNC {
+		store.queue = make(chan tieredWrite, opts.AsyncQueueSize)
+		store.writerDone = make(chan struct{})
+		go store.asyncWriter()
+	}
+
+	return store, nil
+}
+
+// PUBLIC METHODS ============================================================
+
+// AutoMigrate migrates both tiers
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) AutoMigrate(ctx context.Context) error {
+	if err := store.durable.AutoMigrate(ctx); err != nil {
+		return err
+	}
+
+	return store.hot.AutoMigrate(ctx)
+}
+
+// EnableDebug enables the debug mode of both tiers
+//
+// Parameters:
+//   - debug - true to enable, false to disable
+func (store *tieredStore) EnableDebug(debug bool) {
+	store.hot.EnableDebug(debug)
+	store.durable.EnableDebug(debug)
+}
+
+// SessionEventHandle drops the sessions revoked by the durable store from
+// the hot tier, i.e. the sessions evicted by its MaxSessionsPerUser. Pass
+// it as the EventHandler of the durable store.
+//
+// Parameters:
+//   - ctx - the context
+//   - event - the session event
+func (store *tieredStore) SessionEventHandle(ctx context.Context, event SessionEvent) {
+	var err error
+
+	switch {
+	case event.SessionID != "":
+		err = store.hot.SessionDeleteByID(ctx, event.SessionID)
+	case event.UserID != "":
+		_, err = storeDeleteByUserID(ctx, store.hot, event.UserID, event.ExceptSessionID)
+	}
+
+	if err != nil {
+		store.logger.Error("tiered session store: hot tier revoke failed", slog.String("error", err.Error()))
+	}
+}
+
+// SessionExpiryGoroutine runs the expiry goroutines of both tiers,
+// and returns as soon as one of them returns
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionExpiryGoroutine() error {
+	errs := make(chan error, 2)
+
+	go func() { errs <- store.hot.SessionExpiryGoroutine() }()
+	go func() { errs <- store.durable.SessionExpiryGoroutine() }()
+
+	return <-errs
+}
+
+// SessionCount returns the count of sessions matching the query, from the durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options
+//
+// Returns:
+//   - int64 - the count of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionCount(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	return store.durable.SessionCount(ctx, query)
+}
+
+// SessionCreate creates a new session in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionCreate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("sessionstore > session create. session cannot be nil")
+	}
+
+	return store.write(ctx, session, func(ctx context.Context, session SessionInterface) error {
+		return store.durable.SessionCreate(ctx, session)
+	})
+}
+
+// SessionCreateMany creates sessions in the durable tier, in a single
+// write if it supports it, then in the hot tier. Unlike SessionCreate,
+// the durable write is synchronous in async mode too.
+//
+// Parameters:
+//   - ctx - the context
+//   - sessions - the sessions to create
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionCreateMany(ctx context.Context, sessions []SessionInterface) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := storeCreateMany(ctx, store.durable, sessions); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		store.hotPut(ctx, session)
+	}
+
+	return nil
+}
+
+// SessionDelete deletes a session from both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	return store.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionDeleteByID deletes a session by id from both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionDeleteByID(ctx context.Context, sessionID string) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := store.durable.SessionDeleteByID(ctx, sessionID); err != nil {
+		return err
+	}
+
+	return store.hot.SessionDeleteByID(ctx, sessionID)
+}
+
+// SessionDeleteByUserID deletes all the sessions of a user from both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to delete all
+//
+// Returns:
+//   - int64 - the number of deleted sessions, in the durable tier
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if err := store.drain(ctx); err != nil {
+		return 0, err
+	}
+
+	count, err := storeDeleteByUserID(ctx, store.durable, userID, exceptSessionID)
+
+	if err != nil {
+		return count, err
+	}
+
+	_, err = storeDeleteByUserID(ctx, store.hot, userID, exceptSessionID)
+
+	return count, err
+}
+
+// SessionDeleteMany deletes the sessions matching a query from both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//
+// Returns:
+//   - int64 - the number of sessions deleted from the durable tier
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionDeleteMany(ctx context.Context, query SessionQueryInterface) (int64, error) {
+	if err := store.drain(ctx); err != nil {
+		return 0, err
+	}
+
+	count, err := storeDeleteMany(ctx, store.durable, query)
+
+	if err != nil {
+		return count, err
+	}
+
+	_, err = storeDeleteMany(ctx, store.hot, query)
+
+	return count, err
+}
+
+// SessionExtend extends a session's expiry time by the given seconds, in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to extend
+//   - seconds - the number of seconds to extend the session by
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionExtend(ctx context.Context, session SessionInterface, seconds int64) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	if store.writeMode == TIER_WRITE_MODE_SYNC {
+		if err := store.durable.SessionExtend(ctx, session, seconds); err != nil {
+			return err
+		}
+
+		store.hotPut(ctx, session)
+
+		return nil
+	}
+
+	session.SetExpiresAt(carbon.Now(carbon.UTC).AddSeconds(cast.ToInt(seconds)).ToDateTimeString(carbon.UTC))
+
+	return store.SessionUpdate(ctx, session)
+}
+
+// SessionFindByID finds a session by id, from the hot tier if possible
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionFindByID(ctx context.Context, sessionID string) (SessionInterface, error) {
+	return store.readThrough(ctx, func(st StoreInterface) (SessionInterface, error) {
+		return st.SessionFindByID(ctx, sessionID)
+	})
+}
+
+// SessionFindByKey finds a session by key, from the hot tier if possible
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionKey - the session key
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionFindByKey(ctx context.Context, sessionKey string) (SessionInterface, error) {
+	return store.readThrough(ctx, func(st StoreInterface) (SessionInterface, error) {
+		return st.SessionFindByKey(ctx, sessionKey)
+	})
+}
+
+// Close waits for the queued durable writes, and stops the async writer.
+// The later writes are written to the durable tier synchronously.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) Close(ctx context.Context) error {
+	if store.queue == nil {
+		return nil
+	}
+
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	store.queueMu.Lock()
+
+	if !store.queueClosed {
+		store.queueClosed = true
+		close(store.queue)
+	}
+
+	store.queueMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-store.writerDone:
+		return nil
+	}
+}
+
+// SessionFlush waits for the queued durable writes, and flushes both tiers.
+// Call it on shutdown in async mode.
+//
+// Parameters:
+//   - ctx - the context
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionFlush(ctx context.Context) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := storeFlush(ctx, store.hot); err != nil {
+		return err
+	}
+
+	return storeFlush(ctx, store.durable)
+}
+
+// SessionList returns a list of sessions matching the query, from the durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options
+//
+// Returns:
+//   - []SessionInterface - list of matching sessions
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionList(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, error) {
+	return store.durable.SessionList(ctx, query)
+}
+
+// SessionListPage returns a page of sessions matching the query, and the
+// cursor of the next page, from the durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options, the limit is the page size
+//
+// Returns:
+//   - []SessionInterface - the sessions of the page
+//   - string - the cursor of the next page, empty on the last page
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionListPage(ctx context.Context, query SessionQueryInterface) ([]SessionInterface, string, error) {
+	return storeListPage(ctx, store.durable, query)
+}
+
+// SessionIterate calls fn for each session matching the query, from the
+// durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query options, the limit is the page size
+//   - fn - the function to call, returning ErrStopIteration stops the iteration
+//
+// Returns:
+//   - error - nil if successful, otherwise the error of the store or of fn
+func (store *tieredStore) SessionIterate(ctx context.Context, query SessionQueryInterface, fn func(session SessionInterface) error) error {
+	return storeIterate(ctx, store.durable, query, fn)
+}
+
+// SessionStats returns statistics of the sessions, from the durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the statistics query
+//
+// Returns:
+//   - SessionStats - the statistics
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionStats(ctx context.Context, query StatsQuery) (SessionStats, error) {
+	return storeStats(ctx, store.durable, query)
+}
+
+// SessionPromote upgrades a guest session to an authenticated one, in
+// the durable tier, then replaces it in the hot tier
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the guest session
+//   - userID - the id of the user logging in
+//   - mergeStrategy - one of the MERGE_STRATEGY_* constants
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionPromote(ctx context.Context, session SessionInterface, userID string, mergeStrategy string) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := storePromote(ctx, store.durable, session, userID, mergeStrategy); err != nil {
+		return err
+	}
+
+	store.hotPut(ctx, session)
+
+	return nil
+}
+
+// SessionSoftDelete soft deletes a session in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to soft delete
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionSoftDelete(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("session is nil")
+	}
+
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := store.durable.SessionSoftDelete(ctx, session); err != nil {
+		return err
+	}
+
+	return store.hot.SessionDeleteByID(ctx, session.GetID())
+}
+
+// SessionSoftDeleteByID soft deletes a session by id in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionSoftDeleteByID(ctx context.Context, sessionID string) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := store.durable.SessionSoftDeleteByID(ctx, sessionID); err != nil {
+		return err
+	}
+
+	return store.hot.SessionDeleteByID(ctx, sessionID)
+}
+
+// SessionSoftDeleteByUserID soft deletes all the sessions of a user in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - exceptSessionID - a session to keep (i.e. the current one), empty to soft delete all
+//
+// Returns:
+//   - int64 - the number of soft deleted sessions, in the durable tier
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionSoftDeleteByUserID(ctx context.Context, userID string, exceptSessionID string) (int64, error) {
+	if err := store.drain(ctx); err != nil {
+		return 0, err
+	}
+
+	count, err := storeSoftDeleteByUserID(ctx, store.durable, userID, exceptSessionID)
+
+	if err != nil {
+		return count, err
+	}
+
+	_, err = storeDeleteByUserID(ctx, store.hot, userID, exceptSessionID)
+
+	return count, err
+}
+
+// SessionUpdate updates a session in both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - session - the session to update
+//
+// Returns:
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	if session == nil {
+		return errors.New("sessionstore > session update. session cannot be nil")
+	}
+
+	if err := sessionUpdateCheck(session); err != nil {
+		return err
+	}
+
+	return store.write(ctx, session, func(ctx context.Context, session SessionInterface) error {
+		return store.durable.SessionUpdate(ctx, session)
+	})
+}
+
+// SessionUpdateMany updates the sessions matching a query in the durable
+// tier, and drops them from the hot tier, which is warmed again on reads
+//
+// Parameters:
+//   - ctx - the context
+//   - query - the session query, which cannot be paginated or sorted
+//   - fields - the columns to update, with their values
+//
+// Returns:
+//   - int64 - the number of updated sessions
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionUpdateMany(ctx context.Context, query SessionQueryInterface, fields map[string]string) (int64, error) {
+	if err := store.drain(ctx); err != nil {
+		return 0, err
+	}
+
+	count, err := storeUpdateMany(ctx, store.durable, query, fields)
+
+	if err != nil {
+		return count, err
+	}
+
+	_, err = storeDeleteMany(ctx, store.hot, query)
+
+	return count, err
+}
+
+// SessionFindByIDIncludingDeleted finds a session by id, including the
+// soft deleted and expired sessions, from the durable tier, after the
+// pending writes
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//
+// Returns:
+//   - SessionInterface - the found session, nil if not found
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) SessionFindByIDIncludingDeleted(ctx context.Context, sessionID string) (SessionInterface, error) {
+	if err := store.drain(ctx); err != nil {
+		return nil, err
+	}
+
+	return storeFindByIDIncludingDeleted(ctx, store.durable, sessionID)
+}
+
+// SessionRestore restores a soft deleted session in the durable tier,
+// and drops it from the hot tier, which is warmed again on reads
+//
+// Parameters:
+//   - ctx - the context
+//   - sessionID - the session id
+//   - options - the restore options
+//
+// Returns:
+//   - error - ErrSessionNotFound if there is no such session, nil if successful, otherwise an error
+func (store *tieredStore) SessionRestore(ctx context.Context, sessionID string, options SessionRestoreOptions) error {
+	if err := store.drain(ctx); err != nil {
+		return err
+	}
+
+	if err := storeRestore(ctx, store.durable, sessionID, options); err != nil {
+		return err
+	}
+
+	return store.hot.SessionDeleteByID(ctx, sessionID)
+}
+
+// UserSessions returns the active sessions of a user, from the durable tier
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request, marked as current
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - nil if successful, otherwise an error
+func (store *tieredStore) UserSessions(ctx context.Context, userID string, currentSessionID string) ([]UserSession, error) {
+	return userSessionsList(ctx, store, store.userSessionHandleSecret, userID, currentSessionID)
+}
+
+// UserSessionRevoke deletes the session of a user identified by the
+// handle returned from UserSessions, from both tiers
+//
+// Parameters:
+//   - ctx - the context
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - error - ErrSessionNotFound if the user has no such session, nil if successful, otherwise an error
+func (store *tieredStore) UserSessionRevoke(ctx context.Context, userID string, handle string) error {
+	_, err := userSessionRevoke(ctx, store, store.userSessionHandleSecret, userID, handle)
+	return err
+}
+
+// PRIVATE METHODS ===========================================================
+
+// asyncWriter runs the queued durable writes, in order, until Close
+func (store *tieredStore) asyncWriter() {
+	defer close(store.writerDone)
+
+	for write := range store.queue {
+		if write.barrier != nil {
+			close(write.barrier)
+			continue
+		}
+
+		if err := write.write(context.Background()); err != nil {
+			store.durableWriteFailed(context.Background(), write.sessionID, err)
+		}
+	}
+}
+
+// drain waits for the durable writes queued before it, by queueing a
+// barrier behind them. Deletes drain the queue first, so that a queued
+// write cannot bring a deleted session back.
+func (store *tieredStore) drain(ctx context.Context) error {
+	if store.queue == nil {
+		return nil
+	}
+
+	barrier := make(chan struct{})
+
+	store.queueMu.RLock()
+
+	if store.queueClosed {
+		store.queueMu.RUnlock()
+		return nil // drained by Close
+	}
+
+	select {
+	case <-ctx.Done():
+		store.queueMu.RUnlock()
+		return ctx.Err()
+	case store.queue <- tieredWrite{barrier: barrier}:
+		store.queueMu.RUnlock()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-barrier:
+		return nil
+	}
+}
+
+// enqueue queues a durable write for the async writer. When the queue is
+// full, it waits for room, as writing past the queued writes would let them
+// overwrite a newer value.
+//
+// Parameters:
+//   - ctx - the context, cancelling it stops the wait
+//   - write - the durable write
+//
+// Returns:
+//   - bool - false if the queue is closed, the write is then for the caller to do
+//   - error - the context error if cancelled while waiting
+func (store *tieredStore) enqueue(ctx context.Context, write tieredWrite) (bool, error) {
+	store.queueMu.RLock()
+	defer store.queueMu.RUnlock()
+
+	if store.queueClosed {
+		return false, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case store.queue <- write:
+		return true, nil
+	}
+}
+
+// durableWriteFailed resolves the divergence of the tiers after an async
+// durable write failed, according to the consistency mode
+func (store *tieredStore) durableWriteFailed(ctx context.Context, sessionID string, err error) {
+	store.logger.Error("tiered session store: durable tier write failed",
+		slog.String("session_id", sessionID),
+		slog.String("consistency_mode", store.consistencyMode),
+		slog.String("error", err.Error()))
+
+	if store.consistencyMode == TIER_CONSISTENCY_HOT_WINS {
+		return
+	}
+
+	if err := store.hot.SessionDeleteByID(ctx, sessionID); err != nil {
+		store.logger.Error("tiered session store: hot tier invalidation failed", slog.String("error", err.Error()))
+	}
+}
+
+// hotPut replaces a session in the hot tier with a copy of the given one.
+// If that fails, the session is dropped from the hot tier, so that a stale
+// copy is never served.
+func (store *tieredStore) hotPut(ctx context.Context, session SessionInterface) {
+	err := store.hot.SessionDeleteByID(ctx, session.GetID())
+
+	if err == nil {
+		err = store.hot.SessionCreate(ctx, NewSessionFromExistingData(lo.Assign(session.Data())))
+	}
+
+	if err == nil {
+		return
+	}
+
+	store.logger.Error("tiered session store: hot tier write failed",
+		slog.String("session_id", session.GetID()),
+		slog.String("error", err.Error()))
+
+	if err := store.hot.SessionDeleteByID(ctx, session.GetID()); err != nil {
+		store.logger.Error("tiered session store: hot tier invalidation failed", slog.String("error", err.Error()))
+	}
+}
+
+// readThrough finds a session in the hot tier, or else in the durable
+// tier, warming the hot tier with it
+func (store *tieredStore) readThrough(ctx context.Context, find func(st StoreInterface) (SessionInterface, error)) (SessionInterface, error) {
+	session, err := find(store.hot)
+
+	if err != nil {
+		store.logger.Error("tiered session store: hot tier read failed", slog.String("error", err.Error()))
+	}
+
+	if session != nil {
+		return session, nil
+	}
+
+	session, err = find(store.durable)
+
+	if err != nil || session == nil {
+		return session, err
+	}
+
+	store.hotPut(ctx, session)
+
+	return session, nil
+}
+
+// write writes a session to the durable tier, then to the hot tier. In
+// async mode it is written to the hot tier, and the durable write of a
+// copy of it is queued.
+func (store *tieredStore) write(ctx context.Context, session SessionInterface, durableWrite func(ctx context.Context, session SessionInterface) error) error {
+	if store.writeMode == TIER_WRITE_MODE_SYNC {
+		if err := durableWrite(ctx, session); err != nil {
+			return err
+		}
+
+		store.hotPut(ctx, session)
+
+		return nil
+	}
+
+	session.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC))
+
+	snapshot := sessionClone(session)
+
+	store.hotPut(ctx, session)
+
+	queued, err := store.enqueue(ctx, tieredWrite{
+		sessionID: session.GetID(),
+		write: func(ctx context.Context) error {
+			return durableWrite(ctx, snapshot)
+		},
+	})
+
+	if err != nil {
+		store.durableWriteFailed(ctx, session.GetID(), err)
+		return err
+	}
+
+	if queued {
+		session.MarkAsNotDirty()
+		return nil
+	}
+
+	if err := durableWrite(ctx, snapshot); err != nil {
+		store.durableWriteFailed(ctx, session.GetID(), err)
+		return err
+	}
+
+	session.MarkAsNotDirty()
+
+	return nil
+}
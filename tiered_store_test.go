@@ -0,0 +1,383 @@
+package sessionstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingUpdateStore fails all the updates
+type failingUpdateStore struct {
+	StoreInterface
+}
+
+func (store *failingUpdateStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	return errors.New("update failed")
+}
+
+// blockingUpdateStore blocks the updates until released
+type blockingUpdateStore struct {
+	StoreInterface
+	release chan struct{}
+}
+
+func (store *blockingUpdateStore) SessionUpdate(ctx context.Context, session SessionInterface) error {
+	<-store.release
+	return store.StoreInterface.SessionUpdate(ctx, session)
+}
+
+func initTieredStore(t *testing.T, writeMode string, consistencyMode string, wrapDurable func(StoreInterface) StoreInterface) (*tieredStore, StoreInterface, StoreInterface) {
+	hot, _ := initRedisStore(t)
+
+	durable, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if wrapDurable != nil {
+		durable = wrapDurable(durable)
+	}
+
+	store, err := NewTieredStore(NewTieredStoreOptions{
+		Hot:             hot,
+		Durable:         durable,
+		WriteMode:       writeMode,
+		ConsistencyMode: consistencyMode,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	return store, hot, durable
+}
+
+func TestTieredStore_Sync(t *testing.T) {
+	store, hot, durable := initTieredStore(t, TIER_WRITE_MODE_SYNC, "", nil)
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1").SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, tier := range []StoreInterface{hot, durable} {
+		if found, err := tier.SessionFindByKey(ctx, session.GetKey()); err != nil || found == nil {
+			t.Fatal("Expected the session in both tiers, error:", err)
+		}
+	}
+
+	// the hot tier is warmed lazily
+	if err := hot.SessionDeleteByID(ctx, session.GetID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil || found == nil || found.GetValue() != "one" {
+		t.Fatal("Expected the session from the durable tier, found:", found, "error:", err)
+	}
+
+	if found, _ := hot.SessionFindByKey(ctx, session.GetKey()); found == nil {
+		t.Fatal("Expected the hot tier to be warmed")
+	}
+
+	session.SetValue("two")
+
+	if err := store.SessionUpdate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := hot.SessionFindByKey(ctx, session.GetKey()); found == nil || found.GetValue() != "two" {
+		t.Fatal("Expected the hot tier to be updated, found:", found)
+	}
+
+	if err := store.SessionSoftDelete(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := store.SessionFindByKey(ctx, session.GetKey()); found != nil {
+		t.Fatal("Soft deleted session MUST NOT be found in either tier")
+	}
+}
+
+func TestTieredStore_Async(t *testing.T) {
+	store, hot, durable := initTieredStore(t, TIER_WRITE_MODE_ASYNC, "", nil)
+	ctx := context.Background()
+
+	session := NewSession().SetUserID("1").SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := hot.SessionFindByKey(ctx, session.GetKey()); found == nil {
+		t.Fatal("Expected the session in the hot tier")
+	}
+
+	if err := store.SessionFlush(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := durable.SessionFindByKey(ctx, session.GetKey()); found == nil {
+		t.Fatal("Expected the session in the durable tier after the flush")
+	}
+
+	// a delete is never undone by a queued write
+	other := NewSession().SetUserID("1")
+
+	if err := store.SessionCreate(ctx, other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionDelete(ctx, other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionFlush(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found, _ := store.SessionFindByKey(ctx, other.GetKey()); found != nil {
+		t.Fatal("Deleted session MUST NOT be found")
+	}
+}
+
+func TestTieredStore_AsyncConsistencyModes(t *testing.T) {
+	failing := func(st StoreInterface) StoreInterface {
+		return &failingUpdateStore{StoreInterface: st}
+	}
+
+	for _, mode := range []string{TIER_CONSISTENCY_DURABLE_WINS, TIER_CONSISTENCY_HOT_WINS} {
+		store, hot, _ := initTieredStore(t, TIER_WRITE_MODE_ASYNC, mode, failing)
+		ctx := context.Background()
+
+		session := NewSession().SetValue("one")
+
+		if err := store.SessionCreate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		session.SetValue("two")
+
+		if err := store.SessionUpdate(ctx, session); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if err := store.SessionFlush(ctx); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		found, _ := hot.SessionFindByKey(ctx, session.GetKey())
+
+		if mode == TIER_CONSISTENCY_DURABLE_WINS && found != nil {
+			t.Fatal("Session MUST be dropped from the hot tier when the durable write fails")
+		}
+
+		if mode == TIER_CONSISTENCY_HOT_WINS && (found == nil || found.GetValue() != "two") {
+			t.Fatal("Session MUST be kept in the hot tier when the durable write fails, found:", found)
+		}
+
+		if mode == TIER_CONSISTENCY_DURABLE_WINS {
+			found, _ = store.SessionFindByKey(ctx, session.GetKey())
+
+			if found == nil || found.GetValue() != "one" {
+				t.Fatal("Expected the durable value after the divergence, found:", found)
+			}
+		}
+	}
+}
+
+func TestTieredStore_AsyncDrain(t *testing.T) {
+	release := make(chan struct{})
+
+	blocking := func(st StoreInterface) StoreInterface {
+		return &blockingUpdateStore{StoreInterface: st, release: release}
+	}
+
+	store, _, durable := initTieredStore(t, TIER_WRITE_MODE_ASYNC, "", blocking)
+	ctx := context.Background()
+
+	session := NewSession().SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	session.SetValue("two")
+
+	if err := store.SessionUpdate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// the drain gives up with its context, while the queued update is blocked
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := store.drain(timeoutCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected the drain to time out, found:", err)
+	}
+
+	// the abandoned barrier does not hold up the writes queued after it
+	for i := 0; i < 10; i++ {
+		if err := store.SessionUpdate(ctx, session.SetValue("three")); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	close(release)
+
+	if err := store.drain(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := durable.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "three" {
+		t.Fatal("Expected the queued writes in the durable tier after the drain, found:", found)
+	}
+}
+
+func TestTieredStore_Close(t *testing.T) {
+	store, _, durable := initTieredStore(t, TIER_WRITE_MODE_ASYNC, "", nil)
+	ctx := context.Background()
+
+	session := NewSession().SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.Close(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	select {
+	case <-store.writerDone:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the async writer to exit after Close")
+	}
+
+	found, err := durable.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "one" {
+		t.Fatal("Expected the queued write in the durable tier after Close, found:", found)
+	}
+
+	// closing again, flushing and writing after Close do not panic
+	if err := store.Close(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionUpdate(ctx, session.SetValue("two")); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.SessionFlush(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = durable.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "two" {
+		t.Fatal("Expected the write after Close in the durable tier, found:", found)
+	}
+}
+
+func TestTieredStore_AsyncQueueFull(t *testing.T) {
+	release := make(chan struct{})
+
+	hot, _ := initRedisStore(t)
+
+	durable, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := NewTieredStore(NewTieredStoreOptions{
+		Hot:            hot,
+		Durable:        &blockingUpdateStore{StoreInterface: durable, release: release},
+		WriteMode:      TIER_WRITE_MODE_ASYNC,
+		AsyncQueueSize: 1,
+	})
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	ctx := context.Background()
+
+	session := NewSession().SetValue("one")
+
+	if err := store.SessionCreate(ctx, session); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// the updates fill the queue, while the writer is blocked on the first one
+	updated := make(chan error, 1)
+
+	go func() {
+		for _, value := range []string{"two", "three", "four", "five"} {
+			if err := store.SessionUpdate(ctx, session.SetValue(value)); err != nil {
+				updated <- err
+				return
+			}
+		}
+
+		updated <- nil
+	}()
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(store.queue) < cap(store.queue) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the queue to fill up")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// a write waiting for room in the queue gives up with its context
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := store.SessionCreate(timeoutCtx, NewSession()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Expected the write to time out on the full queue, found:", err)
+	}
+
+	close(release)
+
+	if err := <-updated; err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.Close(ctx); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := durable.SessionFindByKey(ctx, session.GetKey())
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.GetValue() != "five" {
+		t.Fatal("Expected the last write in the durable tier, found:", found)
+	}
+}
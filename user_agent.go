@@ -0,0 +1,95 @@
+package sessionstore
+
+import "strings"
+
+// UserAgentInfo is the result of parsing a user agent string
+type UserAgentInfo struct {
+	Browser    string
+	OS         string
+	DeviceType string
+}
+
+// Family returns the browser and operating system, without versions,
+// i.e. "Chrome on Windows"
+func (info UserAgentInfo) Family() string {
+	return info.Browser + " on " + info.OS
+}
+
+// ParseUserAgent extracts the browser, operating system and device type
+// from a user agent string. It recognises the common families only,
+// anything else is reported as "Unknown".
+//
+// Parameters:
+//   - userAgent - the user agent string
+//
+// Returns:
+//   - UserAgentInfo - the parsed user agent
+func ParseUserAgent(userAgent string) UserAgentInfo {
+	return UserAgentInfo{
+		Browser:    userAgentBrowser(userAgent),
+		OS:         userAgentOS(userAgent),
+		DeviceType: userAgentDeviceType(userAgent),
+	}
+}
+
+// userAgentBrowser returns the browser family of the user agent. The order
+// of the checks matters, as most browsers also claim to be Chrome or Safari.
+func userAgentBrowser(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Edg/") || strings.Contains(userAgent, "EdgA/") || strings.Contains(userAgent, "EdgiOS/"):
+		return "Edge"
+	case strings.Contains(userAgent, "OPR/") || strings.Contains(userAgent, "Opera"):
+		return "Opera"
+	case strings.Contains(userAgent, "SamsungBrowser/"):
+		return "Samsung Internet"
+	case strings.Contains(userAgent, "Firefox/") || strings.Contains(userAgent, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(userAgent, "Chrome/") || strings.Contains(userAgent, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(userAgent, "Safari/") && strings.Contains(userAgent, "Version/"):
+		return "Safari"
+	case strings.Contains(userAgent, "MSIE ") || strings.Contains(userAgent, "Trident/"):
+		return "Internet Explorer"
+	}
+
+	return "Unknown"
+}
+
+// userAgentOS returns the operating system family of the user agent
+func userAgentOS(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "Windows"):
+		return "Windows"
+	case strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "iPod"):
+		return "iOS"
+	case strings.Contains(userAgent, "Mac OS X") || strings.Contains(userAgent, "Macintosh"):
+		return "macOS"
+	case strings.Contains(userAgent, "Android"):
+		return "Android"
+	case strings.Contains(userAgent, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(userAgent, "Linux"):
+		return "Linux"
+	}
+
+	return "Unknown"
+}
+
+// userAgentDeviceType returns the device type of the user agent,
+// one of the DEVICE_TYPE_* constants
+func userAgentDeviceType(userAgent string) string {
+	lower := strings.ToLower(userAgent)
+
+	switch {
+	case strings.TrimSpace(userAgent) == "":
+		return DEVICE_TYPE_UNKNOWN
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
+		return DEVICE_TYPE_BOT
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") || (strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile")):
+		return DEVICE_TYPE_TABLET
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPod"):
+		return DEVICE_TYPE_MOBILE
+	}
+
+	return DEVICE_TYPE_DESKTOP
+}
@@ -0,0 +1,47 @@
+package sessionstore
+
+import "testing"
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  UserAgentInfo
+	}{
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			expected:  UserAgentInfo{Browser: "Chrome", OS: "Windows", DeviceType: DEVICE_TYPE_DESKTOP},
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0",
+			expected:  UserAgentInfo{Browser: "Edge", OS: "Windows", DeviceType: DEVICE_TYPE_DESKTOP},
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			expected:  UserAgentInfo{Browser: "Safari", OS: "iOS", DeviceType: DEVICE_TYPE_MOBILE},
+		},
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			expected:  UserAgentInfo{Browser: "Chrome", OS: "Android", DeviceType: DEVICE_TYPE_TABLET},
+		},
+		{
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:121.0) Gecko/20100101 Firefox/121.0",
+			expected:  UserAgentInfo{Browser: "Firefox", OS: "macOS", DeviceType: DEVICE_TYPE_DESKTOP},
+		},
+		{
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  UserAgentInfo{Browser: "Unknown", OS: "Unknown", DeviceType: DEVICE_TYPE_BOT},
+		},
+		{
+			userAgent: "",
+			expected:  UserAgentInfo{Browser: "Unknown", OS: "Unknown", DeviceType: DEVICE_TYPE_UNKNOWN},
+		},
+	}
+
+	for _, test := range tests {
+		info := ParseUserAgent(test.userAgent)
+
+		if info != test.expected {
+			t.Fatal("unexpected result for:", test.userAgent, "expected:", test.expected, "found:", info)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package sessionstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/dracory/sb"
+	"github.com/dromara/carbon/v2"
+)
+
+// UserSession describes an active session of a user, as shown on
+// account security pages ("Where you're logged in")
+type UserSession struct {
+	// Handle is a stable opaque reference to the session, which can be
+	// passed to UserSessionRevoke without exposing the session key or id
+	Handle string
+
+	Browser    string
+	OS         string
+	DeviceType string
+	IPAddress  string
+
+	CreatedAt  string
+	LastSeenAt string
+	ExpiresAt  string
+
+	// IsCurrent is true for the session the listing was requested from
+	IsCurrent bool
+}
+
+// newUserSession creates the user session view of a session
+//
+// Parameters:
+//   - session - the session
+//   - currentSessionID - the id of the current session
+//   - handleSecret - the secret keying the handle
+//
+// Returns:
+//   - UserSession - the user session view
+func newUserSession(session SessionInterface, currentSessionID string, handleSecret []byte) UserSession {
+	userAgent := ParseUserAgent(session.GetUserAgent())
+
+	return UserSession{
+		Handle:     userSessionHandle(handleSecret, session.GetUserID(), session.GetID()),
+		Browser:    userAgent.Browser,
+		OS:         userAgent.OS,
+		DeviceType: userAgent.DeviceType,
+		IPAddress:  session.GetIPAddress(),
+		CreatedAt:  session.GetCreatedAt(),
+		LastSeenAt: session.GetUpdatedAt(),
+		ExpiresAt:  session.GetExpiresAt(),
+		IsCurrent:  currentSessionID != "" && session.GetID() == currentSessionID,
+	}
+}
+
+// userSessionHandle derives the opaque handle of a session, an HMAC keyed
+// with the secret of the store, so a handle cannot be derived from a
+// session id without it. It is bound to the user, so a handle of one user
+// never matches a session of another.
+func userSessionHandle(secret []byte, userID string, sessionID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(userID + ":" + sessionID))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// userSessionHandleSecretRandom returns a random secret keying the user
+// session handles, for the stores persisting their own
+func userSessionHandleSecretRandom() []byte {
+	random := make([]byte, 32)
+	_, _ = rand.Read(random) // never fails, see crypto/rand
+
+	return random
+}
+
+// userSessionsList lists the active sessions of a user in any store,
+// most recently seen first
+//
+// Parameters:
+//   - ctx - the context
+//   - st - the store
+//   - handleSecret - the secret keying the handles
+//   - userID - the user id
+//   - currentSessionID - the id of the session making the request
+//
+// Returns:
+//   - []UserSession - the active sessions of the user
+//   - error - ErrUserSessionHandleSecretRequired without a secret, nil if successful, otherwise an error
+func userSessionsList(ctx context.Context, st StoreInterface, handleSecret []byte, userID string, currentSessionID string) ([]UserSession, error) {
+	if len(handleSecret) == 0 {
+		return []UserSession{}, ErrUserSessionHandleSecretRequired
+	}
+
+	if userID == "" {
+		return []UserSession{}, errors.New("sessionstore > user sessions. user id cannot be empty")
+	}
+
+	list, err := st.SessionList(ctx, SessionQuery().
+		SetUserID(userID).
+		SetExpiresAtGte(carbon.Now(carbon.UTC).ToDateTimeString(carbon.UTC)).
+		SetOrderBy(COLUMN_UPDATED_AT).
+		SetSortOrder(sb.DESC))
+
+	if err != nil {
+		return []UserSession{}, err
+	}
+
+	userSessions := make([]UserSession, 0, len(list))
+
+	for _, session := range list {
+		userSessions = append(userSessions, newUserSession(session, currentSessionID, handleSecret))
+	}
+
+	return userSessions, nil
+}
+
+// userSessionRevoke deletes the session of a user identified by its
+// handle in any store
+//
+// Parameters:
+//   - ctx - the context
+//   - st - the store
+//   - handleSecret - the secret keying the handles
+//   - userID - the user id
+//   - handle - the user session handle
+//
+// Returns:
+//   - string - the id of the revoked session
+//   - error - ErrSessionNotFound if the user has no such session, ErrUserSessionHandleSecretRequired without a secret, nil if successful, otherwise an error
+func userSessionRevoke(ctx context.Context, st StoreInterface, handleSecret []byte, userID string, handle string) (string, error) {
+	if len(handleSecret) == 0 {
+		return "", ErrUserSessionHandleSecretRequired
+	}
+
+	if userID == "" {
+		return "", errors.New("sessionstore > user session revoke. user id cannot be empty")
+	}
+
+	if handle == "" {
+		return "", errors.New("sessionstore > user session revoke. handle cannot be empty")
+	}
+
+	list, err := st.SessionList(ctx, SessionQuery().
+		SetUserID(userID).
+		SetColumns([]string{COLUMN_ID, COLUMN_USER_ID}))
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, session := range list {
+		if !hmac.Equal([]byte(userSessionHandle(handleSecret, userID, session.GetID())), []byte(handle)) {
+			continue
+		}
+
+		if err := st.SessionDeleteByID(ctx, session.GetID()); err != nil {
+			return "", err
+		}
+
+		return session.GetID(), nil
+	}
+
+	return "", ErrSessionNotFound
+}
+
+// storeUserSessions lists the sessions of a user with UserSessions, if
+// the store implements UserSessionsStoreInterface
+func storeUserSessions(ctx context.Context, st StoreInterface, userID string, currentSessionID string) ([]UserSession, error) {
+	if users, ok := st.(UserSessionsStoreInterface); ok {
+		return users.UserSessions(ctx, userID, currentSessionID)
+	}
+
+	return []UserSession{}, errors.New("session store: the store does not support user sessions")
+}
+
+// storeUserSessionRevoke revokes the session of a user with
+// UserSessionRevoke, if the store implements UserSessionsStoreInterface
+func storeUserSessionRevoke(ctx context.Context, st StoreInterface, userID string, handle string) error {
+	if users, ok := st.(UserSessionsStoreInterface); ok {
+		return users.UserSessionRevoke(ctx, userID, handle)
+	}
+
+	return errors.New("session store: the store does not support user sessions")
+}
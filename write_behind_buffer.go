@@ -0,0 +1,69 @@
+package sessionstore
+
+import "sync"
+
+// writeBehindBuffer holds the pending expiry extensions, coalesced per session
+type writeBehindBuffer struct {
+	mu      sync.Mutex
+	pending map[string]writeBehindEntry // keyed by session id
+}
+
+// writeBehindEntry is the latest pending extension of a session
+type writeBehindEntry struct {
+	expiresAt string
+	updatedAt string
+}
+
+// newWriteBehindBuffer creates a new empty write-behind buffer
+func newWriteBehindBuffer() *writeBehindBuffer {
+	return &writeBehindBuffer{pending: map[string]writeBehindEntry{}}
+}
+
+// add buffers an extension, replacing any earlier one of the session
+func (buffer *writeBehindBuffer) add(sessionID string, entry writeBehindEntry) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	buffer.pending[sessionID] = entry
+}
+
+// remove drops the pending extension of a session, i.e. once it has been
+// written synchronously
+func (buffer *writeBehindBuffer) remove(sessionID string) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	delete(buffer.pending, sessionID)
+}
+
+// take returns and clears all the pending extensions
+func (buffer *writeBehindBuffer) take() map[string]writeBehindEntry {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	pending := buffer.pending
+	buffer.pending = map[string]writeBehindEntry{}
+
+	return pending
+}
+
+// restore puts back extensions which could not be written, unless
+// a newer extension of the same session has been buffered meanwhile
+func (buffer *writeBehindBuffer) restore(pending map[string]writeBehindEntry) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	for sessionID, entry := range pending {
+		if _, ok := buffer.pending[sessionID]; !ok {
+			buffer.pending[sessionID] = entry
+		}
+	}
+}
+
+// len returns the number of pending extensions
+func (buffer *writeBehindBuffer) len() int {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	return len(buffer.pending)
+}